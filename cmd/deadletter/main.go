@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/leetcode-golang-classroom/golang-async-api/internal/deadletter"
+	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/config"
+	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/db"
+	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/queue"
+	"github.com/leetcode-golang-classroom/golang-async-api/internal/report"
+)
+
+const usage = `usage: deadletter <command> [flags]
+
+commands:
+  list [-limit n] [-user id]           show dead letters, newest first
+  show <id>...                         show dead letters with their body
+  redrive <id>... | -all [-limit n]    build the reports of dead letters again
+  purge [-before RFC3339] [-user id]   delete dead letters created before the given time
+`
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	appConfig := config.AppConfig
+	rdb, err := db.Connect(appConfig.DBURL)
+	if err != nil {
+		return err
+	}
+	defer rdb.Close()
+	deadLetterStore := deadletter.NewDeadLetterStore(rdb)
+
+	command, flags := args[0], flag.NewFlagSet(args[0], flag.ExitOnError)
+	limit := flags.Int("limit", deadletter.DefaultListLimit, "number of dead letters")
+	userIDStr := flags.String("user", "", "only dead letters of this user id")
+	before := flags.String("before", "", "purge dead letters created before this RFC3339 time, defaults to now")
+	all := flags.Bool("all", false, "redrive the newest -limit dead letters")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	var userID *uuid.UUID
+	if *userIDStr != "" {
+		parsed, err := uuid.Parse(*userIDStr)
+		if err != nil {
+			return fmt.Errorf("invalid user id: %w", err)
+		}
+		userID = &parsed
+	}
+
+	switch command {
+	case "list":
+		deadLetters, err := deadLetterStore.List(ctx, deadletter.ListFilter{UserID: userID, Limit: *limit})
+		if err != nil {
+			return err
+		}
+		writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(writer, "ID\tCREATED_AT\tRECEIVES\tREPORT_ID\tERROR")
+		for _, deadLetter := range deadLetters {
+			reportID := "-"
+			if deadLetter.ReportID.Valid {
+				reportID = deadLetter.ReportID.UUID.String()
+			}
+			fmt.Fprintf(writer, "%s\t%s\t%d\t%s\t%s\n", deadLetter.ID, deadLetter.CreatedAt.Format(time.RFC3339),
+				deadLetter.ReceiveCount, reportID, deadLetter.ErrorMessage)
+		}
+		return writer.Flush()
+	case "show":
+		for _, id := range flags.Args() {
+			deadLetterID, err := uuid.Parse(id)
+			if err != nil {
+				return fmt.Errorf("invalid dead letter id %q: %w", id, err)
+			}
+			deadLetter, err := deadLetterStore.ByID(ctx, deadLetterID, userID)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("id: %s\nqueue: %s\nmessage_id: %s\nreceive_count: %d\ncreated_at: %s\nerror: %s\nbody: %s\n\n",
+				deadLetter.ID, deadLetter.Queue, deadLetter.MessageID, deadLetter.ReceiveCount,
+				deadLetter.CreatedAt.Format(time.RFC3339), deadLetter.ErrorMessage, deadLetter.Body)
+		}
+		return nil
+	case "redrive":
+		workerConfig, err := appConfig.Worker()
+		if err != nil {
+			return err
+		}
+		jobQueue, err := queue.New(ctx, appConfig, rdb, workerConfig.VisibilityTimeout)
+		if err != nil {
+			return err
+		}
+		reportStore := report.NewReportStore(rdb)
+		ids := flags.Args()
+		if *all {
+			deadLetters, err := deadLetterStore.List(ctx, deadletter.ListFilter{UserID: userID, Limit: *limit})
+			if err != nil {
+				return err
+			}
+			ids = ids[:0]
+			for _, deadLetter := range deadLetters {
+				ids = append(ids, deadLetter.ID.String())
+			}
+		}
+		for _, id := range ids {
+			deadLetterID, err := uuid.Parse(id)
+			if err != nil {
+				return fmt.Errorf("invalid dead letter id %q: %w", id, err)
+			}
+			if err := deadLetterStore.Redrive(ctx, jobQueue, reportStore.ResetFailed, deadLetterID, userID); err != nil {
+				return err
+			}
+			fmt.Printf("redrove %s\n", deadLetterID)
+		}
+		return nil
+	case "purge":
+		purgeBefore := time.Now().UTC()
+		if *before != "" {
+			if purgeBefore, err = time.Parse(time.RFC3339, *before); err != nil {
+				return fmt.Errorf("invalid before: %w", err)
+			}
+		}
+		deleted, err := deadLetterStore.Purge(ctx, userID, purgeBefore)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("purged %d dead letters\n", deleted)
+		return nil
+	}
+	fmt.Fprint(os.Stderr, usage)
+	os.Exit(2)
+	return nil
+}
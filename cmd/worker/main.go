@@ -2,21 +2,23 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"syscall"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	awsconfig "github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
-	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/leetcode-golang-classroom/golang-async-api/internal/deadletter"
+	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/blob"
 	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/config"
 	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/db"
 	mlog "github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/logger"
+	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/queue"
 	"github.com/leetcode-golang-classroom/golang-async-api/internal/report"
+	"github.com/leetcode-golang-classroom/golang-async-api/internal/webhook"
 )
 
 func main() {
@@ -32,37 +34,53 @@ func run() error {
 		},
 	))
 	rootContext := context.WithValue(context.Background(), mlog.CtxKey{}, logger)
-	ctx, cancel := signal.NotifyContext(rootContext, os.Interrupt)
+	ctx, cancel := signal.NotifyContext(rootContext, os.Interrupt, syscall.SIGTERM)
 	defer cancel()
 
 	appConfig := config.AppConfig
+	workerConfig, err := appConfig.Worker()
+	if err != nil {
+		return err
+	}
+	generators := report.NewGeneratorRegistry()
+	for reportType := range workerConfig.BuildTimeouts.ByReportType {
+		if err := generators.Validate(reportType); err != nil {
+			return fmt.Errorf("WORKER_BUILD_TIMEOUTS: %w", err)
+		}
+	}
 
 	rdb, err := db.Connect(appConfig.DBURL)
 	if err != nil {
 		return err
 	}
 	reportStore := report.NewReportStore(rdb)
-	awsConfig, err := awsconfig.LoadDefaultConfig(ctx)
+	blobStore, err := blob.New(ctx, appConfig)
 	if err != nil {
 		return err
 	}
-	s3Client := s3.NewFromConfig(awsConfig, func(options *s3.Options) {
-		options.BaseEndpoint = aws.String(appConfig.S3LocalstackEndPoint)
-		options.UsePathStyle = true
-	})
 
-	sqsClient := sqs.NewFromConfig(awsConfig, func(options *sqs.Options) {
-		options.BaseEndpoint = aws.String(appConfig.LocalstackEndPoint)
-	})
+	jobQueue, err := queue.New(ctx, appConfig, rdb, workerConfig.VisibilityTimeout)
+	if err != nil {
+		return err
+	}
 
 	lozClient := report.NewClient(&http.Client{
 		Timeout: 10 * time.Second,
-	})
+	}).WithMonstersCache(workerConfig.MonstersCacheTTL)
+
+	webhookStore := webhook.NewWebhookStore(rdb)
+	builder := report.NewReportBuilder(appConfig, reportStore, lozClient, blobStore,
+		generators, report.DefaultWorkerID(), workerConfig.BuildTimeouts, webhookStore,
+		workerConfig.ReuseWindow, workerConfig.LeaseDuration)
+
+	reaper := report.NewReaper(reportStore, webhookStore, logger, workerConfig)
+	go reaper.Start(ctx)
 
-	builder := report.NewReportBuilder(appConfig, reportStore, lozClient, s3Client)
+	dispatcher := webhook.NewDispatcher(webhookStore, logger)
+	go dispatcher.Start(ctx)
 
-	maxConcurrency := 2
-	worker := report.NewWorker(appConfig, builder, logger, sqsClient, int32(maxConcurrency))
+	worker := report.NewWorker(appConfig, builder, reportStore,
+		deadletter.NewDeadLetterStore(rdb), logger, jobQueue, workerConfig)
 	if err := worker.Start(ctx); err != nil {
 		return err
 	}
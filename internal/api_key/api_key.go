@@ -0,0 +1,148 @@
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+)
+
+const (
+	// HeaderAPIKey - header carrying an api key, "Authorization: ApiKey <key>" is accepted as well
+	HeaderAPIKey = "X-API-Key"
+	// AuthorizationScheme - scheme of the Authorization header for api keys
+	AuthorizationScheme = "ApiKey"
+	// keyPrefix - marks api keys, e.g. in secret scanners and logs
+	keyPrefix = "aak_"
+	// displayPrefixLength - characters of the key stored in clear so the user could tell keys apart
+	displayPrefixLength = 12
+)
+
+// Scopes that could be granted to a key, read covers GET requests and write every other method
+const (
+	ScopeReportsRead      = "reports:read"
+	ScopeReportsWrite     = "reports:write"
+	ScopeWebhooksRead     = "webhooks:read"
+	ScopeWebhooksWrite    = "webhooks:write"
+	ScopeDeadLettersRead  = "dead-letters:read"
+	ScopeDeadLettersWrite = "dead-letters:write"
+)
+
+// scopeResources - path prefix of each resource an api key could reach, /auth is never reachable
+// so a key could not manage sessions or other keys
+var scopeResources = []struct {
+	prefix   string
+	resource string
+}{
+	{"/reports", "reports"},
+	{"/webhooks", "webhooks"},
+	{"/webhook-deliveries", "webhooks"},
+	{"/dead-letters", "dead-letters"},
+}
+
+// RequiredScope - scope an api key needs for the request, false when api keys could not be used for the path
+func RequiredScope(method string, path string) (string, bool) {
+	for _, scopeResource := range scopeResources {
+		if path == scopeResource.prefix || strings.HasPrefix(path, scopeResource.prefix+"/") {
+			if method == http.MethodGet || method == http.MethodHead {
+				return scopeResource.resource + ":read", true
+			}
+			return scopeResource.resource + ":write", true
+		}
+	}
+	return "", false
+}
+
+// FromRequest - api key of the X-API-Key or Authorization header, empty when the request has none
+func FromRequest(r *http.Request) string {
+	if key := r.Header.Get(HeaderAPIKey); key != "" {
+		return key
+	}
+	scheme, key, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if ok && strings.EqualFold(scheme, AuthorizationScheme) {
+		return strings.TrimSpace(key)
+	}
+	return ""
+}
+
+// Generate - new random key, only its hash is stored
+func Generate() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("failed to generate api key: %w", err)
+	}
+	return keyPrefix + base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+// Hash - hex sha256 of key, keys are random so a slow hash is not needed
+func Hash(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
+
+// displayPrefix - leading part of key shown in listings
+func displayPrefix(key string) string {
+	return key[:min(len(key), displayPrefixLength)]
+}
+
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name" validate:"required,max=100"`
+	Scopes    []string   `json:"scopes" validate:"required,min=1,unique,dive,oneof=reports:read reports:write webhooks:read webhooks:write dead-letters:read dead-letters:write"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+func (r CreateAPIKeyRequest) Validate(validator *validator.Validate) error {
+	if err := validator.Struct(r); err != nil {
+		return err
+	}
+	if r.ExpiresAt != nil && !r.ExpiresAt.After(time.Now()) {
+		return fmt.Errorf("expires_at must be in the future")
+	}
+	return nil
+}
+
+type ApiAPIKey struct {
+	ID     uuid.UUID `json:"id"`
+	Name   string    `json:"name"`
+	Prefix string    `json:"prefix"`
+	// Key - only returned when the key is created
+	Key        string     `json:"key,omitempty"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+func NewApiAPIKey(apiKey *APIKey) ApiAPIKey {
+	apiAPIKey := ApiAPIKey{
+		ID:        apiKey.ID,
+		Name:      apiKey.Name,
+		Prefix:    apiKey.Prefix,
+		Scopes:    apiKey.Scopes,
+		CreatedAt: apiKey.CreatedAt,
+	}
+	if apiKey.ExpiresAt.Valid {
+		apiAPIKey.ExpiresAt = &apiKey.ExpiresAt.Time
+	}
+	if apiKey.LastUsedAt.Valid {
+		apiAPIKey.LastUsedAt = &apiKey.LastUsedAt.Time
+	}
+	return apiAPIKey
+}
+
+type ListAPIKeysResponse struct {
+	APIKeys []ApiAPIKey `json:"api_keys"`
+}
+
+// HasScope - whether the key was granted scope
+func (k *APIKey) HasScope(scope string) bool {
+	return slices.Contains(k.Scopes, scope)
+}
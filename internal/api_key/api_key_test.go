@@ -0,0 +1,68 @@
+package apikey_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	apikey "github.com/leetcode-golang-classroom/golang-async-api/internal/api_key"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequiredScope(t *testing.T) {
+	scope, ok := apikey.RequiredScope(http.MethodGet, "/reports/123")
+	require.True(t, ok)
+	assert.Equal(t, apikey.ScopeReportsRead, scope)
+	scope, ok = apikey.RequiredScope(http.MethodPost, "/reports")
+	require.True(t, ok)
+	assert.Equal(t, apikey.ScopeReportsWrite, scope)
+	scope, ok = apikey.RequiredScope(http.MethodPost, "/webhook-deliveries/123/replay")
+	require.True(t, ok)
+	assert.Equal(t, apikey.ScopeWebhooksWrite, scope)
+	scope, ok = apikey.RequiredScope(http.MethodHead, "/dead-letters")
+	require.True(t, ok)
+	assert.Equal(t, apikey.ScopeDeadLettersRead, scope)
+
+	_, ok = apikey.RequiredScope(http.MethodGet, "/auth/api-keys")
+	assert.False(t, ok)
+	_, ok = apikey.RequiredScope(http.MethodGet, "/reportsx")
+	assert.False(t, ok)
+}
+
+func TestFromRequest(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/reports", nil)
+	assert.Empty(t, apikey.FromRequest(r))
+	r.Header.Set("Authorization", "Bearer token")
+	assert.Empty(t, apikey.FromRequest(r))
+	r.Header.Set("Authorization", "ApiKey aak_key")
+	assert.Equal(t, "aak_key", apikey.FromRequest(r))
+	r.Header.Set(apikey.HeaderAPIKey, "aak_header")
+	assert.Equal(t, "aak_header", apikey.FromRequest(r))
+}
+
+func TestGenerate(t *testing.T) {
+	key1, err := apikey.Generate()
+	require.NoError(t, err)
+	key2, err := apikey.Generate()
+	require.NoError(t, err)
+	assert.Regexp(t, "^aak_[A-Za-z0-9_-]{43}$", key1)
+	assert.NotEqual(t, key1, key2)
+	assert.Regexp(t, "^[0-9a-f]{64}$", apikey.Hash(key1))
+	assert.Equal(t, apikey.Hash(key1), apikey.Hash(key1))
+	assert.NotEqual(t, apikey.Hash(key1), apikey.Hash(key2))
+}
+
+func TestCreateAPIKeyRequestValidate(t *testing.T) {
+	v := validator.New()
+	future := time.Now().Add(time.Hour)
+	past := time.Now().Add(-time.Hour)
+	require.NoError(t, apikey.CreateAPIKeyRequest{Name: "ci", Scopes: []string{apikey.ScopeReportsRead}}.Validate(v))
+	require.NoError(t, apikey.CreateAPIKeyRequest{Name: "ci", Scopes: []string{apikey.ScopeReportsRead}, ExpiresAt: &future}.Validate(v))
+	assert.Error(t, apikey.CreateAPIKeyRequest{Name: "ci", Scopes: []string{apikey.ScopeReportsRead}, ExpiresAt: &past}.Validate(v))
+	assert.Error(t, apikey.CreateAPIKeyRequest{Name: "ci"}.Validate(v))
+	assert.Error(t, apikey.CreateAPIKeyRequest{Name: "ci", Scopes: []string{"auth:write"}}.Validate(v))
+	assert.Error(t, apikey.CreateAPIKeyRequest{Scopes: []string{apikey.ScopeReportsRead}}.Validate(v))
+}
@@ -0,0 +1,158 @@
+package apikey
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/helper"
+	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/response"
+	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/util"
+)
+
+// Handler - api keys of the authenticated user, reachable with an access token only
+type Handler struct {
+	logger      *slog.Logger
+	validator   *validator.Validate
+	apiKeyStore *APIKeyStore
+}
+
+func NewHandler(logger *slog.Logger,
+	validator *validator.Validate,
+	apiKeyStore *APIKeyStore,
+) *Handler {
+	return &Handler{
+		logger:      logger,
+		validator:   validator,
+		apiKeyStore: apiKeyStore,
+	}
+}
+
+func (h *Handler) RegisterRoute(router *http.ServeMux) {
+	router.HandleFunc("POST /auth/api-keys", h.createAPIKeyHandler())
+	router.HandleFunc("GET /auth/api-keys", h.listAPIKeysHandler())
+	router.HandleFunc("DELETE /auth/api-keys/{id}", h.revokeAPIKeyHandler())
+}
+
+// createAPIKeyHandler - create a key, the key itself is only returned here
+func (h *Handler) createAPIKeyHandler() http.HandlerFunc {
+	return helper.Handler(func(w http.ResponseWriter, r *http.Request) error {
+		req, err := helper.Decode[CreateAPIKeyRequest](r, h.validator)
+		if err != nil {
+			return helper.NewErrWithStatus(
+				http.StatusBadRequest,
+				err,
+			)
+		}
+		defer r.Body.Close()
+		user, ok := util.UserFromContext(r.Context())
+		if !ok {
+			return helper.NewErrWithStatus(
+				http.StatusUnauthorized,
+				fmt.Errorf("user not found in context"),
+			)
+		}
+		key, err := Generate()
+		if err != nil {
+			return helper.NewErrWithStatus(
+				http.StatusInternalServerError,
+				err,
+			)
+		}
+		apiKey, err := h.apiKeyStore.Create(r.Context(), user.ID, key, req.Name, req.Scopes, req.ExpiresAt)
+		if err != nil {
+			return helper.NewErrWithStatus(
+				http.StatusInternalServerError,
+				err,
+			)
+		}
+		apiAPIKey := NewApiAPIKey(apiKey)
+		apiAPIKey.Key = key
+		if err := helper.Encode(response.ApiResponse[ApiAPIKey]{
+			Data: &apiAPIKey,
+		},
+			http.StatusCreated,
+			w,
+		); err != nil {
+			return helper.NewErrWithStatus(
+				http.StatusInternalServerError,
+				err,
+			)
+		}
+		return nil
+	})
+}
+
+func (h *Handler) listAPIKeysHandler() http.HandlerFunc {
+	return helper.Handler(func(w http.ResponseWriter, r *http.Request) error {
+		user, ok := util.UserFromContext(r.Context())
+		if !ok {
+			return helper.NewErrWithStatus(
+				http.StatusUnauthorized,
+				fmt.Errorf("user not found in context"),
+			)
+		}
+		apiKeys, err := h.apiKeyStore.List(r.Context(), user.ID)
+		if err != nil {
+			return helper.NewErrWithStatus(
+				http.StatusInternalServerError,
+				err,
+			)
+		}
+		resp := ListAPIKeysResponse{
+			APIKeys: make([]ApiAPIKey, 0, len(apiKeys)),
+		}
+		for i := range apiKeys {
+			resp.APIKeys = append(resp.APIKeys, NewApiAPIKey(&apiKeys[i]))
+		}
+		if err := helper.Encode(response.ApiResponse[ListAPIKeysResponse]{
+			Data: &resp,
+		},
+			http.StatusOK,
+			w,
+		); err != nil {
+			return helper.NewErrWithStatus(
+				http.StatusInternalServerError,
+				err,
+			)
+		}
+		return nil
+	})
+}
+
+func (h *Handler) revokeAPIKeyHandler() http.HandlerFunc {
+	return helper.Handler(func(w http.ResponseWriter, r *http.Request) error {
+		id, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			return helper.NewErrWithStatus(
+				http.StatusBadRequest,
+				err,
+			)
+		}
+		user, ok := util.UserFromContext(r.Context())
+		if !ok {
+			return helper.NewErrWithStatus(
+				http.StatusUnauthorized,
+				fmt.Errorf("user not found in context"),
+			)
+		}
+		if err := h.apiKeyStore.Revoke(r.Context(), user.ID, id); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return helper.NewErrWithStatus(
+					http.StatusNotFound,
+					errors.New("api key not found"),
+				)
+			}
+			return helper.NewErrWithStatus(
+				http.StatusInternalServerError,
+				err,
+			)
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	})
+}
@@ -0,0 +1,97 @@
+package apikey
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+type APIKeyStore struct {
+	db *sqlx.DB
+}
+
+func NewAPIKeyStore(db *sql.DB) *APIKeyStore {
+	return &APIKeyStore{
+		db: sqlx.NewDb(db, "postgres"),
+	}
+}
+
+// APIKey - key of a machine client acting as the user, only the hash of the key is stored
+type APIKey struct {
+	ID         uuid.UUID      `db:"id"`
+	UserID     uuid.UUID      `db:"user_id"`
+	Name       string         `db:"name"`
+	Prefix     string         `db:"prefix"`
+	HashedKey  string         `db:"hashed_key"`
+	Scopes     pq.StringArray `db:"scopes"`
+	CreatedAt  time.Time      `db:"created_at"`
+	ExpiresAt  sql.NullTime   `db:"expires_at"`
+	LastUsedAt sql.NullTime   `db:"last_used_at"`
+	RevokedAt  sql.NullTime   `db:"revoked_at"`
+}
+
+// Create - store the hash of key for userID
+func (s *APIKeyStore) Create(ctx context.Context, userID uuid.UUID, key string, name string, scopes []string, expiresAt *time.Time) (*APIKey, error) {
+	const prepareStmt = `
+INSERT INTO api_keys(user_id, name, prefix, hashed_key, scopes, expires_at)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING *;
+	`
+	var expires sql.NullTime
+	if expiresAt != nil {
+		expires = sql.NullTime{Time: expiresAt.UTC(), Valid: true}
+	}
+	var apiKey APIKey
+	if err := s.db.GetContext(ctx, &apiKey, prepareStmt, userID, name, displayPrefix(key), Hash(key),
+		pq.StringArray(scopes), expires); err != nil {
+		return nil, fmt.Errorf("failed to insert api key for user %s: %w", userID, err)
+	}
+	return &apiKey, nil
+}
+
+// List - keys of userID that are not revoked, newest first
+func (s *APIKeyStore) List(ctx context.Context, userID uuid.UUID) ([]APIKey, error) {
+	const prepareStmt = `SELECT * FROM api_keys WHERE user_id = $1 AND revoked_at IS NULL ORDER BY created_at DESC, id;`
+	var apiKeys []APIKey
+	if err := s.db.SelectContext(ctx, &apiKeys, prepareStmt, userID); err != nil {
+		return nil, fmt.Errorf("failed to query api keys for user %s: %w", userID, err)
+	}
+	return apiKeys, nil
+}
+
+// Revoke - reject the key from now on, sql.ErrNoRows when it does not exist or is already revoked
+func (s *APIKeyStore) Revoke(ctx context.Context, userID uuid.UUID, id uuid.UUID) error {
+	const prepareStmt = `UPDATE api_keys SET revoked_at = $3 WHERE user_id = $1 AND id = $2 AND revoked_at IS NULL;`
+	result, err := s.db.ExecContext(ctx, prepareStmt, userID, id, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("failed to revoke api key %s for user %s: %w", id, userID, err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to revoke api key %s for user %s: %w", id, userID, err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("failed to revoke api key %s for user %s: %w", id, userID, sql.ErrNoRows)
+	}
+	return nil
+}
+
+// Authenticate - the active key matching key, last_used_at is updated in the same statement.
+// sql.ErrNoRows when the key is unknown, revoked or expired
+func (s *APIKeyStore) Authenticate(ctx context.Context, key string) (*APIKey, error) {
+	const prepareStmt = `
+UPDATE api_keys SET last_used_at = $2
+WHERE hashed_key = $1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > $2)
+RETURNING *;
+	`
+	var apiKey APIKey
+	if err := s.db.GetContext(ctx, &apiKey, prepareStmt, Hash(key), time.Now().UTC()); err != nil {
+		return nil, fmt.Errorf("failed to authenticate api key: %w", err)
+	}
+	return &apiKey, nil
+}
@@ -0,0 +1,94 @@
+package apikey_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/google/uuid"
+	apikey "github.com/leetcode-golang-classroom/golang-async-api/internal/api_key"
+	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/config"
+	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/db"
+	"github.com/leetcode-golang-classroom/golang-async-api/internal/user"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func SetupDB(t *testing.T) (*sql.DB, *migrate.Migrate) {
+	t.Helper()
+	appConfig := config.AppConfig
+	appConfig.SetupEnv(config.Env_Dev)
+	dbURL := appConfig.DBURLTEST
+	db, err := db.Connect(dbURL)
+	require.NoError(t, err)
+
+	result := strings.Replace(appConfig.PROJECT_ROOT, "/internal/api_key", "", 1)
+	m, err := migrate.New(
+		fmt.Sprintf("file://%s/migrations", result),
+		dbURL,
+	)
+	require.NoError(t, err)
+	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
+		require.NoError(t, err)
+	}
+	return db, m
+}
+
+func TestAPIKeyStore(t *testing.T) {
+	db, m := SetupDB(t)
+	defer db.Close()
+	ctx := context.Background()
+	apiKeyStore := apikey.NewAPIKeyStore(db)
+	user1, err := user.NewUserStore(db).CreateUser(ctx, "apikey@test.com", "secretpassword")
+	require.NoError(t, err)
+
+	key, err := apikey.Generate()
+	require.NoError(t, err)
+	created, err := apiKeyStore.Create(ctx, user1.ID, key, "ci", []string{apikey.ScopeReportsRead}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, key[:12], created.Prefix)
+	assert.Equal(t, apikey.Hash(key), created.HashedKey)
+	assert.False(t, created.LastUsedAt.Valid)
+
+	authenticated, err := apiKeyStore.Authenticate(ctx, key)
+	require.NoError(t, err)
+	assert.Equal(t, created.ID, authenticated.ID)
+	assert.Equal(t, user1.ID, authenticated.UserID)
+	assert.True(t, authenticated.LastUsedAt.Valid)
+	assert.True(t, authenticated.HasScope(apikey.ScopeReportsRead))
+	assert.False(t, authenticated.HasScope(apikey.ScopeReportsWrite))
+	_, err = apiKeyStore.Authenticate(ctx, key+"x")
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	// expired keys are rejected
+	expiredKey, err := apikey.Generate()
+	require.NoError(t, err)
+	expiresAt := time.Now().Add(-time.Minute)
+	_, err = apiKeyStore.Create(ctx, user1.ID, expiredKey, "expired", []string{apikey.ScopeReportsRead}, &expiresAt)
+	require.NoError(t, err)
+	_, err = apiKeyStore.Authenticate(ctx, expiredKey)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	apiKeys, err := apiKeyStore.List(ctx, user1.ID)
+	require.NoError(t, err)
+	assert.Len(t, apiKeys, 2)
+
+	// revoked keys are rejected and not listed
+	assert.ErrorIs(t, apiKeyStore.Revoke(ctx, uuid.New(), created.ID), sql.ErrNoRows)
+	require.NoError(t, apiKeyStore.Revoke(ctx, user1.ID, created.ID))
+	assert.ErrorIs(t, apiKeyStore.Revoke(ctx, user1.ID, created.ID), sql.ErrNoRows)
+	_, err = apiKeyStore.Authenticate(ctx, key)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	apiKeys, err = apiKeyStore.List(ctx, user1.ID)
+	require.NoError(t, err)
+	require.Len(t, apiKeys, 1)
+	assert.Equal(t, "expired", apiKeys[0].Name)
+
+	m.Down()
+}
@@ -10,11 +10,14 @@ import (
 	"time"
 
 	"github.com/go-playground/validator/v10"
+	apikey "github.com/leetcode-golang-classroom/golang-async-api/internal/api_key"
 	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/config"
 	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/db"
 	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/jwt"
 	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/logger"
 	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/util"
+	"github.com/leetcode-golang-classroom/golang-async-api/internal/report"
+	revokedtoken "github.com/leetcode-golang-classroom/golang-async-api/internal/revoked_token"
 	"github.com/leetcode-golang-classroom/golang-async-api/internal/user"
 )
 
@@ -26,6 +29,14 @@ type App struct {
 	db         *sql.DB
 	userStore  *user.UserStore
 	jwtManager *jwt.JWTManager
+	// outboxRelay - publish queued report jobs while the server runs
+	outboxRelay *report.OutboxRelay
+	// eventBroker - report events for the event streams served by this instance
+	eventBroker *report.EventBroker
+	// revokedTokens - revoked access tokens checked by the auth middleware
+	revokedTokens *revokedtoken.Cache
+	// apiKeyStore - api keys accepted by the auth middleware
+	apiKeyStore *apikey.APIKeyStore
 }
 
 func New(ctx context.Context, config *config.Config) *App {
@@ -47,13 +58,20 @@ func New(ctx context.Context, config *config.Config) *App {
 
 func (app *App) Start(ctx context.Context) error {
 	middleware := NewLoggerMiddleware(ctx)
-	authMiddleware := NewAuthMiddleware(ctx, app.jwtManager, app.userStore)
+	authMiddleware := NewAuthMiddleware(ctx, app.jwtManager, app.userStore, app.revokedTokens, app.apiKeyStore)
 	server := &http.Server{
 		Addr:    fmt.Sprintf(":%s", app.config.Port),
 		Handler: authMiddleware(middleware(app.router)),
 	}
 	log := logger.FromContext(ctx)
 	log.Info(fmt.Sprintf("starting server on %s", app.config.Port))
+	go app.outboxRelay.Start(ctx)
+	go app.revokedTokens.Start(ctx)
+	go func() {
+		if err := app.eventBroker.Start(ctx); err != nil {
+			log.Error("failed to start report event broker", slog.Any("err", err))
+		}
+	}()
 	var err error
 	errCh := make(chan error, 1)
 	go func() {
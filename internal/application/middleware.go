@@ -8,9 +8,12 @@ import (
 	"strings"
 
 	"github.com/google/uuid"
+	apikey "github.com/leetcode-golang-classroom/golang-async-api/internal/api_key"
+	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/blob"
 	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/jwt"
 	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/logger"
 	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/util"
+	revokedtoken "github.com/leetcode-golang-classroom/golang-async-api/internal/revoked_token"
 	"github.com/leetcode-golang-classroom/golang-async-api/internal/user"
 )
 
@@ -24,14 +27,41 @@ func NewLoggerMiddleware(ctx context.Context) func(next http.Handler) http.Handl
 	}
 }
 
-func NewAuthMiddleware(ctx context.Context, jwtManager *jwt.JWTManager, userStore *user.UserStore) func(next http.Handler) http.Handler {
+// publicAuthPaths - auth endpoints reached without an access token, session management and logout-all require one
+var publicAuthPaths = map[string]bool{
+	"/auth/signup":  true,
+	"/auth/signIn":  true,
+	"/auth/refresh": true,
+	"/auth/logout":  true,
+}
+
+func isPublicAuthPath(path string) bool {
+	return publicAuthPaths[path]
+}
+
+// NewAuthMiddleware - accept access tokens that are signed, not revoked and of the current token version of the user.
+// Revocations are checked against revokedTokens, the version against the user that is loaded anyway.
+// Requests with an api key are authenticated by apiKeyStore instead and limited to the scopes of the key
+func NewAuthMiddleware(ctx context.Context, jwtManager *jwt.JWTManager, userStore *user.UserStore,
+	revokedTokens *revokedtoken.Cache, apiKeyStore *apikey.APIKeyStore) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			log := logger.FromContext(ctx)
-			if strings.HasPrefix(r.URL.Path, "/auth") {
+			// blob downloads are authorized by the url signature, the jwks only holds public keys
+			if isPublicAuthPath(r.URL.Path) || strings.HasPrefix(r.URL.Path, blob.DownloadPath) || r.URL.Path == jwt.JWKSPath {
 				next.ServeHTTP(w, r)
 				return
 			}
+			if key := apikey.FromRequest(r); key != "" {
+				user, status, err := authenticateAPIKey(r, apiKeyStore, userStore, key)
+				if err != nil {
+					log.Warn("failed to authenticate api key", slog.Any("error", err))
+					w.WriteHeader(status)
+					return
+				}
+				next.ServeHTTP(w, r.WithContext(util.ContextWithUserID(r.Context(), user)))
+				return
+			}
 			// authorization header
 			authHeader := r.Header.Get("Authorization")
 			var token string
@@ -55,6 +85,18 @@ func NewAuthMiddleware(ctx context.Context, jwtManager *jwt.JWTManager, userStor
 				return
 			}
 
+			jti, err := jwt.TokenID(parsedToken)
+			if err != nil {
+				log.Error("failed to extract jti claim from token", slog.Any("error", err))
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if revokedTokens.IsRevoked(jti) {
+				w.WriteHeader(http.StatusUnauthorized)
+				w.Write([]byte("token revoked"))
+				return
+			}
+
 			userIDStr, err := parsedToken.Claims.GetSubject()
 			if err != nil {
 				log.Error("failed to extract subject claim from token", slog.Any("error", err))
@@ -75,8 +117,35 @@ func NewAuthMiddleware(ctx context.Context, jwtManager *jwt.JWTManager, userStor
 				w.WriteHeader(http.StatusUnauthorized)
 				return
 			}
+			tokenVersion, err := jwt.TokenVersion(parsedToken)
+			if err != nil || tokenVersion < user.TokenVersion {
+				w.WriteHeader(http.StatusUnauthorized)
+				w.Write([]byte("token revoked"))
+				return
+			}
 
 			next.ServeHTTP(w, r.WithContext(util.ContextWithUserID(r.Context(), user)))
 		})
 	}
 }
+
+// authenticateAPIKey - user of an active api key that holds the scope the request needs, the status to
+// respond with when the key is rejected
+func authenticateAPIKey(r *http.Request, apiKeyStore *apikey.APIKeyStore, userStore *user.UserStore, key string) (*user.User, int, error) {
+	scope, ok := apikey.RequiredScope(r.Method, r.URL.Path)
+	if !ok {
+		return nil, http.StatusForbidden, fmt.Errorf("api keys could not be used for %s", r.URL.Path)
+	}
+	apiKey, err := apiKeyStore.Authenticate(r.Context(), key)
+	if err != nil {
+		return nil, http.StatusUnauthorized, err
+	}
+	if !apiKey.HasScope(scope) {
+		return nil, http.StatusForbidden, fmt.Errorf("api key %s lacks scope %s", apiKey.ID, scope)
+	}
+	user, err := userStore.ByID(r.Context(), apiKey.UserID)
+	if err != nil {
+		return nil, http.StatusUnauthorized, err
+	}
+	return user, 0, nil
+}
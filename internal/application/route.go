@@ -4,15 +4,17 @@ import (
 	"context"
 	"os"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	awsconfig "github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
-	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	apikey "github.com/leetcode-golang-classroom/golang-async-api/internal/api_key"
+	"github.com/leetcode-golang-classroom/golang-async-api/internal/deadletter"
+	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/blob"
 	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/jwt"
 	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/logger"
+	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/queue"
 	refreshtoken "github.com/leetcode-golang-classroom/golang-async-api/internal/refresh_token"
 	"github.com/leetcode-golang-classroom/golang-async-api/internal/report"
+	revokedtoken "github.com/leetcode-golang-classroom/golang-async-api/internal/revoked_token"
 	"github.com/leetcode-golang-classroom/golang-async-api/internal/user"
+	"github.com/leetcode-golang-classroom/golang-async-api/internal/webhook"
 )
 
 func (app *App) SetupRoute(ctx context.Context) {
@@ -22,33 +24,58 @@ func (app *App) SetupRoute(ctx context.Context) {
 
 	userStore := user.NewUserStore(app.db)
 	refreshTokenStore := refreshtoken.NewRefreshTokenStore(app.db)
-	jwtManager := jwt.NewJWTManager(app.config)
+	jwtManager, err := jwt.NewJWTManager(app.config)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to setup jwt manager", "err", err)
+		os.Exit(1)
+	}
+	app.router.HandleFunc("GET "+jwt.JWKSPath, jwtManager.JWKSHandler())
 	app.userStore = userStore
 	app.jwtManager = jwtManager
-	userHandler := user.NewHandler(slog, app.validator, userStore, refreshTokenStore, jwtManager)
+	app.revokedTokens = revokedtoken.NewCache(revokedtoken.NewRevokedTokenStore(app.db), slog)
+	userHandler := user.NewHandler(slog, app.validator, userStore, refreshTokenStore, jwtManager, app.revokedTokens)
 	userHandler.RegisterRoute(app.router)
+	app.apiKeyStore = apikey.NewAPIKeyStore(app.db)
+	apiKeyHandler := apikey.NewHandler(slog, app.validator, app.apiKeyStore)
+	apiKeyHandler.RegisterRoute(app.router)
 
-	sdkConfig, err := awsconfig.LoadDefaultConfig(ctx)
+	workerConfig, err := app.config.Worker()
 	if err != nil {
-		slog.ErrorContext(ctx, "failed to load sdk config")
+		slog.ErrorContext(ctx, "failed to load worker config", "err", err)
 		os.Exit(1)
 	}
-	sqsClient := sqs.NewFromConfig(sdkConfig, func(options *sqs.Options) {
-		options.BaseEndpoint = aws.String(app.config.LocalstackEndPoint)
-	})
-
-	s3Client := s3.NewFromConfig(sdkConfig, func(options *s3.Options) {
-		options.BaseEndpoint = aws.String(app.config.S3LocalstackEndPoint)
-		options.UsePathStyle = true
-	})
-	presignedClient := s3.NewPresignClient(s3Client)
+	jobQueue, err := queue.New(ctx, app.config, app.db, workerConfig.VisibilityTimeout)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to setup queue", "err", err)
+		os.Exit(1)
+	}
+
+	blobStore, err := blob.New(ctx, app.config)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to setup blob store", "err", err)
+		os.Exit(1)
+	}
+	// the local backend has no storage service, signed downloads are served here
+	if localStore, ok := blobStore.(*blob.LocalStore); ok {
+		app.router.HandleFunc("GET "+blob.DownloadPath+"{key...}", localStore.DownloadHandler())
+	}
 	reportStore := report.NewReportStore(app.db)
+	app.eventBroker = report.NewEventBroker(app.config.DBURL, slog)
 
 	reportHandler := report.NewHandler(slog, app.validator, jwtManager,
 		reportStore,
-		sqsClient,
 		app.config,
-		presignedClient,
+		blobStore,
+		report.NewGeneratorRegistry(),
+		app.eventBroker,
 	)
 	reportHandler.RegisterRoute(app.router)
+	app.outboxRelay = report.NewOutboxRelay(reportStore, jobQueue, slog)
+
+	deadLetterHandler := deadletter.NewHandler(slog, deadletter.NewDeadLetterStore(app.db), jobQueue,
+		reportStore.ResetFailed)
+	deadLetterHandler.RegisterRoute(app.router)
+
+	webhookHandler := webhook.NewHandler(slog, app.validator, webhook.NewWebhookStore(app.db))
+	webhookHandler.RegisterRoute(app.router)
 }
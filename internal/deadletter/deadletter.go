@@ -0,0 +1,76 @@
+package deadletter
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	DefaultListLimit = 50
+	MaxListLimit     = 100
+)
+
+type ApiDeadLetter struct {
+	ID           uuid.UUID  `json:"id"`
+	Queue        string     `json:"queue"`
+	MessageID    string     `json:"message_id"`
+	Body         string     `json:"body"`
+	ErrorMessage string     `json:"error_message"`
+	ReceiveCount int        `json:"receive_count"`
+	ReportID     *uuid.UUID `json:"report_id,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+func NewApiDeadLetter(deadLetter *DeadLetter) ApiDeadLetter {
+	apiDeadLetter := ApiDeadLetter{
+		ID:           deadLetter.ID,
+		Queue:        deadLetter.Queue,
+		MessageID:    deadLetter.MessageID,
+		Body:         string(deadLetter.Body),
+		ErrorMessage: deadLetter.ErrorMessage,
+		ReceiveCount: deadLetter.ReceiveCount,
+		CreatedAt:    deadLetter.CreatedAt,
+	}
+	if deadLetter.ReportID.Valid {
+		apiDeadLetter.ReportID = &deadLetter.ReportID.UUID
+	}
+	return apiDeadLetter
+}
+
+type ListDeadLettersResponse struct {
+	DeadLetters []ApiDeadLetter `json:"dead_letters"`
+}
+
+type PurgeDeadLettersResponse struct {
+	Deleted int64 `json:"deleted"`
+}
+
+// ParseLimit - limit query value, DefaultListLimit when empty
+func ParseLimit(query url.Values) (int, error) {
+	value := query.Get("limit")
+	if value == "" {
+		return DefaultListLimit, nil
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 1 || limit > MaxListLimit {
+		return 0, fmt.Errorf("limit must be between 1 and %d", MaxListLimit)
+	}
+	return limit, nil
+}
+
+// ParseBefore - before query value in RFC3339, now when empty
+func ParseBefore(query url.Values) (time.Time, error) {
+	value := query.Get("before")
+	if value == "" {
+		return time.Now().UTC(), nil
+	}
+	before, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("before must be a RFC3339 timestamp: %w", err)
+	}
+	return before, nil
+}
@@ -0,0 +1,30 @@
+package deadletter_test
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/leetcode-golang-classroom/golang-async-api/internal/deadletter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLimit(t *testing.T) {
+	limit, err := deadletter.ParseLimit(url.Values{})
+	require.NoError(t, err)
+	assert.Equal(t, deadletter.DefaultListLimit, limit)
+	limit, err = deadletter.ParseLimit(url.Values{"limit": {"5"}})
+	require.NoError(t, err)
+	assert.Equal(t, 5, limit)
+	_, err = deadletter.ParseLimit(url.Values{"limit": {"1000"}})
+	require.Error(t, err)
+}
+
+func TestParseBefore(t *testing.T) {
+	before, err := deadletter.ParseBefore(url.Values{"before": {"2024-01-02T03:04:05Z"}})
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), before)
+	_, err = deadletter.ParseBefore(url.Values{"before": {"yesterday"}})
+	require.Error(t, err)
+}
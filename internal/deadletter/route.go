@@ -0,0 +1,227 @@
+package deadletter
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/helper"
+	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/queue"
+	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/response"
+	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/util"
+)
+
+// Handler - dead letters of the authenticated user, dead letters without a user are only reachable from the cli
+type Handler struct {
+	logger          *slog.Logger
+	deadLetterStore *DeadLetterStore
+	queue           queue.Queue
+	resetReport     ReportResetter
+}
+
+func NewHandler(logger *slog.Logger,
+	deadLetterStore *DeadLetterStore,
+	queue queue.Queue,
+	resetReport ReportResetter,
+) *Handler {
+	return &Handler{
+		logger:          logger,
+		deadLetterStore: deadLetterStore,
+		queue:           queue,
+		resetReport:     resetReport,
+	}
+}
+
+func (h *Handler) RegisterRoute(router *http.ServeMux) {
+	router.HandleFunc("GET /dead-letters", h.listDeadLettersHandler())
+	router.HandleFunc("DELETE /dead-letters", h.purgeDeadLettersHandler())
+	router.HandleFunc("GET /dead-letters/{id}", h.getDeadLetterHandler())
+	router.HandleFunc("DELETE /dead-letters/{id}", h.deleteDeadLetterHandler())
+	router.HandleFunc("POST /dead-letters/{id}/redrive", h.redriveDeadLetterHandler())
+}
+
+func (h *Handler) listDeadLettersHandler() http.HandlerFunc {
+	return helper.Handler(func(w http.ResponseWriter, r *http.Request) error {
+		limit, err := ParseLimit(r.URL.Query())
+		if err != nil {
+			return helper.NewErrWithStatus(
+				http.StatusBadRequest,
+				err,
+			)
+		}
+		user, ok := util.UserFromContext(r.Context())
+		if !ok {
+			return helper.NewErrWithStatus(
+				http.StatusUnauthorized,
+				fmt.Errorf("user not found in context"),
+			)
+		}
+		deadLetters, err := h.deadLetterStore.List(r.Context(), ListFilter{
+			UserID: &user.ID,
+			Limit:  limit,
+		})
+		if err != nil {
+			return helper.NewErrWithStatus(
+				http.StatusInternalServerError,
+				err,
+			)
+		}
+		resp := ListDeadLettersResponse{
+			DeadLetters: make([]ApiDeadLetter, 0, len(deadLetters)),
+		}
+		for i := range deadLetters {
+			resp.DeadLetters = append(resp.DeadLetters, NewApiDeadLetter(&deadLetters[i]))
+		}
+		if err := helper.Encode(response.ApiResponse[ListDeadLettersResponse]{
+			Data: &resp,
+		},
+			http.StatusOK,
+			w,
+		); err != nil {
+			return helper.NewErrWithStatus(
+				http.StatusInternalServerError,
+				err,
+			)
+		}
+		return nil
+	})
+}
+
+func (h *Handler) getDeadLetterHandler() http.HandlerFunc {
+	return helper.Handler(func(w http.ResponseWriter, r *http.Request) error {
+		id, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			return helper.NewErrWithStatus(
+				http.StatusBadRequest,
+				err,
+			)
+		}
+		user, ok := util.UserFromContext(r.Context())
+		if !ok {
+			return helper.NewErrWithStatus(
+				http.StatusUnauthorized,
+				fmt.Errorf("user not found in context"),
+			)
+		}
+		deadLetter, err := h.deadLetterStore.ByID(r.Context(), id, &user.ID)
+		if err != nil {
+			return notFoundOrInternal(err)
+		}
+		apiDeadLetter := NewApiDeadLetter(deadLetter)
+		if err := helper.Encode(response.ApiResponse[ApiDeadLetter]{
+			Data: &apiDeadLetter,
+		},
+			http.StatusOK,
+			w,
+		); err != nil {
+			return helper.NewErrWithStatus(
+				http.StatusInternalServerError,
+				err,
+			)
+		}
+		return nil
+	})
+}
+
+func (h *Handler) deleteDeadLetterHandler() http.HandlerFunc {
+	return helper.Handler(func(w http.ResponseWriter, r *http.Request) error {
+		id, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			return helper.NewErrWithStatus(
+				http.StatusBadRequest,
+				err,
+			)
+		}
+		user, ok := util.UserFromContext(r.Context())
+		if !ok {
+			return helper.NewErrWithStatus(
+				http.StatusUnauthorized,
+				fmt.Errorf("user not found in context"),
+			)
+		}
+		if err := h.deadLetterStore.Delete(r.Context(), id, &user.ID); err != nil {
+			return notFoundOrInternal(err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	})
+}
+
+// purgeDeadLettersHandler - delete the dead letters of the user created before the before query value
+func (h *Handler) purgeDeadLettersHandler() http.HandlerFunc {
+	return helper.Handler(func(w http.ResponseWriter, r *http.Request) error {
+		before, err := ParseBefore(r.URL.Query())
+		if err != nil {
+			return helper.NewErrWithStatus(
+				http.StatusBadRequest,
+				err,
+			)
+		}
+		user, ok := util.UserFromContext(r.Context())
+		if !ok {
+			return helper.NewErrWithStatus(
+				http.StatusUnauthorized,
+				fmt.Errorf("user not found in context"),
+			)
+		}
+		deleted, err := h.deadLetterStore.Purge(r.Context(), &user.ID, before)
+		if err != nil {
+			return helper.NewErrWithStatus(
+				http.StatusInternalServerError,
+				err,
+			)
+		}
+		if err := helper.Encode(response.ApiResponse[PurgeDeadLettersResponse]{
+			Data: &PurgeDeadLettersResponse{Deleted: deleted},
+		},
+			http.StatusOK,
+			w,
+		); err != nil {
+			return helper.NewErrWithStatus(
+				http.StatusInternalServerError,
+				err,
+			)
+		}
+		return nil
+	})
+}
+
+func (h *Handler) redriveDeadLetterHandler() http.HandlerFunc {
+	return helper.Handler(func(w http.ResponseWriter, r *http.Request) error {
+		id, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			return helper.NewErrWithStatus(
+				http.StatusBadRequest,
+				err,
+			)
+		}
+		user, ok := util.UserFromContext(r.Context())
+		if !ok {
+			return helper.NewErrWithStatus(
+				http.StatusUnauthorized,
+				fmt.Errorf("user not found in context"),
+			)
+		}
+		if err := h.deadLetterStore.Redrive(r.Context(), h.queue, h.resetReport, id, &user.ID); err != nil {
+			return notFoundOrInternal(err)
+		}
+		w.WriteHeader(http.StatusAccepted)
+		return nil
+	})
+}
+
+func notFoundOrInternal(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return helper.NewErrWithStatus(
+			http.StatusNotFound,
+			fmt.Errorf("dead letter not found"),
+		)
+	}
+	return helper.NewErrWithStatus(
+		http.StatusInternalServerError,
+		err,
+	)
+}
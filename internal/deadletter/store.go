@@ -0,0 +1,140 @@
+package deadletter
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/queue"
+	_ "github.com/lib/pq"
+)
+
+type DeadLetterStore struct {
+	db *sqlx.DB
+}
+
+func NewDeadLetterStore(db *sql.DB) *DeadLetterStore {
+	return &DeadLetterStore{
+		db: sqlx.NewDb(db, "postgres"),
+	}
+}
+
+// DeadLetter - queue message quarantined by the worker with the error of its last attempt,
+// UserID and ReportID are set when the body could be parsed
+type DeadLetter struct {
+	ID           uuid.UUID     `db:"id"`
+	Queue        string        `db:"queue"`
+	MessageID    string        `db:"message_id"`
+	Body         []byte        `db:"body"`
+	ErrorMessage string        `db:"error_message"`
+	ReceiveCount int           `db:"receive_count"`
+	UserID       uuid.NullUUID `db:"user_id"`
+	ReportID     uuid.NullUUID `db:"report_id"`
+	CreatedAt    time.Time     `db:"created_at"`
+}
+
+// ListFilter - UserID scopes the dead letters to one user, nil for every dead letter
+type ListFilter struct {
+	UserID *uuid.UUID
+	Limit  int
+}
+
+func nullUUID(id *uuid.UUID) uuid.NullUUID {
+	if id == nil {
+		return uuid.NullUUID{}
+	}
+	return uuid.NullUUID{UUID: *id, Valid: true}
+}
+
+func (s *DeadLetterStore) Create(ctx context.Context, deadLetter *DeadLetter) (*DeadLetter, error) {
+	const prepareStmt = `
+INSERT INTO dead_letters(queue, message_id, body, error_message, receive_count, user_id, report_id)
+VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING *;
+	`
+	var result DeadLetter
+	if err := s.db.GetContext(ctx, &result, prepareStmt, deadLetter.Queue, deadLetter.MessageID, deadLetter.Body,
+		deadLetter.ErrorMessage, deadLetter.ReceiveCount, deadLetter.UserID, deadLetter.ReportID); err != nil {
+		return nil, fmt.Errorf("failed to insert dead letter for message %s: %w", deadLetter.MessageID, err)
+	}
+	return &result, nil
+}
+
+// List - newest dead letters first
+func (s *DeadLetterStore) List(ctx context.Context, filter ListFilter) ([]DeadLetter, error) {
+	const prepareStmt = `
+SELECT * FROM dead_letters
+WHERE ($1::uuid IS NULL OR user_id = $1)
+ORDER BY created_at DESC, id DESC
+LIMIT $2;
+	`
+	var deadLetters []DeadLetter
+	if err := s.db.SelectContext(ctx, &deadLetters, prepareStmt, nullUUID(filter.UserID), filter.Limit); err != nil {
+		return nil, fmt.Errorf("failed to query dead letters: %w", err)
+	}
+	return deadLetters, nil
+}
+
+// ByID - dead letter of userID, any user when userID is nil
+func (s *DeadLetterStore) ByID(ctx context.Context, id uuid.UUID, userID *uuid.UUID) (*DeadLetter, error) {
+	const prepareStmt = `SELECT * FROM dead_letters WHERE id = $1 AND ($2::uuid IS NULL OR user_id = $2);`
+	var deadLetter DeadLetter
+	if err := s.db.GetContext(ctx, &deadLetter, prepareStmt, id, nullUUID(userID)); err != nil {
+		return nil, fmt.Errorf("failed to get dead letter %s: %w", id, err)
+	}
+	return &deadLetter, nil
+}
+
+// Delete - sql.ErrNoRows when the dead letter does not exist
+func (s *DeadLetterStore) Delete(ctx context.Context, id uuid.UUID, userID *uuid.UUID) error {
+	const prepareStmt = `DELETE FROM dead_letters WHERE id = $1 AND ($2::uuid IS NULL OR user_id = $2) RETURNING id;`
+	var deletedID uuid.UUID
+	if err := s.db.GetContext(ctx, &deletedID, prepareStmt, id, nullUUID(userID)); err != nil {
+		return fmt.Errorf("failed to delete dead letter %s: %w", id, err)
+	}
+	return nil
+}
+
+// Purge - delete dead letters created before, returns the number of deleted dead letters
+func (s *DeadLetterStore) Purge(ctx context.Context, userID *uuid.UUID, before time.Time) (int64, error) {
+	const prepareStmt = `DELETE FROM dead_letters WHERE ($1::uuid IS NULL OR user_id = $1) AND created_at < $2;`
+	result, err := s.db.ExecContext(ctx, prepareStmt, nullUUID(userID), before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge dead letters: %w", err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge dead letters: %w", err)
+	}
+	return deleted, nil
+}
+
+// ReportResetter - clear the failure of the report of a dead letter and enqueue it again,
+// sql.ErrNoRows when the report is not failed
+type ReportResetter func(ctx context.Context, userID uuid.UUID, reportID uuid.UUID) error
+
+// Redrive - build the report of the dead letter again and remove the dead letter, the dead letter is kept
+// when that fails. A failed report is reset by resetReport, which enqueues it, since a message of a failed
+// report would be skipped as done. Any other dead letter has its original body published again
+func (s *DeadLetterStore) Redrive(ctx context.Context, q queue.Queue, resetReport ReportResetter, id uuid.UUID, userID *uuid.UUID) error {
+	deadLetter, err := s.ByID(ctx, id, userID)
+	if err != nil {
+		return err
+	}
+	if resetReport != nil && deadLetter.UserID.Valid && deadLetter.ReportID.Valid {
+		err := resetReport(ctx, deadLetter.UserID.UUID, deadLetter.ReportID.UUID)
+		if err == nil {
+			return s.Delete(ctx, id, userID)
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("failed to redrive dead letter %s: %w", id, err)
+		}
+	}
+	if err := q.Publish(ctx, deadLetter.Body); err != nil {
+		return fmt.Errorf("failed to redrive dead letter %s: %w", id, err)
+	}
+	return s.Delete(ctx, id, userID)
+}
@@ -0,0 +1,119 @@
+package deadletter_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/google/uuid"
+	"github.com/leetcode-golang-classroom/golang-async-api/internal/deadletter"
+	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/config"
+	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/db"
+	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/queue"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func SetupDB(t *testing.T) (*sql.DB, *migrate.Migrate) {
+	t.Helper()
+	appConfig := config.AppConfig
+	appConfig.SetupEnv(config.Env_Dev)
+	dbURL := appConfig.DBURLTEST
+	db, err := db.Connect(dbURL)
+	require.NoError(t, err)
+
+	result := strings.Replace(appConfig.PROJECT_ROOT, "/internal/deadletter", "", 1)
+	m, err := migrate.New(
+		fmt.Sprintf("file://%s/migrations", result),
+		dbURL,
+	)
+	require.NoError(t, err)
+	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
+		require.NoError(t, err)
+	}
+	return db, m
+}
+
+func TestDeadLetterStore(t *testing.T) {
+	db, m := SetupDB(t)
+	defer db.Close()
+	ctx := context.Background()
+	deadLetterStore := deadletter.NewDeadLetterStore(db)
+	userID := uuid.New()
+
+	poison, err := deadLetterStore.Create(ctx, &deadletter.DeadLetter{
+		Queue:        "reports",
+		MessageID:    "1",
+		Body:         []byte("not json"),
+		ErrorMessage: "poison message: message body is invalid",
+		ReceiveCount: 1,
+	})
+	require.NoError(t, err)
+	failing, err := deadLetterStore.Create(ctx, &deadletter.DeadLetter{
+		Queue:        "reports",
+		MessageID:    "2",
+		Body:         []byte(`{"user_id":"` + userID.String() + `"}`),
+		ErrorMessage: "failed to build report",
+		ReceiveCount: 5,
+		UserID:       uuid.NullUUID{UUID: userID, Valid: true},
+	})
+	require.NoError(t, err)
+
+	all, err := deadLetterStore.List(ctx, deadletter.ListFilter{Limit: 10})
+	require.NoError(t, err)
+	assert.Len(t, all, 2)
+	mine, err := deadLetterStore.List(ctx, deadletter.ListFilter{UserID: &userID, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, mine, 1)
+	assert.Equal(t, failing.ID, mine[0].ID)
+
+	// dead letters of other users are not visible
+	_, err = deadLetterStore.ByID(ctx, poison.ID, &userID)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	q := queue.NewMemoryQueue(time.Minute)
+	require.NoError(t, deadLetterStore.Redrive(ctx, q, nil, failing.ID, &userID))
+	messages, err := q.Receive(ctx, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, messages, 1)
+	assert.Equal(t, failing.Body, messages[0].Body)
+	require.ErrorIs(t, deadLetterStore.Delete(ctx, failing.ID, nil), sql.ErrNoRows)
+
+	// a failed report is reset instead, its message is enqueued by the reset
+	reportID := uuid.New()
+	failedReport, err := deadLetterStore.Create(ctx, &deadletter.DeadLetter{
+		Queue:        "reports",
+		MessageID:    "3",
+		Body:         []byte(`{"user_id":"` + userID.String() + `","report_id":"` + reportID.String() + `"}`),
+		ErrorMessage: "failed to build report",
+		ReceiveCount: 5,
+		UserID:       uuid.NullUUID{UUID: userID, Valid: true},
+		ReportID:     uuid.NullUUID{UUID: reportID, Valid: true},
+	})
+	require.NoError(t, err)
+	var reset []uuid.UUID
+	resetReport := func(ctx context.Context, resetUserID uuid.UUID, resetReportID uuid.UUID) error {
+		assert.Equal(t, userID, resetUserID)
+		reset = append(reset, resetReportID)
+		return nil
+	}
+	require.NoError(t, deadLetterStore.Redrive(ctx, q, resetReport, failedReport.ID, &userID))
+	assert.Equal(t, []uuid.UUID{reportID}, reset)
+	messages, err = q.Receive(ctx, 10, 0)
+	require.NoError(t, err)
+	assert.Empty(t, messages)
+	require.ErrorIs(t, deadLetterStore.Delete(ctx, failedReport.ID, nil), sql.ErrNoRows)
+
+	deleted, err := deadLetterStore.Purge(ctx, nil, time.Now().UTC().Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+	if err := m.Down(); err != nil {
+		require.NoError(t, err)
+	}
+}
@@ -0,0 +1,73 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/config"
+)
+
+// Backend - implementation selected by config.Config.BlobBackend
+type Backend string
+
+const (
+	BackendS3    Backend = "s3"
+	BackendLocal Backend = "local"
+)
+
+// ErrNotFound - no object stored under the key
+var ErrNotFound = errors.New("blob not found")
+
+// PutOptions - metadata returned with the object on download
+type PutOptions struct {
+	ContentType     string `json:"content_type,omitempty"`
+	ContentEncoding string `json:"content_encoding,omitempty"`
+}
+
+// Object - stored object, Body has to be closed by the caller
+type Object struct {
+	Body io.ReadCloser
+	PutOptions
+}
+
+// BlobStore - storage of the generated report files
+type BlobStore interface {
+	// Put - store body under key, an existing object is replaced
+	Put(ctx context.Context, key string, body io.Reader, options PutOptions) error
+	// Get - object stored under key, ErrNotFound when missing
+	Get(ctx context.Context, key string) (*Object, error)
+	// Delete - remove the object, deleting a missing object is not an error
+	Delete(ctx context.Context, key string) error
+	// SignedURL - url that downloads the object without other credentials until expires has passed
+	SignedURL(ctx context.Context, key string, expires time.Duration) (string, error)
+}
+
+// New - blob store of the backend configured in appConfig, s3 when not set
+func New(ctx context.Context, appConfig *config.Config) (BlobStore, error) {
+	switch Backend(appConfig.BlobBackend) {
+	case "", BackendS3:
+		sdkConfig, err := awsconfig.LoadDefaultConfig(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load aws config: %w", err)
+		}
+		s3Client := s3.NewFromConfig(sdkConfig, func(options *s3.Options) {
+			options.BaseEndpoint = aws.String(appConfig.S3LocalstackEndPoint)
+			options.UsePathStyle = true
+		})
+		return NewS3Store(s3Client, appConfig.S3Bucket), nil
+	case BackendLocal:
+		secret := appConfig.BlobSigningSecret
+		if secret == "" {
+			return nil, fmt.Errorf("BLOB_SIGNING_SECRET is required for the %s blob backend", BackendLocal)
+		}
+		return NewLocalStore(appConfig.BlobLocalDir, appConfig.BlobBaseURL, []byte(secret))
+	}
+	return nil, fmt.Errorf("unknown blob backend %q, valid backends are: %s, %s",
+		appConfig.BlobBackend, BackendS3, BackendLocal)
+}
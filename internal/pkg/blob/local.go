@@ -0,0 +1,236 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/helper"
+	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/logger"
+)
+
+// DownloadPath - route prefix of the signed downloads served by LocalStore.DownloadHandler
+const DownloadPath = "/blobs/"
+
+var (
+	// ErrInvalidSignature - signed url was not issued by this store or was modified
+	ErrInvalidSignature = errors.New("invalid blob url signature")
+	// ErrURLExpired - signed url is past its expiry
+	ErrURLExpired = errors.New("blob url expired")
+)
+
+// LocalStore - blob store on the local disk, the api server serves downloads through HMAC signed urls.
+// Objects are kept under root/objects and their PutOptions under root/meta
+type LocalStore struct {
+	root    string
+	baseURL string
+	secret  []byte
+}
+
+func NewLocalStore(root string, baseURL string, secret []byte) (*LocalStore, error) {
+	if root == "" {
+		root = filepath.Join(os.TempDir(), "golang-async-api-blobs")
+	}
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create blob directory %s: %w", root, err)
+	}
+	return &LocalStore{
+		root:    root,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		secret:  secret,
+	}, nil
+}
+
+// normalizeKey - key relative to the store root, ".." segments can not leave the root
+func normalizeKey(key string) (string, error) {
+	normalized := strings.TrimPrefix(path.Clean("/"+key), "/")
+	if normalized == "" {
+		return "", fmt.Errorf("invalid blob key %q", key)
+	}
+	return normalized, nil
+}
+
+func (s *LocalStore) paths(key string) (string, string, error) {
+	normalized, err := normalizeKey(key)
+	if err != nil {
+		return "", "", err
+	}
+	relative := filepath.FromSlash(normalized)
+	return filepath.Join(s.root, "objects", relative), filepath.Join(s.root, "meta", relative+".json"), nil
+}
+
+func (s *LocalStore) Put(ctx context.Context, key string, body io.Reader, options PutOptions) error {
+	objectPath, metaPath, err := s.paths(key)
+	if err != nil {
+		return err
+	}
+	meta, err := json.Marshal(options)
+	if err != nil {
+		return fmt.Errorf("failed to marshal metadata of %s: %w", key, err)
+	}
+	if err := writeFile(metaPath, bytes.NewReader(meta)); err != nil {
+		return fmt.Errorf("failed to write metadata of %s: %w", key, err)
+	}
+	if err := writeFile(objectPath, body); err != nil {
+		return fmt.Errorf("failed to write %s: %w", key, err)
+	}
+	return nil
+}
+
+// writeFile - write through a temporary file so readers never see a partial object
+func writeFile(name string, body io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(filepath.Dir(name), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	if _, err := io.Copy(file, body); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), name)
+}
+
+func (s *LocalStore) Get(ctx context.Context, key string) (*Object, error) {
+	objectPath, metaPath, err := s.paths(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(objectPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("%s: %w", key, ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to open %s: %w", key, err)
+	}
+	object := &Object{Body: file}
+	meta, err := os.ReadFile(metaPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		file.Close()
+		return nil, fmt.Errorf("failed to read metadata of %s: %w", key, err)
+	}
+	if len(meta) > 0 {
+		if err := json.Unmarshal(meta, &object.PutOptions); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to unmarshal metadata of %s: %w", key, err)
+		}
+	}
+	return object, nil
+}
+
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	objectPath, metaPath, err := s.paths(key)
+	if err != nil {
+		return err
+	}
+	for _, name := range []string{objectPath, metaPath} {
+		if err := os.Remove(name); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to delete %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+func (s *LocalStore) SignedURL(ctx context.Context, key string, expires time.Duration) (string, error) {
+	normalized, err := normalizeKey(key)
+	if err != nil {
+		return "", err
+	}
+	expiresAt := time.Now().Add(expires).Unix()
+	segments := strings.Split(normalized, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	query := url.Values{
+		"expires":   []string{strconv.FormatInt(expiresAt, 10)},
+		"signature": []string{s.sign(normalized, expiresAt)},
+	}
+	return s.baseURL + DownloadPath + strings.Join(segments, "/") + "?" + query.Encode(), nil
+}
+
+func (s *LocalStore) sign(normalizedKey string, expiresAt int64) string {
+	mac := hmac.New(sha256.New, s.secret)
+	fmt.Fprintf(mac, "%s\n%d", normalizedKey, expiresAt)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify - check the expires and signature query values of a signed url for key
+func (s *LocalStore) Verify(key string, expires string, signature string) error {
+	normalized, err := normalizeKey(key)
+	if err != nil {
+		return err
+	}
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if !hmac.Equal([]byte(s.sign(normalized, expiresAt)), []byte(signature)) {
+		return ErrInvalidSignature
+	}
+	if time.Now().Unix() > expiresAt {
+		return ErrURLExpired
+	}
+	return nil
+}
+
+// DownloadHandler - serve objects for urls issued by SignedURL, registered as GET DownloadPath{key...}
+func (s *LocalStore) DownloadHandler() http.HandlerFunc {
+	return helper.Handler(func(w http.ResponseWriter, r *http.Request) error {
+		key := r.PathValue("key")
+		query := r.URL.Query()
+		if err := s.Verify(key, query.Get("expires"), query.Get("signature")); err != nil {
+			return helper.NewErrWithStatus(
+				http.StatusForbidden,
+				err,
+			)
+		}
+		object, err := s.Get(r.Context(), key)
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				return helper.NewErrWithStatus(
+					http.StatusNotFound,
+					err,
+				)
+			}
+			return helper.NewErrWithStatus(
+				http.StatusInternalServerError,
+				err,
+			)
+		}
+		defer object.Body.Close()
+		if object.ContentType != "" {
+			w.Header().Set("Content-Type", object.ContentType)
+		}
+		if object.ContentEncoding != "" {
+			w.Header().Set("Content-Encoding", object.ContentEncoding)
+		}
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", path.Base(key)))
+		w.WriteHeader(http.StatusOK)
+		// the file streams from disk, a client that disconnects mid download stops the copy here
+		if _, err := io.Copy(w, object.Body); err != nil {
+			logger.FromContext(r.Context()).ErrorContext(r.Context(), "failed to write blob", slog.String("key", key), slog.Any("err", err))
+		}
+		return nil
+	})
+}
@@ -0,0 +1,90 @@
+package blob_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/blob"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalStore(t *testing.T) {
+	ctx := context.Background()
+	store, err := blob.NewLocalStore(t.TempDir(), "http://localhost:8080", []byte("secret"))
+	require.NoError(t, err)
+
+	key := "/users/u1/report/r1.csv.gz"
+	require.NoError(t, store.Put(ctx, key, strings.NewReader("content"), blob.PutOptions{
+		ContentType:     "text/csv",
+		ContentEncoding: "gzip",
+	}))
+	object, err := store.Get(ctx, key)
+	require.NoError(t, err)
+	content, err := io.ReadAll(object.Body)
+	require.NoError(t, err)
+	require.NoError(t, object.Body.Close())
+	assert.Equal(t, "content", string(content))
+	assert.Equal(t, "text/csv", object.ContentType)
+	assert.Equal(t, "gzip", object.ContentEncoding)
+
+	// keys can not escape the store root
+	_, err = store.Get(ctx, "../../users/u1/report/r1.csv.gz")
+	require.NoError(t, err)
+
+	require.NoError(t, store.Delete(ctx, key))
+	_, err = store.Get(ctx, key)
+	require.ErrorIs(t, err, blob.ErrNotFound)
+	require.NoError(t, store.Delete(ctx, key))
+}
+
+func TestLocalStoreDownloadHandler(t *testing.T) {
+	ctx := context.Background()
+	store, err := blob.NewLocalStore(t.TempDir(), "http://localhost:8080/", []byte("secret"))
+	require.NoError(t, err)
+	key := "/users/u1/report/r1.csv"
+	require.NoError(t, store.Put(ctx, key, strings.NewReader("a,b\n"), blob.PutOptions{ContentType: "text/csv"}))
+
+	router := http.NewServeMux()
+	router.HandleFunc("GET "+blob.DownloadPath+"{key...}", store.DownloadHandler())
+	download := func(rawURL string) *httptest.ResponseRecorder {
+		parsed, err := url.Parse(rawURL)
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, parsed.RequestURI(), nil))
+		return recorder
+	}
+
+	signedURL, err := store.SignedURL(ctx, key, time.Minute)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(signedURL, "http://localhost:8080/blobs/users/u1/report/r1.csv?"))
+	recorder := download(signedURL)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "a,b\n", recorder.Body.String())
+	assert.Equal(t, "text/csv", recorder.Header().Get("Content-Type"))
+
+	t.Run("tampered key", func(t *testing.T) {
+		recorder := download(strings.Replace(signedURL, "r1.csv", "r2.csv", 1))
+		assert.Equal(t, http.StatusForbidden, recorder.Code)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		expiredURL, err := store.SignedURL(ctx, key, -time.Minute)
+		require.NoError(t, err)
+		recorder := download(expiredURL)
+		assert.Equal(t, http.StatusForbidden, recorder.Code)
+		require.ErrorIs(t, store.Verify(key, "0", "bad"), blob.ErrInvalidSignature)
+	})
+
+	t.Run("missing object", func(t *testing.T) {
+		require.NoError(t, store.Delete(ctx, key))
+		recorder := download(signedURL)
+		assert.Equal(t, http.StatusNotFound, recorder.Code)
+	})
+}
@@ -0,0 +1,90 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// S3Store - blob store backed by an s3 bucket, signed urls are s3 presigned urls
+type S3Store struct {
+	s3Client        *s3.Client
+	preSignedClient *s3.PresignClient
+	bucket          string
+}
+
+func NewS3Store(s3Client *s3.Client, bucket string) *S3Store {
+	return &S3Store{
+		s3Client:        s3Client,
+		preSignedClient: s3.NewPresignClient(s3Client),
+		bucket:          bucket,
+	}
+}
+
+func (s *S3Store) Put(ctx context.Context, key string, body io.Reader, options PutOptions) error {
+	putObjectInput := &s3.PutObjectInput{
+		Key:    aws.String(key),
+		Bucket: aws.String(s.bucket),
+		Body:   body,
+	}
+	if options.ContentType != "" {
+		putObjectInput.ContentType = aws.String(options.ContentType)
+	}
+	if options.ContentEncoding != "" {
+		putObjectInput.ContentEncoding = aws.String(options.ContentEncoding)
+	}
+	if _, err := s.s3Client.PutObject(ctx, putObjectInput); err != nil {
+		return fmt.Errorf("failed to upload %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *S3Store) Get(ctx context.Context, key string) (*Object, error) {
+	output, err := s.s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Key:    aws.String(key),
+		Bucket: aws.String(s.bucket),
+	})
+	if err != nil {
+		var noSuchKey *types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return nil, fmt.Errorf("%s: %w", key, ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to download %s: %w", key, err)
+	}
+	return &Object{
+		Body: output.Body,
+		PutOptions: PutOptions{
+			ContentType:     aws.ToString(output.ContentType),
+			ContentEncoding: aws.ToString(output.ContentEncoding),
+		},
+	}, nil
+}
+
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	if _, err := s.s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Key:    aws.String(key),
+		Bucket: aws.String(s.bucket),
+	}); err != nil {
+		return fmt.Errorf("failed to delete %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *S3Store) SignedURL(ctx context.Context, key string, expires time.Duration) (string, error) {
+	signedURL, err := s.preSignedClient.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	}, func(options *s3.PresignOptions) {
+		options.Expires = expires
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to presign %s: %w", key, err)
+	}
+	return signedURL.URL, nil
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"log"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -25,6 +26,38 @@ type Config struct {
 	LocalstackEndPoint   string `mapstructure:"LOCALSTACK_ENDPOINT"`
 	S3Bucket             string `mapstructure:"S3_BUCKET"`
 	SQSQueue             string `mapstructure:"SQS_QUEUE"`
+	// JWTSigningKeyFile - PEM encoded RSA or Ed25519 private key that signs tokens, HS256 with JWTSecret when empty
+	JWTSigningKeyFile string `mapstructure:"JWT_SIGNING_KEY_FILE"`
+	// JWTVerificationKeyFiles - comma separated PEM keys that are still accepted and published, for key rotation
+	JWTVerificationKeyFiles string `mapstructure:"JWT_VERIFICATION_KEY_FILES"`
+	// QueueBackend - sqs, postgres or memory, sqs when empty
+	QueueBackend string `mapstructure:"QUEUE_BACKEND"`
+	// BlobBackend - s3 or local, s3 when empty
+	BlobBackend string `mapstructure:"BLOB_BACKEND"`
+	// BlobLocalDir - root directory of the local blob backend
+	BlobLocalDir string `mapstructure:"BLOB_LOCAL_DIR"`
+	// BlobBaseURL - public url of the api server, prefix of local blob download urls
+	BlobBaseURL string `mapstructure:"BLOB_BASE_URL"`
+	// BlobSigningSecret - HMAC key of local blob download urls
+	BlobSigningSecret string `mapstructure:"BLOB_SIGNING_SECRET"`
+	// worker settings, validated and defaulted by Config.Worker,
+	// WorkerReceiveWaitTime is nil when unset since 0 selects short polling
+	WorkerConcurrency         int            `mapstructure:"WORKER_CONCURRENCY"`
+	WorkerBuildTimeout        time.Duration  `mapstructure:"WORKER_BUILD_TIMEOUT"`
+	WorkerBuildTimeouts       string         `mapstructure:"WORKER_BUILD_TIMEOUTS"`
+	WorkerReceiveWaitTime     *time.Duration `mapstructure:"WORKER_RECEIVE_WAIT_TIME"`
+	WorkerReceiveBatchSize    int            `mapstructure:"WORKER_RECEIVE_BATCH_SIZE"`
+	WorkerErrorBackoff        time.Duration  `mapstructure:"WORKER_ERROR_BACKOFF"`
+	WorkerMaxErrorBackoff     time.Duration  `mapstructure:"WORKER_MAX_ERROR_BACKOFF"`
+	WorkerShutdownGracePeriod time.Duration  `mapstructure:"WORKER_SHUTDOWN_GRACE_PERIOD"`
+	WorkerReuseWindow         time.Duration  `mapstructure:"WORKER_REUSE_WINDOW"`
+	WorkerMonstersCacheTTL    time.Duration  `mapstructure:"WORKER_MONSTERS_CACHE_TTL"`
+	WorkerLeaseDuration       time.Duration  `mapstructure:"WORKER_LEASE_DURATION"`
+	WorkerReaperInterval      time.Duration  `mapstructure:"WORKER_REAPER_INTERVAL"`
+	WorkerStaleLeaseAfter     time.Duration  `mapstructure:"WORKER_STALE_LEASE_AFTER"`
+	WorkerVisibilityTimeout   time.Duration  `mapstructure:"WORKER_VISIBILITY_TIMEOUT"`
+	// IdempotencyKeyTTL - how long an Idempotency-Key of POST /reports is remembered, 24h when empty
+	IdempotencyKeyTTL time.Duration `mapstructure:"IDEMPOTENCY_KEY_TTL"`
 }
 
 var AppConfig *Config
@@ -42,10 +75,32 @@ func init() {
 	FailOnError(v.BindEnv("PROJECT_ROOT"), "failed to bind PROJECT_ROOT")
 	FailOnError(v.BindEnv("JWT_SECRET"), "failed to bind JWT_SECRET")
 	FailOnError(v.BindEnv("JWT_SERVER_HOST"), "failed to bind JWT_SERVER_HOST")
+	FailOnError(v.BindEnv("JWT_SIGNING_KEY_FILE"), "failed to bind JWT_SIGNING_KEY_FILE")
+	FailOnError(v.BindEnv("JWT_VERIFICATION_KEY_FILES"), "failed to bind JWT_VERIFICATION_KEY_FILES")
 	FailOnError(v.BindEnv("S3_LOCALSTACK_ENDPOINT"), "faield to bind S3_LOCALSTACK_ENDPOINT")
 	FailOnError(v.BindEnv("LOCALSTACK_ENDPOINT"), "faield to bind LOCALSTACK_ENDPOINT")
 	FailOnError(v.BindEnv("S3_BUCKET"), "faield to bind S3_BUCKET")
 	FailOnError(v.BindEnv("SQS_QUEUE"), "faield to bind SQS_QUEUE")
+	FailOnError(v.BindEnv("QUEUE_BACKEND"), "failed to bind QUEUE_BACKEND")
+	FailOnError(v.BindEnv("BLOB_BACKEND"), "failed to bind BLOB_BACKEND")
+	FailOnError(v.BindEnv("BLOB_LOCAL_DIR"), "failed to bind BLOB_LOCAL_DIR")
+	FailOnError(v.BindEnv("BLOB_BASE_URL"), "failed to bind BLOB_BASE_URL")
+	FailOnError(v.BindEnv("BLOB_SIGNING_SECRET"), "failed to bind BLOB_SIGNING_SECRET")
+	FailOnError(v.BindEnv("WORKER_CONCURRENCY"), "failed to bind WORKER_CONCURRENCY")
+	FailOnError(v.BindEnv("WORKER_BUILD_TIMEOUT"), "failed to bind WORKER_BUILD_TIMEOUT")
+	FailOnError(v.BindEnv("WORKER_BUILD_TIMEOUTS"), "failed to bind WORKER_BUILD_TIMEOUTS")
+	FailOnError(v.BindEnv("WORKER_RECEIVE_WAIT_TIME"), "failed to bind WORKER_RECEIVE_WAIT_TIME")
+	FailOnError(v.BindEnv("WORKER_RECEIVE_BATCH_SIZE"), "failed to bind WORKER_RECEIVE_BATCH_SIZE")
+	FailOnError(v.BindEnv("WORKER_ERROR_BACKOFF"), "failed to bind WORKER_ERROR_BACKOFF")
+	FailOnError(v.BindEnv("WORKER_MAX_ERROR_BACKOFF"), "failed to bind WORKER_MAX_ERROR_BACKOFF")
+	FailOnError(v.BindEnv("WORKER_SHUTDOWN_GRACE_PERIOD"), "failed to bind WORKER_SHUTDOWN_GRACE_PERIOD")
+	FailOnError(v.BindEnv("WORKER_REUSE_WINDOW"), "failed to bind WORKER_REUSE_WINDOW")
+	FailOnError(v.BindEnv("WORKER_MONSTERS_CACHE_TTL"), "failed to bind WORKER_MONSTERS_CACHE_TTL")
+	FailOnError(v.BindEnv("WORKER_LEASE_DURATION"), "failed to bind WORKER_LEASE_DURATION")
+	FailOnError(v.BindEnv("WORKER_REAPER_INTERVAL"), "failed to bind WORKER_REAPER_INTERVAL")
+	FailOnError(v.BindEnv("WORKER_STALE_LEASE_AFTER"), "failed to bind WORKER_STALE_LEASE_AFTER")
+	FailOnError(v.BindEnv("WORKER_VISIBILITY_TIMEOUT"), "failed to bind WORKER_VISIBILITY_TIMEOUT")
+	FailOnError(v.BindEnv("IDEMPOTENCY_KEY_TTL"), "failed to bind IDEMPOTENCY_KEY_TTL")
 	err := v.ReadInConfig()
 	if err != nil {
 		log.Println("Load from environment variable")
@@ -0,0 +1,192 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultWorkerConcurrency         = 2
+	DefaultWorkerBuildTimeout        = 10 * time.Second
+	DefaultWorkerReceiveWaitTime     = 10 * time.Second
+	DefaultWorkerErrorBackoff        = time.Second
+	DefaultWorkerMaxErrorBackoff     = 30 * time.Second
+	DefaultWorkerShutdownGracePeriod = 30 * time.Second
+	DefaultWorkerReuseWindow         = 10 * time.Minute
+	DefaultWorkerMonstersCacheTTL    = 5 * time.Minute
+	DefaultWorkerLeaseDuration       = 30 * time.Second
+	DefaultWorkerReaperInterval      = 30 * time.Second
+	DefaultWorkerStaleLeaseAfter     = time.Minute
+	DefaultWorkerVisibilityTimeout   = 30 * time.Second
+	// MaxWorkerReceiveWaitTime - longest long poll sqs accepts
+	MaxWorkerReceiveWaitTime = 20 * time.Second
+	// MaxWorkerReceiveBatchSize - most messages sqs returns per receive
+	MaxWorkerReceiveBatchSize = 10
+	// MaxWorkerVisibilityTimeout - longest visibility timeout sqs accepts
+	MaxWorkerVisibilityTimeout = 12 * time.Hour
+	maxWorkerConcurrency       = 100
+)
+
+// BuildTimeouts - build timeout per report type, Default for report types without their own
+type BuildTimeouts struct {
+	Default      time.Duration
+	ByReportType map[string]time.Duration
+}
+
+// For - build timeout of reportType
+func (t BuildTimeouts) For(reportType string) time.Duration {
+	if timeout, ok := t.ByReportType[reportType]; ok {
+		return timeout
+	}
+	return t.Default
+}
+
+// WorkerConfig - validated worker settings
+type WorkerConfig struct {
+	Concurrency      int
+	BuildTimeouts    BuildTimeouts
+	ReceiveWaitTime  time.Duration
+	ReceiveBatchSize int
+	ErrorBackoff     time.Duration
+	MaxErrorBackoff  time.Duration
+	// ShutdownGracePeriod - how long in-flight builds may run once the worker is stopping
+	ShutdownGracePeriod time.Duration
+	// ReuseWindow - how old a completed report may be to be reused by a report requested with reuse
+	ReuseWindow time.Duration
+	// MonstersCacheTTL - how long fetched monsters are kept by the worker
+	MonstersCacheTTL time.Duration
+	// LeaseDuration - how long a claimed report belongs to a worker without renewal
+	LeaseDuration time.Duration
+	// ReaperInterval - how often the reaper looks for stale leases
+	ReaperInterval time.Duration
+	// StaleLeaseAfter - how long a lease has to be expired before the reaper acts
+	StaleLeaseAfter time.Duration
+	// VisibilityTimeout - how long a received message is hidden from other workers, renewed by the heartbeat
+	VisibilityTimeout time.Duration
+}
+
+// ParseBuildTimeouts - parse "report_type=duration" pairs separated by commas, e.g. "monsters=30s,equipment=1m"
+func ParseBuildTimeouts(value string) (map[string]time.Duration, error) {
+	timeouts := make(map[string]time.Duration)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		reportType, durationStr, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(reportType) == "" {
+			return nil, fmt.Errorf("invalid build timeout %q, expected report_type=duration", pair)
+		}
+		timeout, err := time.ParseDuration(strings.TrimSpace(durationStr))
+		if err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("invalid build timeout %q, expected a positive duration", pair)
+		}
+		timeouts[strings.TrimSpace(reportType)] = timeout
+	}
+	return timeouts, nil
+}
+
+// Worker - worker settings with defaults for unset values, error when a value is out of range
+func (c *Config) Worker() (WorkerConfig, error) {
+	workerConfig := WorkerConfig{
+		Concurrency: c.WorkerConcurrency,
+		BuildTimeouts: BuildTimeouts{
+			Default: c.WorkerBuildTimeout,
+		},
+		ReceiveWaitTime:     DefaultWorkerReceiveWaitTime,
+		ReceiveBatchSize:    c.WorkerReceiveBatchSize,
+		ErrorBackoff:        c.WorkerErrorBackoff,
+		MaxErrorBackoff:     c.WorkerMaxErrorBackoff,
+		ShutdownGracePeriod: c.WorkerShutdownGracePeriod,
+		ReuseWindow:         c.WorkerReuseWindow,
+		MonstersCacheTTL:    c.WorkerMonstersCacheTTL,
+		LeaseDuration:       c.WorkerLeaseDuration,
+		ReaperInterval:      c.WorkerReaperInterval,
+		StaleLeaseAfter:     c.WorkerStaleLeaseAfter,
+		VisibilityTimeout:   c.WorkerVisibilityTimeout,
+	}
+	if workerConfig.Concurrency == 0 {
+		workerConfig.Concurrency = DefaultWorkerConcurrency
+	}
+	if workerConfig.BuildTimeouts.Default == 0 {
+		workerConfig.BuildTimeouts.Default = DefaultWorkerBuildTimeout
+	}
+	if c.WorkerReceiveWaitTime != nil {
+		workerConfig.ReceiveWaitTime = *c.WorkerReceiveWaitTime
+	}
+	if workerConfig.ReceiveBatchSize == 0 {
+		workerConfig.ReceiveBatchSize = min(workerConfig.Concurrency, MaxWorkerReceiveBatchSize)
+	}
+	if workerConfig.ErrorBackoff == 0 {
+		workerConfig.ErrorBackoff = DefaultWorkerErrorBackoff
+	}
+	if workerConfig.MaxErrorBackoff == 0 {
+		workerConfig.MaxErrorBackoff = max(DefaultWorkerMaxErrorBackoff, workerConfig.ErrorBackoff)
+	}
+	if workerConfig.ShutdownGracePeriod == 0 {
+		workerConfig.ShutdownGracePeriod = DefaultWorkerShutdownGracePeriod
+	}
+	if workerConfig.ReuseWindow == 0 {
+		workerConfig.ReuseWindow = DefaultWorkerReuseWindow
+	}
+	if workerConfig.MonstersCacheTTL == 0 {
+		workerConfig.MonstersCacheTTL = DefaultWorkerMonstersCacheTTL
+	}
+	if workerConfig.LeaseDuration == 0 {
+		workerConfig.LeaseDuration = DefaultWorkerLeaseDuration
+	}
+	if workerConfig.ReaperInterval == 0 {
+		workerConfig.ReaperInterval = DefaultWorkerReaperInterval
+	}
+	if workerConfig.StaleLeaseAfter == 0 {
+		workerConfig.StaleLeaseAfter = DefaultWorkerStaleLeaseAfter
+	}
+	if workerConfig.VisibilityTimeout == 0 {
+		workerConfig.VisibilityTimeout = DefaultWorkerVisibilityTimeout
+	}
+	byReportType, err := ParseBuildTimeouts(c.WorkerBuildTimeouts)
+	if err != nil {
+		return WorkerConfig{}, fmt.Errorf("WORKER_BUILD_TIMEOUTS: %w", err)
+	}
+	workerConfig.BuildTimeouts.ByReportType = byReportType
+
+	switch {
+	case workerConfig.Concurrency < 1 || workerConfig.Concurrency > maxWorkerConcurrency:
+		return WorkerConfig{}, fmt.Errorf("WORKER_CONCURRENCY must be between 1 and %d", maxWorkerConcurrency)
+	case workerConfig.BuildTimeouts.Default < 0:
+		return WorkerConfig{}, fmt.Errorf("WORKER_BUILD_TIMEOUT must be positive")
+	case workerConfig.ReceiveWaitTime < 0 || workerConfig.ReceiveWaitTime > MaxWorkerReceiveWaitTime:
+		return WorkerConfig{}, fmt.Errorf("WORKER_RECEIVE_WAIT_TIME must be between 0 and %s", MaxWorkerReceiveWaitTime)
+	case workerConfig.ReceiveBatchSize < 1 || workerConfig.ReceiveBatchSize > MaxWorkerReceiveBatchSize:
+		return WorkerConfig{}, fmt.Errorf("WORKER_RECEIVE_BATCH_SIZE must be between 1 and %d", MaxWorkerReceiveBatchSize)
+	case workerConfig.ErrorBackoff < 0:
+		return WorkerConfig{}, fmt.Errorf("WORKER_ERROR_BACKOFF must be positive")
+	case workerConfig.ShutdownGracePeriod < 0:
+		return WorkerConfig{}, fmt.Errorf("WORKER_SHUTDOWN_GRACE_PERIOD must be positive")
+	case workerConfig.ReuseWindow < 0:
+		return WorkerConfig{}, fmt.Errorf("WORKER_REUSE_WINDOW must be positive")
+	case workerConfig.MonstersCacheTTL < 0:
+		return WorkerConfig{}, fmt.Errorf("WORKER_MONSTERS_CACHE_TTL must be positive")
+	case workerConfig.LeaseDuration < 0:
+		return WorkerConfig{}, fmt.Errorf("WORKER_LEASE_DURATION must be positive")
+	case workerConfig.ReaperInterval < 0:
+		return WorkerConfig{}, fmt.Errorf("WORKER_REAPER_INTERVAL must be positive")
+	case workerConfig.StaleLeaseAfter < 0:
+		return WorkerConfig{}, fmt.Errorf("WORKER_STALE_LEASE_AFTER must be positive")
+	case workerConfig.VisibilityTimeout < time.Second || workerConfig.VisibilityTimeout > MaxWorkerVisibilityTimeout:
+		return WorkerConfig{}, fmt.Errorf("WORKER_VISIBILITY_TIMEOUT must be between 1s and %s", MaxWorkerVisibilityTimeout)
+	case workerConfig.MaxErrorBackoff < workerConfig.ErrorBackoff:
+		return WorkerConfig{}, fmt.Errorf("WORKER_MAX_ERROR_BACKOFF must not be less than WORKER_ERROR_BACKOFF")
+	}
+	return workerConfig, nil
+}
+
+// NextErrorBackoff - delay after the consecutive receive error number attempt, doubled per error up to MaxErrorBackoff
+func (c WorkerConfig) NextErrorBackoff(attempt int) time.Duration {
+	backoff := c.ErrorBackoff
+	for i := 1; i < attempt && backoff < c.MaxErrorBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, c.MaxErrorBackoff)
+}
@@ -0,0 +1,80 @@
+package config_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkerConfig(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		workerConfig, err := (&config.Config{}).Worker()
+		require.NoError(t, err)
+		assert.Equal(t, config.DefaultWorkerConcurrency, workerConfig.Concurrency)
+		assert.Equal(t, config.DefaultWorkerBuildTimeout, workerConfig.BuildTimeouts.For("monsters"))
+		assert.Equal(t, config.DefaultWorkerReceiveWaitTime, workerConfig.ReceiveWaitTime)
+		assert.Equal(t, config.DefaultWorkerConcurrency, workerConfig.ReceiveBatchSize)
+		assert.Equal(t, config.DefaultWorkerShutdownGracePeriod, workerConfig.ShutdownGracePeriod)
+		assert.Equal(t, config.DefaultWorkerReuseWindow, workerConfig.ReuseWindow)
+		assert.Equal(t, config.DefaultWorkerMonstersCacheTTL, workerConfig.MonstersCacheTTL)
+		assert.Equal(t, config.DefaultWorkerLeaseDuration, workerConfig.LeaseDuration)
+		assert.Equal(t, config.DefaultWorkerReaperInterval, workerConfig.ReaperInterval)
+		assert.Equal(t, config.DefaultWorkerStaleLeaseAfter, workerConfig.StaleLeaseAfter)
+		assert.Equal(t, config.DefaultWorkerVisibilityTimeout, workerConfig.VisibilityTimeout)
+	})
+
+	t.Run("build timeout per report type", func(t *testing.T) {
+		workerConfig, err := (&config.Config{
+			WorkerBuildTimeout:  5 * time.Second,
+			WorkerBuildTimeouts: "monsters=30s, equipment=1m",
+		}).Worker()
+		require.NoError(t, err)
+		assert.Equal(t, 30*time.Second, workerConfig.BuildTimeouts.For("monsters"))
+		assert.Equal(t, time.Minute, workerConfig.BuildTimeouts.For("equipment"))
+		assert.Equal(t, 5*time.Second, workerConfig.BuildTimeouts.For("treasure"))
+	})
+
+	t.Run("short polling", func(t *testing.T) {
+		noWait := time.Duration(0)
+		workerConfig, err := (&config.Config{WorkerReceiveWaitTime: &noWait}).Worker()
+		require.NoError(t, err)
+		assert.Zero(t, workerConfig.ReceiveWaitTime)
+	})
+
+	longWait := time.Minute
+	invalid := map[string]config.Config{
+		"concurrency":    {WorkerConcurrency: -1},
+		"wait time":      {WorkerReceiveWaitTime: &longWait},
+		"batch size":     {WorkerReceiveBatchSize: 11},
+		"build timeouts": {WorkerBuildTimeouts: "monsters"},
+		"max backoff":    {WorkerErrorBackoff: time.Minute, WorkerMaxErrorBackoff: time.Second},
+		"grace period":   {WorkerShutdownGracePeriod: -time.Second},
+		"reuse window":   {WorkerReuseWindow: -time.Second},
+		"cache ttl":      {WorkerMonstersCacheTTL: -time.Second},
+		"lease duration": {WorkerLeaseDuration: -time.Second},
+		"reaper":         {WorkerReaperInterval: -time.Second},
+		"stale lease":    {WorkerStaleLeaseAfter: -time.Second},
+		"visibility":     {WorkerVisibilityTimeout: 500 * time.Millisecond},
+		"max visibility": {WorkerVisibilityTimeout: 13 * time.Hour},
+	}
+	for name, c := range invalid {
+		t.Run("invalid "+name, func(t *testing.T) {
+			_, err := c.Worker()
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestNextErrorBackoff(t *testing.T) {
+	workerConfig := config.WorkerConfig{
+		ErrorBackoff:    time.Second,
+		MaxErrorBackoff: 5 * time.Second,
+	}
+	assert.Equal(t, time.Second, workerConfig.NextErrorBackoff(1))
+	assert.Equal(t, 2*time.Second, workerConfig.NextErrorBackoff(2))
+	assert.Equal(t, 4*time.Second, workerConfig.NextErrorBackoff(3))
+	assert.Equal(t, 5*time.Second, workerConfig.NextErrorBackoff(10))
+}
@@ -11,6 +11,7 @@ import (
 
 type ErrWithStatus struct {
 	status int
+	code   string
 	err    error
 }
 
@@ -18,6 +19,11 @@ func NewErrWithStatus(status int, err error) *ErrWithStatus {
 	return &ErrWithStatus{status: status, err: err}
 }
 
+// NewErrWithCode - error whose code is sent along with the status text
+func NewErrWithCode(status int, code string, err error) *ErrWithStatus {
+	return &ErrWithStatus{status: status, code: code, err: err}
+}
+
 func (e *ErrWithStatus) Error() string {
 	return e.err.Error()
 }
@@ -29,10 +35,12 @@ func Handler(fn func(w http.ResponseWriter, r *http.Request) error) http.Handler
 		if err := fn(w, r); err != nil {
 			status := http.StatusInternalServerError
 			msg := http.StatusText(status)
+			var code string
 			if e, ok := err.(*ErrWithStatus); ok {
 				status = e.status
+				code = e.code
 				msg = http.StatusText(e.status)
-				if status == http.StatusBadRequest || status == http.StatusConflict {
+				if status == http.StatusBadRequest || status == http.StatusConflict || status == http.StatusUnprocessableEntity {
 					msg = e.err.Error()
 				}
 			}
@@ -47,6 +55,7 @@ func Handler(fn func(w http.ResponseWriter, r *http.Request) error) http.Handler
 			w.WriteHeader(status)
 			if err := json.NewEncoder(w).Encode(response.ApiResponse[struct{}]{
 				Message: msg,
+				Code:    code,
 			}); err != nil {
 				log.ErrorContext(r.Context(), "error encoding response", slog.Any("err", err))
 			}
@@ -9,10 +9,18 @@ import (
 	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/config"
 )
 
-var signingMethod = jwt.SigningMethodHS256
+// secretSigningMethod - method of tokens signed with JWTSecret, they carry no kid
+var secretSigningMethod = jwt.SigningMethodHS256
 
+// JWTManager - signs with the signing key when one is configured and with JWTSecret otherwise.
+// Tokens are verified with the key of their kid, tokens without kid with JWTSecret while it is
+// used for signing or still set after switching to a signing key
 type JWTManager struct {
-	config *config.Config
+	config     *config.Config
+	signingKey *Key
+	// verificationKeys - signing key and the keys of JWT_VERIFICATION_KEY_FILES by kid, keyIDs keeps their order
+	verificationKeys map[string]*Key
+	keyIDs           []string
 }
 
 type TokenPair struct {
@@ -22,73 +30,131 @@ type TokenPair struct {
 
 type CustomClaims struct {
 	TokenType string `json:"token_type"`
+	// TokenVersion - token version of the user at issue time, tokens of an older version are rejected
+	TokenVersion int `json:"ver"`
 	jwt.RegisteredClaims
 }
 
-func NewJWTManager(config *config.Config) *JWTManager {
-	return &JWTManager{
-		config: config,
+// NewJWTManager - load the keys of JWT_SIGNING_KEY_FILE and JWT_VERIFICATION_KEY_FILES. To rotate, publish the
+// new key as a verification key first, then make it the signing key and keep the old one as a verification
+// key until the tokens it signed expired
+func NewJWTManager(config *config.Config) (*JWTManager, error) {
+	jwtManager := &JWTManager{
+		config:           config,
+		verificationKeys: make(map[string]*Key),
 	}
+	if config.JWTSigningKeyFile != "" {
+		signingKey, err := LoadKey(config.JWTSigningKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("JWT_SIGNING_KEY_FILE: %w", err)
+		}
+		if signingKey.Private == nil {
+			return nil, fmt.Errorf("JWT_SIGNING_KEY_FILE: %s is not a private key", config.JWTSigningKeyFile)
+		}
+		jwtManager.signingKey = signingKey
+		jwtManager.addVerificationKey(signingKey)
+	}
+	verificationKeys, err := LoadKeys(config.JWTVerificationKeyFiles)
+	if err != nil {
+		return nil, fmt.Errorf("JWT_VERIFICATION_KEY_FILES: %w", err)
+	}
+	for _, key := range verificationKeys {
+		jwtManager.addVerificationKey(key)
+	}
+	return jwtManager, nil
+}
+
+func (jwtManager *JWTManager) addVerificationKey(key *Key) {
+	if _, ok := jwtManager.verificationKeys[key.ID]; ok {
+		return
+	}
+	jwtManager.verificationKeys[key.ID] = key
+	jwtManager.keyIDs = append(jwtManager.keyIDs, key.ID)
 }
 
 // Parse - parse token to token.Claim, so that the custom claim could load setup
 func (jwtManager *JWTManager) Parse(token string) (*jwt.Token, error) {
 	parser := jwt.NewParser()
-	jwtToken, err := parser.Parse(token, func(t *jwt.Token) (any, error) {
-		if t.Method != signingMethod {
+	jwtToken, err := parser.Parse(token, jwtManager.verificationKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse token: %w", err)
+	}
+	return jwtToken, nil
+}
+
+// verificationKey - key of the kid header, the method of the token has to match the key so that
+// a public key could never be used as an HMAC secret
+func (jwtManager *JWTManager) verificationKey(t *jwt.Token) (any, error) {
+	kid, _ := t.Header["kid"].(string)
+	if kid == "" {
+		secretAccepted := jwtManager.signingKey == nil || jwtManager.config.JWTSecret != ""
+		if t.Method != secretSigningMethod || !secretAccepted {
 			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
 		}
 		return []byte(jwtManager.config.JWTSecret), nil
-	})
+	}
+	key, ok := jwtManager.verificationKeys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id: %s", kid)
+	}
+	if t.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %v for key %s", t.Header["alg"], kid)
+	}
+	return key.Public, nil
+}
+
+// sign - sign claims with the signing key, or JWTSecret when there is none, and parse the result
+func (jwtManager *JWTManager) sign(claims CustomClaims) (*jwt.Token, error) {
+	var token *jwt.Token
+	var key any
+	if jwtManager.signingKey != nil {
+		token = jwt.NewWithClaims(jwtManager.signingKey.Method, claims)
+		token.Header["kid"] = jwtManager.signingKey.ID
+		key = jwtManager.signingKey.Private
+	} else {
+		token = jwt.NewWithClaims(secretSigningMethod, claims)
+		key = []byte(jwtManager.config.JWTSecret)
+	}
+	signed, err := token.SignedString(key)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse token: %w", err)
+		return nil, err
 	}
-	return jwtToken, nil
+	return jwtManager.Parse(signed)
 }
 
-// GenerateTokenPair - generate accessToken, refreshToken
-func (jwtManager *JWTManager) GenerateTokenPair(userID uuid.UUID) (*TokenPair, error) {
+// GenerateTokenPair - generate accessToken, refreshToken of the given token version, both carry a jti
+func (jwtManager *JWTManager) GenerateTokenPair(userID uuid.UUID, tokenVersion int) (*TokenPair, error) {
 	now := time.Now().UTC()
 	issuer := fmt.Sprintf("http://%s:%s", jwtManager.config.JWTServerHost, jwtManager.config.Port)
-	jwtAccessToken := jwt.NewWithClaims(signingMethod,
-		CustomClaims{
-			TokenType: "access",
-			RegisteredClaims: jwt.RegisteredClaims{
-				Subject:   userID.String(),
-				Issuer:    issuer,
-				ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute * 15)),
-				IssuedAt:  jwt.NewNumericDate(now),
-			},
-		})
-
-	key := []byte(jwtManager.config.JWTSecret)
-	signedAccessToken, err := jwtAccessToken.SignedString(key)
+	accessToken, err := jwtManager.sign(CustomClaims{
+		TokenType:    "access",
+		TokenVersion: tokenVersion,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			Subject:   userID.String(),
+			Issuer:    issuer,
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute * 15)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to sign access token: %w", err)
 	}
-	accessToken, err := jwtManager.Parse(signedAccessToken)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse access token: %w", err)
-	}
-
-	jwtRefreshToken := jwt.NewWithClaims(signingMethod,
-		CustomClaims{
-			TokenType: "refresh",
-			RegisteredClaims: jwt.RegisteredClaims{
-				Subject:   userID.String(),
-				Issuer:    issuer,
-				ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour * 24 * 30)),
-				IssuedAt:  jwt.NewNumericDate(now),
-			},
-		})
-	signedRefreshToken, err := jwtRefreshToken.SignedString(key)
+
+	refreshToken, err := jwtManager.sign(CustomClaims{
+		TokenType:    "refresh",
+		TokenVersion: tokenVersion,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			Subject:   userID.String(),
+			Issuer:    issuer,
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour * 24 * 30)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to sign refresh token: %w", err)
 	}
-	refreshToken, err := jwtManager.Parse(signedRefreshToken)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse refresh token: %w", err)
-	}
 
 	return &TokenPair{
 		AccessToken:  accessToken,
@@ -108,3 +174,34 @@ func (jwtManager *JWTManager) IsAccessToken(token *jwt.Token) bool {
 	}
 	return false
 }
+
+// TokenID - jti claim of token
+func TokenID(token *jwt.Token) (string, error) {
+	jwtClaims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return "", fmt.Errorf("unexpected claims type %T", token.Claims)
+	}
+	id, ok := jwtClaims["jti"].(string)
+	if !ok || id == "" {
+		return "", fmt.Errorf("token has no jti claim")
+	}
+	return id, nil
+}
+
+// TokenVersion - ver claim of token, tokens issued before the claim existed are version 0
+func TokenVersion(token *jwt.Token) (int, error) {
+	jwtClaims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return 0, fmt.Errorf("unexpected claims type %T", token.Claims)
+	}
+	version, ok := jwtClaims["ver"]
+	if !ok {
+		return 0, nil
+	}
+	// numbers of map claims are decoded as float64
+	parsed, ok := version.(float64)
+	if !ok {
+		return 0, fmt.Errorf("ver claim is not a number")
+	}
+	return int(parsed), nil
+}
@@ -1,21 +1,30 @@
 package jwt_test
 
 import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
 	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/google/uuid"
 	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/config"
 	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/jwt"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
 func TestJWTManager(t *testing.T) {
 	resultConfig := config.AppConfig
 
-	jwtManager := jwt.NewJWTManager(resultConfig)
+	jwtManager, err := jwt.NewJWTManager(resultConfig)
+	require.NoError(t, err)
 	userID := uuid.New()
-	tokenPair, err := jwtManager.GenerateTokenPair(userID)
+	tokenPair, err := jwtManager.GenerateTokenPair(userID, 3)
 	require.NoError(t, err)
 
 	require.True(t, jwtManager.IsAccessToken(tokenPair.AccessToken))
@@ -44,4 +53,74 @@ func TestJWTManager(t *testing.T) {
 	parsedRefreshToken, err := jwtManager.Parse(tokenPair.RefreshToken.Raw)
 	require.NoError(t, err)
 	require.Equal(t, tokenPair.RefreshToken.Raw, parsedRefreshToken.Raw)
+
+	accessTokenID, err := jwt.TokenID(parsedAccessToken)
+	require.NoError(t, err)
+	refreshTokenID, err := jwt.TokenID(parsedRefreshToken)
+	require.NoError(t, err)
+	require.NotEqual(t, accessTokenID, refreshTokenID)
+	accessTokenVersion, err := jwt.TokenVersion(parsedAccessToken)
+	require.NoError(t, err)
+	require.Equal(t, 3, accessTokenVersion)
+}
+
+func writePEM(t *testing.T, path string, blockType string, der []byte) string {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600))
+	return path
+}
+
+func TestJWTManagerKeyRotation(t *testing.T) {
+	dir := t.TempDir()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	rsaDER, err := x509.MarshalPKCS8PrivateKey(rsaKey)
+	require.NoError(t, err)
+	rsaPublicDER, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	edDER, err := x509.MarshalPKCS8PrivateKey(edKey)
+	require.NoError(t, err)
+
+	oldConfig := *config.AppConfig
+	oldConfig.JWTSecret = ""
+	oldConfig.JWTSigningKeyFile = writePEM(t, filepath.Join(dir, "rsa.pem"), "PRIVATE KEY", rsaDER)
+	oldManager, err := jwt.NewJWTManager(&oldConfig)
+	require.NoError(t, err)
+	oldPair, err := oldManager.GenerateTokenPair(uuid.New(), 0)
+	require.NoError(t, err)
+	assert.Equal(t, "RS256", oldPair.AccessToken.Method.Alg())
+	oldKeys := oldManager.JWKS().Keys
+	require.Len(t, oldKeys, 1)
+	assert.Equal(t, "RSA", oldKeys[0].Kty)
+	assert.Equal(t, oldKeys[0].Kid, oldPair.AccessToken.Header["kid"])
+
+	// the new ed25519 key signs, the old public key still verifies
+	newConfig := oldConfig
+	newConfig.JWTSigningKeyFile = writePEM(t, filepath.Join(dir, "ed25519.pem"), "PRIVATE KEY", edDER)
+	newConfig.JWTVerificationKeyFiles = writePEM(t, filepath.Join(dir, "rsa.pub.pem"), "PUBLIC KEY", rsaPublicDER)
+	newManager, err := jwt.NewJWTManager(&newConfig)
+	require.NoError(t, err)
+	newPair, err := newManager.GenerateTokenPair(uuid.New(), 0)
+	require.NoError(t, err)
+	assert.Equal(t, "EdDSA", newPair.AccessToken.Method.Alg())
+	_, err = newManager.Parse(oldPair.AccessToken.Raw)
+	require.NoError(t, err)
+	newKeys := newManager.JWKS().Keys
+	require.Len(t, newKeys, 2)
+	assert.Equal(t, "OKP", newKeys[0].Kty)
+	assert.Equal(t, oldKeys[0], newKeys[1])
+
+	_, err = oldManager.Parse(newPair.AccessToken.Raw)
+	require.Error(t, err)
+	// tokens signed with the secret are rejected once a signing key replaced it
+	secretConfig := *config.AppConfig
+	secretConfig.JWTSecret = "secret"
+	secretManager, err := jwt.NewJWTManager(&secretConfig)
+	require.NoError(t, err)
+	secretPair, err := secretManager.GenerateTokenPair(uuid.New(), 0)
+	require.NoError(t, err)
+	_, err = newManager.Parse(secretPair.AccessToken.Raw)
+	require.Error(t, err)
 }
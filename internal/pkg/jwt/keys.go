@@ -0,0 +1,157 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/logger"
+)
+
+// JWKSPath - where the public verification keys are published
+const JWKSPath = "/.well-known/jwks.json"
+
+// Key - asymmetric key identified by kid, Private is nil for keys that only verify
+type Key struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Private crypto.PrivateKey
+	Public  crypto.PublicKey
+}
+
+// LoadKey - read a PEM encoded RSA or Ed25519 key, private keys could sign and verify, public keys only verify.
+// The kid is the RFC 7638 thumbprint of the public key, so every instance derives the same id
+func LoadKey(path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file %s: %w", path, err)
+	}
+	key := &Key{}
+	if private, err := jwt.ParseRSAPrivateKeyFromPEM(data); err == nil {
+		key.Method, key.Private, key.Public = jwt.SigningMethodRS256, private, &private.PublicKey
+	} else if private, err := jwt.ParseEdPrivateKeyFromPEM(data); err == nil {
+		key.Method, key.Private, key.Public = jwt.SigningMethodEdDSA, private, private.(ed25519.PrivateKey).Public()
+	} else if public, err := jwt.ParseRSAPublicKeyFromPEM(data); err == nil {
+		key.Method, key.Public = jwt.SigningMethodRS256, public
+	} else if public, err := jwt.ParseEdPublicKeyFromPEM(data); err == nil {
+		key.Method, key.Public = jwt.SigningMethodEdDSA, public
+	} else {
+		return nil, fmt.Errorf("key file %s is not a PEM encoded RSA or Ed25519 key", path)
+	}
+	if key.ID, err = thumbprint(key.JWK()); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// LoadKeys - LoadKey for each path of a comma separated list, empty entries are skipped
+func LoadKeys(paths string) ([]*Key, error) {
+	var keys []*Key
+	for _, path := range strings.Split(paths, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		key, err := LoadKey(path)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// JWK - public part of a key as a JSON Web Key
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+func (k *Key) JWK() JWK {
+	jwk := JWK{
+		Kid: k.ID,
+		Use: "sig",
+		Alg: k.Method.Alg(),
+	}
+	switch public := k.Public.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(public)
+	}
+	return jwk
+}
+
+// thumbprint - RFC 7638 thumbprint, the sha256 of the required members in lexicographic order
+func thumbprint(jwk JWK) (string, error) {
+	var members any
+	switch jwk.Kty {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N}
+	case "OKP":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X}
+	default:
+		return "", fmt.Errorf("unsupported key type %q", jwk.Kty)
+	}
+	data, err := json.Marshal(members)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal jwk: %w", err)
+	}
+	hash := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(hash[:]), nil
+}
+
+// JWKS - public keys of the signing and verification keys, the HS256 secret is never published
+func (jwtManager *JWTManager) JWKS() JWKS {
+	jwks := JWKS{Keys: make([]JWK, 0, len(jwtManager.keyIDs))}
+	for _, kid := range jwtManager.keyIDs {
+		jwks.Keys = append(jwks.Keys, jwtManager.verificationKeys[kid].JWK())
+	}
+	return jwks
+}
+
+// JWKSHandler - serve JWKS so other services could verify access tokens without the signing key
+func (jwtManager *JWTManager) JWKSHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		// verifiers refetch on an unknown kid, a short max-age keeps rotations quick
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		if err := json.NewEncoder(w).Encode(jwtManager.JWKS()); err != nil {
+			logger.FromContext(r.Context()).ErrorContext(r.Context(), "failed to write jwks", slog.Any("err", err))
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+// Heartbeat - extend the visibility of message by timeout every interval until the returned stop is called,
+// stop waits for the heartbeat to end so no extension races with an ack of the message
+func Heartbeat(ctx context.Context, q Queue, message Message, timeout time.Duration, interval time.Duration, logger *slog.Logger) (stop func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				err := q.ExtendVisibility(ctx, message, timeout)
+				if err == nil || ctx.Err() != nil {
+					continue
+				}
+				if errors.Is(err, ErrMessageNotFound) {
+					logger.WarnContext(ctx, "message is no longer owned by this receiver, heartbeat stopped",
+						slog.String("message_id", message.ID))
+					return
+				}
+				logger.WarnContext(ctx, "failed to extend message visibility", slog.String("message_id", message.ID),
+					slog.Any("error", err))
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
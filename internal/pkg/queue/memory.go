@@ -0,0 +1,112 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// memoryPollInterval - how often an empty queue is checked again while Receive waits
+const memoryPollInterval = 10 * time.Millisecond
+
+// MemoryQueue - in process queue for tests, messages are lost on restart and not shared between processes
+type MemoryQueue struct {
+	visibilityTimeout time.Duration
+	mu                sync.Mutex
+	nextID            int
+	messages          []*memoryMessage
+}
+
+type memoryMessage struct {
+	Message
+	visibleAt time.Time
+}
+
+func NewMemoryQueue(visibilityTimeout time.Duration) *MemoryQueue {
+	return &MemoryQueue{
+		visibilityTimeout: visibilityTimeout,
+	}
+}
+
+func (q *MemoryQueue) Publish(ctx context.Context, body []byte) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.nextID++
+	q.messages = append(q.messages, &memoryMessage{
+		Message: Message{
+			ID:   strconv.Itoa(q.nextID),
+			Body: append([]byte(nil), body...),
+		},
+		visibleAt: time.Now(),
+	})
+	return nil
+}
+
+func (q *MemoryQueue) Receive(ctx context.Context, maxMessages int, waitTime time.Duration) ([]Message, error) {
+	deadline := time.Now().Add(waitTime)
+	for {
+		if messages := q.receive(maxMessages); len(messages) > 0 || !time.Now().Before(deadline) {
+			return messages, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(min(memoryPollInterval, time.Until(deadline))):
+		}
+	}
+}
+
+func (q *MemoryQueue) receive(maxMessages int) []Message {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	now := time.Now()
+	var messages []Message
+	for _, message := range q.messages {
+		if len(messages) >= maxMessages {
+			break
+		}
+		if message.visibleAt.After(now) {
+			continue
+		}
+		message.visibleAt = now.Add(q.visibilityTimeout)
+		message.ReceiveCount++
+		message.ReceiptHandle = uuid.NewString()
+		messages = append(messages, message.Message)
+	}
+	return messages
+}
+
+func (q *MemoryQueue) Ack(ctx context.Context, message Message) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, m := range q.messages {
+		if m.ID == message.ID && m.ReceiptHandle == message.ReceiptHandle {
+			q.messages = append(q.messages[:i], q.messages[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("message %s: %w", message.ID, ErrMessageNotFound)
+}
+
+func (q *MemoryQueue) ExtendVisibility(ctx context.Context, message Message, timeout time.Duration) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, m := range q.messages {
+		if m.ID == message.ID && m.ReceiptHandle == message.ReceiptHandle {
+			m.visibleAt = time.Now().Add(timeout)
+			return nil
+		}
+	}
+	return fmt.Errorf("message %s: %w", message.ID, ErrMessageNotFound)
+}
+
+// Len - messages not acked yet
+func (q *MemoryQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.messages)
+}
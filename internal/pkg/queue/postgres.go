@@ -0,0 +1,122 @@
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// postgresPollInterval - how often an empty jobs table is checked again while Receive waits
+const postgresPollInterval = 250 * time.Millisecond
+
+// PostgresQueue - queue backed by the jobs table, receivers lock rows with FOR UPDATE SKIP LOCKED
+// so that concurrent workers never get the same visible job
+type PostgresQueue struct {
+	db                *sqlx.DB
+	name              string
+	visibilityTimeout time.Duration
+}
+
+type job struct {
+	ID            int64  `db:"id"`
+	Body          []byte `db:"body"`
+	ReceiptHandle string `db:"receipt_handle"`
+	ReceiveCount  int    `db:"receive_count"`
+}
+
+func NewPostgresQueue(db *sql.DB, name string, visibilityTimeout time.Duration) *PostgresQueue {
+	return &PostgresQueue{
+		db:                sqlx.NewDb(db, "postgres"),
+		name:              name,
+		visibilityTimeout: visibilityTimeout,
+	}
+}
+
+func (q *PostgresQueue) Publish(ctx context.Context, body []byte) error {
+	const prepareStmt = `INSERT INTO jobs(queue, body) VALUES ($1, $2);`
+	if _, err := q.db.ExecContext(ctx, prepareStmt, q.name, body); err != nil {
+		return fmt.Errorf("failed to insert job into queue %s: %w", q.name, err)
+	}
+	return nil
+}
+
+func (q *PostgresQueue) Receive(ctx context.Context, maxMessages int, waitTime time.Duration) ([]Message, error) {
+	deadline := time.Now().Add(waitTime)
+	for {
+		messages, err := q.receive(ctx, maxMessages)
+		if err != nil || len(messages) > 0 || !time.Now().Before(deadline) {
+			return messages, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(min(postgresPollInterval, time.Until(deadline))):
+		}
+	}
+}
+
+func (q *PostgresQueue) receive(ctx context.Context, maxMessages int) ([]Message, error) {
+	const prepareStmt = `
+UPDATE jobs
+SET visible_at = $3,
+    receive_count = receive_count + 1,
+    receipt_handle = gen_random_uuid()
+WHERE id IN (
+  SELECT id FROM jobs
+  WHERE queue = $1 AND visible_at <= $2
+  ORDER BY visible_at, id
+  LIMIT $4
+  FOR UPDATE SKIP LOCKED
+)
+RETURNING id, body, receipt_handle, receive_count;
+	`
+	now := time.Now().UTC()
+	var jobs []job
+	if err := q.db.SelectContext(ctx, &jobs, prepareStmt, q.name, now, now.Add(q.visibilityTimeout), maxMessages); err != nil {
+		return nil, fmt.Errorf("failed to receive jobs from queue %s: %w", q.name, err)
+	}
+	messages := make([]Message, 0, len(jobs))
+	for _, job := range jobs {
+		messages = append(messages, Message{
+			ID:            strconv.FormatInt(job.ID, 10),
+			Body:          job.Body,
+			ReceiptHandle: job.ReceiptHandle,
+			ReceiveCount:  job.ReceiveCount,
+		})
+	}
+	return messages, nil
+}
+
+func (q *PostgresQueue) Ack(ctx context.Context, message Message) error {
+	const prepareStmt = `DELETE FROM jobs WHERE id = $1 AND receipt_handle = $2;`
+	return q.execByReceipt(ctx, prepareStmt, message)
+}
+
+func (q *PostgresQueue) ExtendVisibility(ctx context.Context, message Message, timeout time.Duration) error {
+	const prepareStmt = `UPDATE jobs SET visible_at = $3 WHERE id = $1 AND receipt_handle = $2;`
+	return q.execByReceipt(ctx, prepareStmt, message, time.Now().UTC().Add(timeout))
+}
+
+// execByReceipt - run stmt for the delivery of message, ErrMessageNotFound when another consumer received it since
+func (q *PostgresQueue) execByReceipt(ctx context.Context, stmt string, message Message, args ...any) error {
+	id, err := strconv.ParseInt(message.ID, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid job id %q: %w", message.ID, err)
+	}
+	result, err := q.db.ExecContext(ctx, stmt, append([]any{id, message.ReceiptHandle}, args...)...)
+	if err != nil {
+		return fmt.Errorf("failed to update job %s of queue %s: %w", message.ID, q.name, err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to update job %s of queue %s: %w", message.ID, q.name, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("job %s of queue %s: %w", message.ID, q.name, ErrMessageNotFound)
+	}
+	return nil
+}
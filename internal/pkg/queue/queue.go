@@ -0,0 +1,68 @@
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/config"
+)
+
+// Backend - implementation selected by config.Config.QueueBackend
+type Backend string
+
+const (
+	BackendSQS      Backend = "sqs"
+	BackendPostgres Backend = "postgres"
+	BackendMemory   Backend = "memory"
+)
+
+// ErrMessageNotFound - the message was acked or its receipt handle is no longer valid
+var ErrMessageNotFound = errors.New("queue message not found")
+
+// Message - message received from a queue, ReceiptHandle identifies this delivery for Ack and ExtendVisibility
+type Message struct {
+	ID            string
+	Body          []byte
+	ReceiptHandle string
+	ReceiveCount  int
+}
+
+// Queue - job queue between the api server and the workers, delivery is at least once
+type Queue interface {
+	// Publish - send body to the queue
+	Publish(ctx context.Context, body []byte) error
+	// Receive - up to maxMessages messages, waits at most waitTime when the queue is empty
+	Receive(ctx context.Context, maxMessages int, waitTime time.Duration) ([]Message, error)
+	// Ack - remove a processed message from the queue
+	Ack(ctx context.Context, message Message) error
+	// ExtendVisibility - keep the message hidden from other consumers for timeout from now
+	ExtendVisibility(ctx context.Context, message Message, timeout time.Duration) error
+}
+
+// New - queue of the backend configured in appConfig, sqs when not set,
+// received messages are hidden from other consumers for visibilityTimeout
+func New(ctx context.Context, appConfig *config.Config, db *sql.DB, visibilityTimeout time.Duration) (Queue, error) {
+	switch Backend(appConfig.QueueBackend) {
+	case "", BackendSQS:
+		sdkConfig, err := awsconfig.LoadDefaultConfig(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load aws config: %w", err)
+		}
+		sqsClient := sqs.NewFromConfig(sdkConfig, func(options *sqs.Options) {
+			options.BaseEndpoint = aws.String(appConfig.LocalstackEndPoint)
+		})
+		return NewSQSQueue(sqsClient, appConfig.SQSQueue, visibilityTimeout), nil
+	case BackendPostgres:
+		return NewPostgresQueue(db, appConfig.SQSQueue, visibilityTimeout), nil
+	case BackendMemory:
+		return NewMemoryQueue(visibilityTimeout), nil
+	}
+	return nil, fmt.Errorf("unknown queue backend %q, valid backends are: %s, %s, %s",
+		appConfig.QueueBackend, BackendSQS, BackendPostgres, BackendMemory)
+}
@@ -0,0 +1,139 @@
+package queue_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/config"
+	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/db"
+	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/queue"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func SetupDB(t *testing.T) (*sql.DB, *migrate.Migrate) {
+	t.Helper()
+	appConfig := config.AppConfig
+	appConfig.SetupEnv(config.Env_Dev)
+	dbURL := appConfig.DBURLTEST
+	db, err := db.Connect(dbURL)
+	require.NoError(t, err)
+
+	result := strings.Replace(appConfig.PROJECT_ROOT, "/internal/pkg/queue", "", 1)
+	m, err := migrate.New(
+		fmt.Sprintf("file://%s/migrations", result),
+		dbURL,
+	)
+	require.NoError(t, err)
+	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
+		require.NoError(t, err)
+	}
+	return db, m
+}
+
+// testQueue - behaviour every backend has to provide, q must use a visibility timeout of 50ms
+func testQueue(t *testing.T, q queue.Queue) {
+	t.Helper()
+	ctx := context.Background()
+	messages, err := q.Receive(ctx, 10, 0)
+	require.NoError(t, err)
+	assert.Empty(t, messages)
+
+	require.NoError(t, q.Publish(ctx, []byte(`{"id":1}`)))
+	require.NoError(t, q.Publish(ctx, []byte(`{"id":2}`)))
+
+	messages, err = q.Receive(ctx, 1, time.Second)
+	require.NoError(t, err)
+	require.Len(t, messages, 1)
+	first := messages[0]
+	assert.Equal(t, `{"id":1}`, string(first.Body))
+	assert.Equal(t, 1, first.ReceiveCount)
+
+	// a received message is hidden from other receivers until the visibility timeout
+	messages, err = q.Receive(ctx, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, messages, 1)
+	assert.Equal(t, `{"id":2}`, string(messages[0].Body))
+	require.NoError(t, q.Ack(ctx, messages[0]))
+
+	time.Sleep(100 * time.Millisecond)
+	messages, err = q.Receive(ctx, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, messages, 1)
+	redelivered := messages[0]
+	assert.Equal(t, first.ID, redelivered.ID)
+	assert.Equal(t, 2, redelivered.ReceiveCount)
+
+	// the receipt handle of the first delivery is no longer valid
+	require.ErrorIs(t, q.Ack(ctx, first), queue.ErrMessageNotFound)
+	require.NoError(t, q.ExtendVisibility(ctx, redelivered, time.Minute))
+	time.Sleep(100 * time.Millisecond)
+	messages, err = q.Receive(ctx, 10, 0)
+	require.NoError(t, err)
+	assert.Empty(t, messages)
+	require.NoError(t, q.Ack(ctx, redelivered))
+	require.ErrorIs(t, q.ExtendVisibility(ctx, redelivered, time.Minute), queue.ErrMessageNotFound)
+}
+
+func TestMemoryQueue(t *testing.T) {
+	testQueue(t, queue.NewMemoryQueue(50*time.Millisecond))
+}
+
+func TestMemoryQueueReceiveWait(t *testing.T) {
+	q := queue.NewMemoryQueue(time.Minute)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		q.Publish(context.Background(), []byte("late"))
+	}()
+	messages, err := q.Receive(context.Background(), 1, time.Second)
+	require.NoError(t, err)
+	require.Len(t, messages, 1)
+	assert.Equal(t, "late", string(messages[0].Body))
+}
+
+func TestNew(t *testing.T) {
+	q, err := queue.New(context.Background(), &config.Config{QueueBackend: "memory"}, nil, time.Minute)
+	require.NoError(t, err)
+	assert.IsType(t, &queue.MemoryQueue{}, q)
+	_, err = queue.New(context.Background(), &config.Config{QueueBackend: "kafka"}, nil, time.Minute)
+	require.Error(t, err)
+}
+
+func TestPostgresQueue(t *testing.T) {
+	db, m := SetupDB(t)
+	defer db.Close()
+	testQueue(t, queue.NewPostgresQueue(db, "reports-test", 50*time.Millisecond))
+	if err := m.Down(); err != nil {
+		require.NoError(t, err)
+	}
+}
+
+func TestHeartbeat(t *testing.T) {
+	ctx := context.Background()
+	q := queue.NewMemoryQueue(50 * time.Millisecond)
+	require.NoError(t, q.Publish(ctx, []byte("long build")))
+	messages, err := q.Receive(ctx, 1, 0)
+	require.NoError(t, err)
+	require.Len(t, messages, 1)
+
+	stop := queue.Heartbeat(ctx, q, messages[0], 50*time.Millisecond, 10*time.Millisecond, slog.Default())
+	// the message stays hidden well past its visibility timeout while the heartbeat runs
+	time.Sleep(150 * time.Millisecond)
+	redelivered, err := q.Receive(ctx, 1, 0)
+	require.NoError(t, err)
+	assert.Empty(t, redelivered)
+	stop()
+
+	time.Sleep(100 * time.Millisecond)
+	redelivered, err = q.Receive(ctx, 1, 0)
+	require.NoError(t, err)
+	assert.Len(t, redelivered, 1)
+}
@@ -0,0 +1,133 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// SQSQueue - queue backed by aws sqs
+type SQSQueue struct {
+	sqsClient *sqs.Client
+	queueName string
+	// visibilityTimeout - sent with every receive so the queue's own default does not apply
+	visibilityTimeout time.Duration
+	mu                sync.Mutex
+	queueURL          *string
+}
+
+func NewSQSQueue(sqsClient *sqs.Client, queueName string, visibilityTimeout time.Duration) *SQSQueue {
+	return &SQSQueue{
+		sqsClient:         sqsClient,
+		queueName:         queueName,
+		visibilityTimeout: visibilityTimeout,
+	}
+}
+
+// url - queue url, resolved once
+func (q *SQSQueue) url(ctx context.Context) (*string, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.queueURL != nil {
+		return q.queueURL, nil
+	}
+	queueURLOutput, err := q.sqsClient.GetQueueUrl(ctx, &sqs.GetQueueUrlInput{
+		QueueName: aws.String(q.queueName),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get url for queue %s: %w", q.queueName, err)
+	}
+	q.queueURL = queueURLOutput.QueueUrl
+	return q.queueURL, nil
+}
+
+func (q *SQSQueue) Publish(ctx context.Context, body []byte) error {
+	queueURL, err := q.url(ctx)
+	if err != nil {
+		return err
+	}
+	if _, err := q.sqsClient.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:    queueURL,
+		MessageBody: aws.String(string(body)),
+	}); err != nil {
+		return fmt.Errorf("failed to send sqs message: %w", err)
+	}
+	return nil
+}
+
+func (q *SQSQueue) Receive(ctx context.Context, maxMessages int, waitTime time.Duration) ([]Message, error) {
+	queueURL, err := q.url(ctx)
+	if err != nil {
+		return nil, err
+	}
+	output, err := q.sqsClient.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+		QueueUrl:                    queueURL,
+		MaxNumberOfMessages:         int32(maxMessages),
+		WaitTimeSeconds:             int32(waitTime / time.Second),
+		VisibilityTimeout:           int32(q.visibilityTimeout / time.Second),
+		MessageSystemAttributeNames: []types.MessageSystemAttributeName{types.MessageSystemAttributeNameApproximateReceiveCount},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to receive sqs message: %w", err)
+	}
+	messages := make([]Message, 0, len(output.Messages))
+	for _, message := range output.Messages {
+		receiveCount, _ := strconv.Atoi(message.Attributes[string(types.MessageSystemAttributeNameApproximateReceiveCount)])
+		messages = append(messages, Message{
+			ID:            aws.ToString(message.MessageId),
+			Body:          []byte(aws.ToString(message.Body)),
+			ReceiptHandle: aws.ToString(message.ReceiptHandle),
+			ReceiveCount:  receiveCount,
+		})
+	}
+	return messages, nil
+}
+
+func (q *SQSQueue) Ack(ctx context.Context, message Message) error {
+	queueURL, err := q.url(ctx)
+	if err != nil {
+		return err
+	}
+	if _, err := q.sqsClient.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+		QueueUrl:      queueURL,
+		ReceiptHandle: aws.String(message.ReceiptHandle),
+	}); err != nil {
+		if isMessageGone(err) {
+			return fmt.Errorf("message %s: %w", message.ID, ErrMessageNotFound)
+		}
+		return fmt.Errorf("failed to delete sqs message %s: %w", message.ID, err)
+	}
+	return nil
+}
+
+func (q *SQSQueue) ExtendVisibility(ctx context.Context, message Message, timeout time.Duration) error {
+	queueURL, err := q.url(ctx)
+	if err != nil {
+		return err
+	}
+	if _, err := q.sqsClient.ChangeMessageVisibility(ctx, &sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          queueURL,
+		ReceiptHandle:     aws.String(message.ReceiptHandle),
+		VisibilityTimeout: int32(timeout / time.Second),
+	}); err != nil {
+		if isMessageGone(err) {
+			return fmt.Errorf("message %s: %w", message.ID, ErrMessageNotFound)
+		}
+		return fmt.Errorf("failed to change visibility of sqs message %s: %w", message.ID, err)
+	}
+	return nil
+}
+
+// isMessageGone - sqs no longer knows the receipt handle, the message was acked or delivered again
+func isMessageGone(err error) bool {
+	var receiptHandleIsInvalid *types.ReceiptHandleIsInvalid
+	var messageNotInflight *types.MessageNotInflight
+	return errors.As(err, &receiptHandleIsInvalid) || errors.As(err, &messageNotInflight)
+}
@@ -3,4 +3,6 @@ package response
 type ApiResponse[T any] struct {
 	Data    *T     `json:"data,omitempty"`
 	Message string `json:"message,omitempty"`
+	// Code - machine readable reason of an error, set when the status alone is ambiguous
+	Code string `json:"code,omitempty"`
 }
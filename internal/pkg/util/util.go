@@ -12,16 +12,10 @@ func CloseChannel(ch chan error) {
 	}
 }
 
-type userCtxKey struct{}
-
-func ContextWithUserID(ctx context.Context, user *user.User) context.Context {
-	return context.WithValue(ctx, userCtxKey{}, user)
+func ContextWithUserID(ctx context.Context, u *user.User) context.Context {
+	return user.NewContext(ctx, u)
 }
 
 func UserFromContext(ctx context.Context) (*user.User, bool) {
-	user, ok := ctx.Value(userCtxKey{}).(*user.User)
-	if !ok || user == nil {
-		return nil, false
-	}
-	return user, true
+	return user.FromContext(ctx)
 }
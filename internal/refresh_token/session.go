@@ -0,0 +1,175 @@
+package refreshtoken
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// Session - one signed in device, its refresh tokens form the family with the session id
+type Session struct {
+	ID         uuid.UUID      `db:"id"`
+	UserID     uuid.UUID      `db:"user_id"`
+	Label      sql.NullString `db:"label"`
+	UserAgent  sql.NullString `db:"user_agent"`
+	IPAddress  sql.NullString `db:"ip_address"`
+	CreatedAt  time.Time      `db:"created_at"`
+	LastUsedAt time.Time      `db:"last_used_at"`
+	RevokedAt  sql.NullTime   `db:"revoked_at"`
+}
+
+// SessionInfo - device details recorded at sign in, empty values are stored as null
+type SessionInfo struct {
+	Label     string
+	UserAgent string
+	IPAddress string
+}
+
+// size of the sessions columns
+const (
+	maxLabelLength     = 100
+	maxUserAgentLength = 500
+	maxIPAddressLength = 45
+)
+
+func nullString(value string, maxLength int) sql.NullString {
+	if len(value) > maxLength {
+		value = value[:maxLength]
+	}
+	return sql.NullString{String: value, Valid: value != ""}
+}
+
+// CreateSession - start a session with token as the first token of its family, other sessions of the user are kept.
+// accessToken is the access token issued with token, it is revoked along with the session
+func (s *RefreshTokenStore) CreateSession(ctx context.Context, userID uuid.UUID, token *jwt.Token, accessToken *jwt.Token,
+	info SessionInfo) (*Session, *RefreshToken, error) {
+	base64TokenHash, err := s.getBase64HashFromToken(token)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get base64 encoded token hash: %w", err)
+	}
+	expiresAt, err := token.Claims.GetExpirationTime()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get expiration time from token: %w", err)
+	}
+	accessJTI, accessExpiresAt, err := accessClaims(accessToken)
+	if err != nil {
+		return nil, nil, err
+	}
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to beginTx: %w", err)
+	}
+	defer tx.Rollback()
+	const createSessionStmt = `INSERT INTO sessions(user_id, label, user_agent, ip_address) VALUES($1, $2, $3, $4) RETURNING *;`
+	var session Session
+	if err := tx.GetContext(ctx, &session, createSessionStmt, userID,
+		nullString(info.Label, maxLabelLength), nullString(info.UserAgent, maxUserAgentLength), nullString(info.IPAddress, maxIPAddressLength),
+	); err != nil {
+		return nil, nil, fmt.Errorf("failed to create session record: %w", err)
+	}
+	const createRefreshTokenStmt = `
+INSERT INTO refresh_tokens(user_id, hashed_token, expired_at, family_id, access_jti, access_expired_at)
+VALUES($1, $2, $3, $4, $5, $6) RETURNING *;
+	`
+	var refreshToken RefreshToken
+	if err := tx.GetContext(ctx, &refreshToken, createRefreshTokenStmt, userID, base64TokenHash, expiresAt.Time.UTC(),
+		session.ID, accessJTI, accessExpiresAt); err != nil {
+		return nil, nil, fmt.Errorf("failed to create refresh token record: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, nil, fmt.Errorf("failed to commit: %w", err)
+	}
+	return &session, &refreshToken, nil
+}
+
+// Sessions - sessions of userID that are not revoked and still hold an unexpired token, most recently used first
+func (s *RefreshTokenStore) Sessions(ctx context.Context, userID uuid.UUID) ([]Session, error) {
+	const prepareStmt = `
+SELECT * FROM sessions
+WHERE user_id = $1 AND revoked_at IS NULL
+  AND EXISTS (
+    SELECT 1 FROM refresh_tokens
+    WHERE family_id = sessions.id AND rotated_at IS NULL AND expired_at > $2
+  )
+ORDER BY last_used_at DESC, id;
+	`
+	var sessions []Session
+	if err := s.db.SelectContext(ctx, &sessions, prepareStmt, userID, time.Now().UTC()); err != nil {
+		return nil, fmt.Errorf("failed to query sessions for user %s: %w", userID, err)
+	}
+	return sessions, nil
+}
+
+// RevokeSession - revoke the session and every refresh token of it, sql.ErrNoRows when it does not
+// exist or is already revoked
+func (s *RefreshTokenStore) RevokeSession(ctx context.Context, userID uuid.UUID, id uuid.UUID) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to beginTx: %w", err)
+	}
+	defer tx.Rollback()
+	const prepareStmt = `SELECT id FROM sessions WHERE user_id = $1 AND id = $2 AND revoked_at IS NULL FOR UPDATE;`
+	var sessionID uuid.UUID
+	if err := tx.GetContext(ctx, &sessionID, prepareStmt, userID, id); err != nil {
+		return fmt.Errorf("failed to revoke session %s for user %s: %w", id, userID, err)
+	}
+	if err := revokeFamily(ctx, tx, sessionID, time.Now().UTC()); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit: %w", err)
+	}
+	return nil
+}
+
+// RevokeSessions - revoke every session of userID, used when the user logs out everywhere
+func (s *RefreshTokenStore) RevokeSessions(ctx context.Context, userID uuid.UUID) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to beginTx: %w", err)
+	}
+	defer tx.Rollback()
+	const prepareStmt = `SELECT id FROM sessions WHERE user_id = $1 AND revoked_at IS NULL FOR UPDATE;`
+	var sessionIDs []uuid.UUID
+	if err := tx.SelectContext(ctx, &sessionIDs, prepareStmt, userID); err != nil {
+		return fmt.Errorf("failed to query sessions for user %s: %w", userID, err)
+	}
+	now := time.Now().UTC()
+	for _, sessionID := range sessionIDs {
+		if err := revokeFamily(ctx, tx, sessionID, now); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit: %w", err)
+	}
+	return nil
+}
+
+// revokeFamily - mark the session and the refresh tokens of familyID as revoked within tx, the access
+// tokens issued with them are added to revoked_tokens until they expire
+func revokeFamily(ctx context.Context, tx *sqlx.Tx, familyID uuid.UUID, now time.Time) error {
+	const revokeAccessTokensStmt = `
+INSERT INTO revoked_tokens(jti, user_id, expired_at)
+SELECT access_jti, user_id, access_expired_at FROM refresh_tokens
+WHERE family_id = $1 AND access_jti IS NOT NULL AND access_expired_at > $2
+ON CONFLICT (jti) DO NOTHING;
+	`
+	if _, err := tx.ExecContext(ctx, revokeAccessTokensStmt, familyID, now); err != nil {
+		return fmt.Errorf("failed to revoke access tokens of session %s: %w", familyID, err)
+	}
+	const revokeSessionStmt = `UPDATE sessions SET revoked_at = $2 WHERE id = $1 AND revoked_at IS NULL;`
+	if _, err := tx.ExecContext(ctx, revokeSessionStmt, familyID, now); err != nil {
+		return fmt.Errorf("failed to revoke session %s: %w", familyID, err)
+	}
+	const revokeTokensStmt = `UPDATE refresh_tokens SET revoked_at = $2 WHERE family_id = $1 AND revoked_at IS NULL;`
+	if _, err := tx.ExecContext(ctx, revokeTokensStmt, familyID, now); err != nil {
+		return fmt.Errorf("failed to revoke refresh token family %s: %w", familyID, err)
+	}
+	return nil
+}
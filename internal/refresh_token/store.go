@@ -5,12 +5,14 @@ import (
 	"crypto/sha256"
 	"database/sql"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
+	jwtmanager "github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/jwt"
 	_ "github.com/lib/pq"
 )
 
@@ -24,13 +26,32 @@ func NewRefreshTokenStore(db *sql.DB) *RefreshTokenStore {
 	}
 }
 
+// RefreshToken - every refresh rotates the token into a child of the same family, the parent
+// is kept with rotated_at set so that presenting it again could be detected. A family is the
+// chain of tokens of one session
 type RefreshToken struct {
-	UserID      uuid.UUID `db:"user_id"`
-	HashedToken string    `db:"hashed_token"`
-	CreatedAt   time.Time `db:"created_at"`
-	ExpiresAt   time.Time `db:"expired_at"`
+	UserID            uuid.UUID      `db:"user_id"`
+	HashedToken       string         `db:"hashed_token"`
+	CreatedAt         time.Time      `db:"created_at"`
+	ExpiresAt         time.Time      `db:"expired_at"`
+	FamilyID          uuid.UUID      `db:"family_id"`
+	ParentHashedToken sql.NullString `db:"parent_hashed_token"`
+	RotatedAt         sql.NullTime   `db:"rotated_at"`
+	RevokedAt         sql.NullTime   `db:"revoked_at"`
+	// AccessJTI - jti of the access token issued with this token, revoked along with the family
+	AccessJTI       sql.NullString `db:"access_jti"`
+	AccessExpiresAt sql.NullTime   `db:"access_expired_at"`
 }
 
+var (
+	// ErrRefreshTokenReused - an already rotated token was presented, its family is revoked
+	ErrRefreshTokenReused = errors.New("refresh token reused")
+	// ErrRefreshTokenRevoked - the family of the token was revoked
+	ErrRefreshTokenRevoked = errors.New("refresh token revoked")
+	// ErrRefreshTokenExpired - the token is past its expiration
+	ErrRefreshTokenExpired = errors.New("refresh token expired")
+)
+
 func (*RefreshTokenStore) getBase64HashFromToken(token *jwt.Token) (string, error) {
 	h := sha256.New()
 	h.Write([]byte(token.Raw))
@@ -39,22 +60,13 @@ func (*RefreshTokenStore) getBase64HashFromToken(token *jwt.Token) (string, erro
 	return base64TokenHash, nil
 }
 
+// Create - store token as the first token of a new session without device details
 func (s *RefreshTokenStore) Create(ctx context.Context, userID uuid.UUID, token *jwt.Token) (*RefreshToken, error) {
-	const prepareStmt = `INSERT INTO refresh_tokens(user_id, hashed_token, expired_at) VALUES($1, $2, $3) RETURNING *;`
-	base64TokenHash, err := s.getBase64HashFromToken(token)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get base64 encoded token hash: %w", err)
-	}
-	var refreshToken RefreshToken
-	expiresAt, err := token.Claims.GetExpirationTime()
+	_, refreshToken, err := s.CreateSession(ctx, userID, token, nil, SessionInfo{})
 	if err != nil {
-		return nil, fmt.Errorf("failed to get expiration time from token: %w", err)
-	}
-	if err := s.db.GetContext(ctx, &refreshToken, prepareStmt, userID, base64TokenHash, expiresAt.Time.UTC()); err != nil {
-		return nil, fmt.Errorf("failed to create refresh token record: %w", err)
+		return nil, err
 	}
-
-	return &refreshToken, nil
+	return refreshToken, nil
 }
 
 func (s *RefreshTokenStore) ByPrimaryKey(ctx context.Context, userID uuid.UUID, token *jwt.Token) (*RefreshToken, error) {
@@ -81,35 +93,87 @@ func (s *RefreshTokenStore) DeleteUserToken(ctx context.Context, userID uuid.UUI
 	return result, nil
 }
 
-func (s *RefreshTokenStore) ResetUserToken(ctx context.Context, userID uuid.UUID, token *jwt.Token) (*RefreshToken, error) {
-	base64TokenHash, err := s.getBase64HashFromToken(token)
+// accessClaims - jti and expiration of the access token issued along a refresh token, null when there is none
+func accessClaims(accessToken *jwt.Token) (sql.NullString, sql.NullTime, error) {
+	if accessToken == nil {
+		return sql.NullString{}, sql.NullTime{}, nil
+	}
+	jti, err := jwtmanager.TokenID(accessToken)
+	if err != nil {
+		return sql.NullString{}, sql.NullTime{}, fmt.Errorf("failed to get jti from access token: %w", err)
+	}
+	expiresAt, err := accessToken.Claims.GetExpirationTime()
+	if err != nil {
+		return sql.NullString{}, sql.NullTime{}, fmt.Errorf("failed to get expiration time from access token: %w", err)
+	}
+	return sql.NullString{String: jti, Valid: true}, sql.NullTime{Time: expiresAt.Time.UTC(), Valid: true}, nil
+}
+
+// Rotate - exchange current for next within the family of current, nextAccess is the access token issued
+// with next. When current was already rotated the whole family is revoked and ErrRefreshTokenReused is
+// returned with the record of current, sql.ErrNoRows when current is unknown
+func (s *RefreshTokenStore) Rotate(ctx context.Context, userID uuid.UUID, current *jwt.Token, next *jwt.Token, nextAccess *jwt.Token) (*RefreshToken, error) {
+	currentHash, err := s.getBase64HashFromToken(current)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get base64 encoded token hash: %w", err)
 	}
-	var refreshToken RefreshToken
-	expiresAt, err := token.Claims.GetExpirationTime()
+	nextHash, err := s.getBase64HashFromToken(next)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get expiration time from token: %w", err)
+		return nil, fmt.Errorf("failed to get base64 encoded token hash: %w", err)
 	}
-	tx, err := s.db.Beginx()
-	defer func() {
-		if err != nil {
-			tx.Rollback()
-		}
-	}()
+	expiresAt, err := next.Claims.GetExpirationTime()
 	if err != nil {
-		return nil, fmt.Errorf("failed to beginTx: %w", err)
+		return nil, fmt.Errorf("failed to get expiration time from token: %w", err)
 	}
-	const deleteRefreshTokenStmt = `DELETE FROM refresh_tokens WHERE user_id = $1;`
-	_, err = tx.ExecContext(ctx, deleteRefreshTokenStmt, userID)
+	accessJTI, accessExpiresAt, err := accessClaims(nextAccess)
 	if err != nil {
-		return nil, fmt.Errorf("failed to delete refresh_tokens record: %w", err)
+		return nil, err
 	}
-	const createRefreshTokenStmt = `INSERT INTO refresh_tokens(user_id, hashed_token, expired_at) VALUES($1, $2, $3) RETURNING *;`
-	err = tx.GetContext(ctx, &refreshToken, createRefreshTokenStmt, userID, base64TokenHash, expiresAt.Time.UTC())
+	tx, err := s.db.BeginTxx(ctx, nil)
 	if err != nil {
+		return nil, fmt.Errorf("failed to beginTx: %w", err)
+	}
+	defer tx.Rollback()
+	// the row lock makes concurrent refreshes with the same token see the rotation of each other
+	const selectStmt = `SELECT * FROM refresh_tokens WHERE user_id = $1 AND hashed_token = $2 FOR UPDATE;`
+	var currentToken RefreshToken
+	if err := tx.GetContext(ctx, &currentToken, selectStmt, userID, currentHash); err != nil {
+		return nil, fmt.Errorf("failed to read refresh token record: %w", err)
+	}
+	now := time.Now().UTC()
+	switch {
+	case currentToken.RevokedAt.Valid:
+		return &currentToken, ErrRefreshTokenRevoked
+	case currentToken.RotatedAt.Valid:
+		if err := revokeFamily(ctx, tx, currentToken.FamilyID, now); err != nil {
+			return nil, err
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, fmt.Errorf("failed to commit: %w", err)
+		}
+		return &currentToken, ErrRefreshTokenReused
+	case currentToken.ExpiresAt.Before(now):
+		return &currentToken, ErrRefreshTokenExpired
+	}
+	const rotateStmt = `UPDATE refresh_tokens SET rotated_at = $3 WHERE user_id = $1 AND hashed_token = $2;`
+	if _, err := tx.ExecContext(ctx, rotateStmt, userID, currentHash, now); err != nil {
+		return nil, fmt.Errorf("failed to rotate refresh token record: %w", err)
+	}
+	const touchStmt = `UPDATE sessions SET last_used_at = $2 WHERE id = $1;`
+	if _, err := tx.ExecContext(ctx, touchStmt, currentToken.FamilyID, now); err != nil {
+		return nil, fmt.Errorf("failed to update session %s: %w", currentToken.FamilyID, err)
+	}
+	const createStmt = `
+INSERT INTO refresh_tokens(user_id, hashed_token, expired_at, family_id, parent_hashed_token, access_jti, access_expired_at)
+VALUES($1, $2, $3, $4, $5, $6, $7) RETURNING *;
+	`
+	var refreshToken RefreshToken
+	if err := tx.GetContext(ctx, &refreshToken, createStmt, userID, nextHash, expiresAt.Time.UTC(),
+		currentToken.FamilyID, currentHash, accessJTI, accessExpiresAt); err != nil {
 		return nil, fmt.Errorf("failed to create refresh token record: %w", err)
 	}
-	tx.Commit()
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit: %w", err)
+	}
 	return &refreshToken, nil
 }
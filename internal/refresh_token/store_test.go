@@ -14,6 +14,7 @@ import (
 	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/db"
 	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/jwt"
 	refreshtoken "github.com/leetcode-golang-classroom/golang-async-api/internal/refresh_token"
+	revokedtoken "github.com/leetcode-golang-classroom/golang-async-api/internal/revoked_token"
 	"github.com/leetcode-golang-classroom/golang-async-api/internal/user"
 	"github.com/stretchr/testify/require"
 )
@@ -47,9 +48,10 @@ func TestUserStore(t *testing.T) {
 	user1, err := userStore.CreateUser(ctx, "test@email.com", "test")
 	require.NoError(t, err)
 
-	jwtManager := jwt.NewJWTManager(appConfig)
+	jwtManager, err := jwt.NewJWTManager(appConfig)
+	require.NoError(t, err)
 
-	tokenPair, err := jwtManager.GenerateTokenPair(user1.ID)
+	tokenPair, err := jwtManager.GenerateTokenPair(user1.ID, 0)
 	require.NoError(t, err)
 
 	refreshTokenRecord, err := refreshTokenStore.Create(ctx, user1.ID, tokenPair.RefreshToken)
@@ -77,3 +79,99 @@ func TestUserStore(t *testing.T) {
 	}
 	defer m.Drop()
 }
+
+func TestRefreshTokenStoreRotate(t *testing.T) {
+	db, m, appConfig := SetupDB(t)
+	ctx := context.Background()
+	defer db.Close()
+	refreshTokenStore := refreshtoken.NewRefreshTokenStore(db)
+	userStore := user.NewUserStore(db)
+	user1, err := userStore.CreateUser(ctx, "rotate@email.com", "test")
+	require.NoError(t, err)
+	jwtManager, err := jwt.NewJWTManager(appConfig)
+	require.NoError(t, err)
+
+	first, err := jwtManager.GenerateTokenPair(user1.ID, 0)
+	require.NoError(t, err)
+	firstRecord, err := refreshTokenStore.Create(ctx, user1.ID, first.RefreshToken)
+	require.NoError(t, err)
+
+	second, err := jwtManager.GenerateTokenPair(user1.ID, 0)
+	require.NoError(t, err)
+	secondRecord, err := refreshTokenStore.Rotate(ctx, user1.ID, first.RefreshToken, second.RefreshToken, second.AccessToken)
+	require.NoError(t, err)
+	require.Equal(t, firstRecord.FamilyID, secondRecord.FamilyID)
+	require.Equal(t, firstRecord.HashedToken, secondRecord.ParentHashedToken.String)
+
+	// replaying the rotated token revokes the family, including the latest token
+	third, err := jwtManager.GenerateTokenPair(user1.ID, 0)
+	require.NoError(t, err)
+	reused, err := refreshTokenStore.Rotate(ctx, user1.ID, first.RefreshToken, third.RefreshToken, third.AccessToken)
+	require.ErrorIs(t, err, refreshtoken.ErrRefreshTokenReused)
+	require.Equal(t, firstRecord.FamilyID, reused.FamilyID)
+	_, err = refreshTokenStore.Rotate(ctx, user1.ID, second.RefreshToken, third.RefreshToken, third.AccessToken)
+	require.ErrorIs(t, err, refreshtoken.ErrRefreshTokenRevoked)
+
+	_, err = refreshTokenStore.Rotate(ctx, user1.ID, third.RefreshToken, third.RefreshToken, third.AccessToken)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	if err := m.Down(); err != nil {
+		require.NoError(t, err)
+	}
+}
+
+func TestRefreshTokenStoreSessions(t *testing.T) {
+	db, m, appConfig := SetupDB(t)
+	ctx := context.Background()
+	defer db.Close()
+	refreshTokenStore := refreshtoken.NewRefreshTokenStore(db)
+	userStore := user.NewUserStore(db)
+	user1, err := userStore.CreateUser(ctx, "sessions@email.com", "test")
+	require.NoError(t, err)
+	jwtManager, err := jwt.NewJWTManager(appConfig)
+	require.NoError(t, err)
+
+	laptop, err := jwtManager.GenerateTokenPair(user1.ID, 0)
+	require.NoError(t, err)
+	laptopSession, _, err := refreshTokenStore.CreateSession(ctx, user1.ID, laptop.RefreshToken, laptop.AccessToken, refreshtoken.SessionInfo{
+		Label:     "laptop",
+		UserAgent: "curl/8.0",
+		IPAddress: "127.0.0.1",
+	})
+	require.NoError(t, err)
+	require.Equal(t, "laptop", laptopSession.Label.String)
+	phone, err := jwtManager.GenerateTokenPair(user1.ID, 0)
+	require.NoError(t, err)
+	phoneSession, _, err := refreshTokenStore.CreateSession(ctx, user1.ID, phone.RefreshToken, phone.AccessToken, refreshtoken.SessionInfo{})
+	require.NoError(t, err)
+	require.False(t, phoneSession.Label.Valid)
+
+	// signing in on the phone kept the laptop session
+	sessions, err := refreshTokenStore.Sessions(ctx, user1.ID)
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+
+	require.NoError(t, refreshTokenStore.RevokeSession(ctx, user1.ID, laptopSession.ID))
+	require.ErrorIs(t, refreshTokenStore.RevokeSession(ctx, user1.ID, laptopSession.ID), sql.ErrNoRows)
+	// the access token issued with the session is revoked too
+	laptopAccessID, err := jwt.TokenID(laptop.AccessToken)
+	require.NoError(t, err)
+	revoked, err := revokedtoken.NewRevokedTokenStore(db).Active(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{laptopAccessID}, revoked)
+	sessions, err = refreshTokenStore.Sessions(ctx, user1.ID)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	require.Equal(t, phoneSession.ID, sessions[0].ID)
+
+	next, err := jwtManager.GenerateTokenPair(user1.ID, 0)
+	require.NoError(t, err)
+	_, err = refreshTokenStore.Rotate(ctx, user1.ID, laptop.RefreshToken, next.RefreshToken, next.AccessToken)
+	require.ErrorIs(t, err, refreshtoken.ErrRefreshTokenRevoked)
+	_, err = refreshTokenStore.Rotate(ctx, user1.ID, phone.RefreshToken, next.RefreshToken, next.AccessToken)
+	require.NoError(t, err)
+
+	if err := m.Down(); err != nil {
+		require.NoError(t, err)
+	}
+}
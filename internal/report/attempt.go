@@ -0,0 +1,139 @@
+package report
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// ReportAttempt - one run of the builder for a report
+type ReportAttempt struct {
+	ID           uuid.UUID      `db:"id"`
+	UserID       uuid.UUID      `db:"user_id"`
+	ReportID     uuid.UUID      `db:"report_id"`
+	WorkerID     string         `db:"worker_id"`
+	StartedAt    time.Time      `db:"started_at"`
+	FinishedAt   sql.NullTime   `db:"finished_at"`
+	ErrorMessage sql.NullString `db:"error_message"`
+}
+
+type ApiReportAttempt struct {
+	ID           uuid.UUID  `json:"id"`
+	WorkerID     string     `json:"worker_id"`
+	StartedAt    time.Time  `json:"started_at"`
+	FinishedAt   *time.Time `json:"finished_at,omitempty"`
+	ErrorMessage *string    `json:"error_message,omitempty"`
+}
+
+func NewApiReportAttempts(attempts []ReportAttempt) []ApiReportAttempt {
+	apiAttempts := make([]ApiReportAttempt, 0, len(attempts))
+	for _, attempt := range attempts {
+		apiAttempt := ApiReportAttempt{
+			ID:        attempt.ID,
+			WorkerID:  attempt.WorkerID,
+			StartedAt: attempt.StartedAt,
+		}
+		if attempt.FinishedAt.Valid {
+			apiAttempt.FinishedAt = &attempt.FinishedAt.Time
+		}
+		if attempt.ErrorMessage.Valid {
+			apiAttempt.ErrorMessage = &attempt.ErrorMessage.String
+		}
+		apiAttempts = append(apiAttempts, apiAttempt)
+	}
+	return apiAttempts
+}
+
+// DefaultWorkerID - hostname and pid of the current process
+func DefaultWorkerID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+}
+
+func (s *ReportStore) StartAttempt(ctx context.Context, userID uuid.UUID, reportID uuid.UUID, workerID string) (*ReportAttempt, error) {
+	const prepareStmt = `INSERT INTO report_attempts(user_id, report_id, worker_id, started_at) VALUES ($1, $2, $3, $4) RETURNING *;`
+	var attempt ReportAttempt
+	if err := s.db.GetContext(ctx, &attempt, prepareStmt, userID, reportID, workerID, time.Now().UTC()); err != nil {
+		return nil, fmt.Errorf("failed to insert attempt for report %s: %w", reportID, err)
+	}
+	return &attempt, nil
+}
+
+// FinishAttempt - record end time of attempt, errorMessage is empty when the attempt succeeded
+func (s *ReportStore) FinishAttempt(ctx context.Context, attempt *ReportAttempt, errorMessage string) (*ReportAttempt, error) {
+	const prepareStmt = `UPDATE report_attempts SET finished_at = $1, error_message = $2 WHERE id = $3 RETURNING *;`
+	var result ReportAttempt
+	if err := s.db.GetContext(ctx, &result, prepareStmt, time.Now().UTC(), sql.NullString{
+		String: errorMessage,
+		Valid:  errorMessage != "",
+	}, attempt.ID); err != nil {
+		return nil, fmt.Errorf("failed to update attempt %s for report %s: %w", attempt.ID, attempt.ReportID, err)
+	}
+	return &result, nil
+}
+
+// Attempts - attempts of report, oldest first
+func (s *ReportStore) Attempts(ctx context.Context, userID uuid.UUID, reportID uuid.UUID) ([]ReportAttempt, error) {
+	const prepareStmt = `SELECT * FROM report_attempts WHERE user_id = $1 AND report_id = $2 ORDER BY started_at, id;`
+	var attempts []ReportAttempt
+	if err := s.db.SelectContext(ctx, &attempts, prepareStmt, userID, reportID); err != nil {
+		return nil, fmt.Errorf("failed to query attempts for report %s: %w", reportID, err)
+	}
+	return attempts, nil
+}
+
+// AttemptsSinceRetry - number of attempts of report started since the user last retried it
+func (s *ReportStore) AttemptsSinceRetry(ctx context.Context, report *Report) (int, error) {
+	const prepareStmt = `
+SELECT COUNT(*) FROM report_attempts
+WHERE user_id = $1 AND report_id = $2 AND ($3::timestamp IS NULL OR started_at >= $3);
+	`
+	var count int
+	if err := s.db.GetContext(ctx, &count, prepareStmt, report.UserID, report.ID, report.RetriedAt); err != nil {
+		return 0, fmt.Errorf("failed to count attempts for report %s: %w", report.ID, err)
+	}
+	return count, nil
+}
+
+// ResetForRetry - clear the failure of a failed report and enqueue it again, sql.ErrNoRows when it is not failed.
+// The attempts so far no longer count towards the reaper limit
+func (s *ReportStore) ResetForRetry(ctx context.Context, userID uuid.UUID, id uuid.UUID) (*Report, error) {
+	const prepareStmt = `
+UPDATE reports
+SET started_at = NULL,
+    failed_at = NULL,
+    error_message = NULL,
+    retried_at = $3
+WHERE user_id = $1 AND id = $2
+  AND failed_at IS NOT NULL AND completed_at IS NULL AND cancelled_at IS NULL
+RETURNING *;
+	`
+	var report Report
+	err := s.withTx(ctx, func(tx *sqlx.Tx) error {
+		if err := tx.GetContext(ctx, &report, prepareStmt, userID, id, time.Now().UTC()); err != nil {
+			return fmt.Errorf("failed to reset report %s for user %s: %w", id, userID, err)
+		}
+		if err := notifyStatus(ctx, tx, &report); err != nil {
+			return err
+		}
+		return insertOutbox(ctx, tx, &report)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// ResetFailed - ResetForRetry as a deadletter.ReportResetter, so a redriven message builds the report again
+func (s *ReportStore) ResetFailed(ctx context.Context, userID uuid.UUID, id uuid.UUID) error {
+	_, err := s.ResetForRetry(ctx, userID, id)
+	return err
+}
@@ -2,147 +2,300 @@ package report
 
 import (
 	"bytes"
-	"compress/gzip"
 	"context"
 	"database/sql"
-	"encoding/csv"
+	"errors"
 	"fmt"
 	"log/slog"
-	"strconv"
-	"strings"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/google/uuid"
+	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/blob"
 	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/config"
 	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/logger"
+	"github.com/leetcode-golang-classroom/golang-async-api/internal/webhook"
 )
 
 type ReportBuilder struct {
-	appConfig    *config.Config
-	resportStore *ReportStore
-	lozClient    *LozClient
-	s3Client     *s3.Client
+	appConfig     *config.Config
+	resportStore  *ReportStore
+	lozClient     *LozClient
+	blobStore     blob.BlobStore
+	generators    *GeneratorRegistry
+	workerID      string
+	buildTimeouts config.BuildTimeouts
+	webhookStore  *webhook.WebhookStore
+	reuseWindow   time.Duration
+	leaseDuration time.Duration
 }
 
 func NewReportBuilder(
 	appConfig *config.Config,
 	reportStore *ReportStore,
 	lozClient *LozClient,
-	s3Client *s3.Client) *ReportBuilder {
+	blobStore blob.BlobStore,
+	generators *GeneratorRegistry,
+	workerID string,
+	buildTimeouts config.BuildTimeouts,
+	webhookStore *webhook.WebhookStore,
+	reuseWindow time.Duration,
+	leaseDuration time.Duration) *ReportBuilder {
 	return &ReportBuilder{
-		appConfig:    appConfig,
-		resportStore: reportStore,
-		lozClient:    lozClient,
-		s3Client:     s3Client,
+		appConfig:     appConfig,
+		resportStore:  reportStore,
+		lozClient:     lozClient,
+		blobStore:     blobStore,
+		generators:    generators,
+		workerID:      workerID,
+		buildTimeouts: buildTimeouts,
+		webhookStore:  webhookStore,
+		reuseWindow:   reuseWindow,
+		leaseDuration: leaseDuration,
 	}
 }
 
+// ErrReportCancelled - cause of the build context when the report was cancelled by the user
+var ErrReportCancelled = errors.New("report cancelled")
+
+// maxErrorMessageLength - size of reports.error_message column
+const maxErrorMessageLength = 300
+
 func (b *ReportBuilder) Build(ctx context.Context,
-	userID uuid.UUID, reportID uuid.UUID) (report *Report, err error) {
+	userID uuid.UUID, reportID uuid.UUID) (result *Report, err error) {
 	log := logger.FromContext(ctx)
-	report, err = b.resportStore.ByPrimaryKey(ctx, userID, reportID)
+	report, err := b.resportStore.ByPrimaryKey(ctx, userID, reportID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get report %s for user %s: %w", reportID, userID, err)
 	}
 
-	if report.StartedAt.Valid {
+	if report.IsDone() {
 		return report, nil
 	}
+	ctx, cancelTimeout := context.WithTimeout(ctx, b.buildTimeouts.For(report.ReportType))
+	defer cancelTimeout()
+	claimed, err := b.resportStore.Claim(ctx, userID, reportID, b.workerID, b.leaseDuration)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			log.Info("report is done or leased by another worker", slog.String("report_id", reportID.String()))
+			return report, nil
+		}
+		return nil, err
+	}
+	report = claimed
 	defer func() {
-		if err != nil {
-			now := time.Now().UTC()
-			errMsg := err.Error()
-			report.FailedAt = sql.NullTime{
-				Time:  now,
-				Valid: true,
-			}
-			report.ErrorMessage = sql.NullString{
-				String: errMsg,
-				Valid:  true,
+		if err == nil {
+			return
+		}
+		cause := context.Cause(ctx)
+		if errors.Is(cause, ErrWorkerShutdown) {
+			// hand the report over to the next worker instead of failing it
+			if releaseErr := b.resportStore.ReleaseLease(context.WithoutCancel(ctx), report.UserID, report.ID, b.workerID); releaseErr != nil {
+				log.Error("failed to release report lease", slog.Any("error", releaseErr))
 			}
-			if _, updateErr := b.resportStore.Update(ctx, report); updateErr != nil {
-				log.Error("failed to update report", slog.Any("error", err))
+		}
+		if isAbortCause(cause) {
+			err = fmt.Errorf("%w: %w", cause, err)
+			return
+		}
+		if errors.Is(err, ErrLeaseLost) || errors.Is(err, ErrReportCancelled) || errors.Is(err, sql.ErrNoRows) {
+			// the report belongs to another worker now, was cancelled or deleted, there is no failure to record
+			return
+		}
+		// the build context may already be done, record the failure anyway
+		failed, failErr := b.resportStore.Fail(context.WithoutCancel(ctx), report, b.workerID, errorMessage(err))
+		if failErr != nil {
+			if errors.Is(failErr, ErrLeaseLost) || errors.Is(failErr, ErrReportCancelled) {
+				log.Warn("report was taken over or cancelled before the failure was recorded",
+					slog.String("report_id", reportID.String()), slog.Any("error", failErr))
+				return
 			}
+			log.Error("failed to update report", slog.Any("error", failErr))
+			return
+		}
+		if webhookErr := EnqueueWebhooks(context.WithoutCancel(ctx), b.webhookStore, failed, NewApiReport(failed)); webhookErr != nil {
+			log.Error("failed to enqueue report webhooks", slog.Any("error", webhookErr))
 		}
 	}()
 
-	now := time.Now().UTC()
-	report.StartedAt = sql.NullTime{
-		Time:  now,
-		Valid: true,
-	}
-	report, err = b.resportStore.Update(ctx, report)
-	if err != nil {
-		return nil, fmt.Errorf("failed to update report %s for user %d: %w", reportID, userID, err)
-	}
+	ctx, cancelLease := context.WithCancelCause(ctx)
+	defer cancelLease(nil)
+	go b.keepLease(ctx, cancelLease, report)
 
-	resp, err := b.lozClient.GetMonsters()
+	attempt, err := b.resportStore.StartAttempt(ctx, userID, reportID, b.workerID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get monsters data: %w", err)
-	}
-
-	if len(resp.Data) == 0 {
-		return nil, fmt.Errorf("no monsters data found")
+		return nil, err
 	}
-
-	var buffer bytes.Buffer
-	qzipWriter := gzip.NewWriter(&buffer)
-	csvWriter := csv.NewWriter(qzipWriter)
-	header := []string{"name", "id", "category", "description", "image", "common_locations", "drops", "dlc"}
-	if err := csvWriter.Write(header); err != nil {
-		return nil, fmt.Errorf("failed to write csv header: %w", err)
-	}
-	for _, monster := range resp.Data {
-		csvRow := []string{
-			monster.Name,
-			fmt.Sprintf("%d", monster.ID),
-			monster.Category,
-			monster.Description,
-			monster.Image,
-			strings.Join(monster.CommonLocations, ", "),
-			strings.Join(monster.Drops, ", "),
-			strconv.FormatBool(monster.Dlc),
+	defer func() {
+		var errMsg string
+		if err != nil {
+			if cause := context.Cause(ctx); isAbortCause(cause) {
+				errMsg = cause.Error()
+			} else {
+				errMsg = errorMessage(err)
+			}
 		}
-		if err := csvWriter.Write(csvRow); err != nil {
-			return nil, fmt.Errorf("failed to write csv row: %w", err)
+		if _, finishErr := b.resportStore.FinishAttempt(context.WithoutCancel(ctx), attempt, errMsg); finishErr != nil {
+			log.Error("failed to finish report attempt", slog.Any("error", finishErr))
 		}
+	}()
 
-		if err := csvWriter.Error(); err != nil {
-			return nil, fmt.Errorf("failed to write csv row: %w", err)
+	if report.Reuse {
+		reused, ok, err := b.reuse(ctx, report)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return reused, nil
 		}
 	}
-	csvWriter.Flush()
-	if err := csvWriter.Error(); err != nil {
-		return nil, fmt.Errorf("failed to flush csv writer: %w", err)
+
+	generator, ok := b.generators.Get(report.ReportType)
+	if !ok {
+		return nil, b.generators.Validate(report.ReportType)
 	}
-	if err := qzipWriter.Close(); err != nil {
-		return nil, fmt.Errorf("failed to close gzip writer: %w", err)
+	b.progress(ctx, report, StageGenerating)
+	rows, err := generator.Generate(ctx, b.lozClient, report.Game)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate %s report: %w", report.ReportType, err)
 	}
 
-	key := fmt.Sprintf("/users/%s/report/%s.csv.gz", userID, reportID)
-	_, err = b.s3Client.PutObject(ctx, &s3.PutObjectInput{
-		Key:    aws.String(key),
-		Bucket: aws.String(b.appConfig.S3Bucket),
-		Body:   bytes.NewReader(buffer.Bytes()),
-	})
+	b.progress(ctx, report, StageEncoding)
+	var buffer bytes.Buffer
+	compressWriter, err := NewCompressWriter(&buffer, report.Compression)
 	if err != nil {
+		return nil, err
+	}
+	columns, rows := report.Parameters.Apply(generator.Columns(), rows)
+	if err := EncodeReport(compressWriter, report.OutputFormat, columns, rows); err != nil {
+		return nil, fmt.Errorf("failed to encode %s report: %w", report.OutputFormat, err)
+	}
+	if err := compressWriter.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close %s writer: %w", report.Compression, err)
+	}
+
+	// do not upload anything once the report is cancelled, a cancel arriving during the upload
+	// is caught by the completion below
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("report build stopped before upload: %w", err)
+	}
+	b.progress(ctx, report, StageUploading)
+	key := ObjectKey(userID, reportID, report.OutputFormat, report.Compression)
+	if err := b.blobStore.Put(ctx, key, bytes.NewReader(buffer.Bytes()), blob.PutOptions{
+		ContentType:     report.OutputFormat.ContentType(),
+		ContentEncoding: report.Compression.ContentEncoding(),
+	}); err != nil {
 		return nil, fmt.Errorf("failed to upload report to %s: %w", key, err)
 	}
 	report.OutputFilePath = sql.NullString{
 		String: key,
 		Valid:  true,
 	}
-	report.CompletedAt = sql.NullTime{
-		Time:  now,
-		Valid: true,
+	if report, err = b.complete(ctx, report); err != nil {
+		if errors.Is(err, ErrReportCancelled) || errors.Is(err, sql.ErrNoRows) {
+			// nothing points at the uploaded artifact, the key of a lost lease is left to its new owner
+			if deleteErr := b.blobStore.Delete(context.WithoutCancel(ctx), key); deleteErr != nil {
+				log.Error("failed to delete artifact of cancelled report", slog.String("path", key), slog.Any("error", deleteErr))
+			}
+		}
+		return nil, err
 	}
-	report, err = b.resportStore.Update(ctx, report)
-	if err != nil {
-		return nil, fmt.Errorf("failed to update report %s for user %s: %w", reportID, userID, err)
+	if err := b.notifyCompleted(ctx, report); err != nil {
+		log.Error("failed to enqueue report webhooks", slog.Any("error", err))
 	}
 	log.Info("successfuly generated report", slog.String("report_id", reportID.String()),
 		slog.String("user_id", userID.String()), slog.String("path", key))
 	return report, nil
 }
+
+// reuse - complete report with the artifact of a recent identical report, ok is false when there is none
+// within the reuse window and the report has to be generated
+func (b *ReportBuilder) reuse(ctx context.Context, report *Report) (*Report, bool, error) {
+	log := logger.FromContext(ctx)
+	source, err := b.resportStore.FindReusable(ctx, report, time.Now().UTC().Add(-b.reuseWindow))
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Warn("failed to find reusable report", slog.Any("error", err))
+		}
+		return nil, false, nil
+	}
+	report.OutputFilePath = source.OutputFilePath
+	report.ReusedFrom = uuid.NullUUID{UUID: source.ID, Valid: true}
+	if source.ReusedFrom.Valid {
+		report.ReusedFrom = source.ReusedFrom
+	}
+	if report, err = b.complete(ctx, report); err != nil {
+		return nil, false, err
+	}
+	if err := b.notifyCompleted(ctx, report); err != nil {
+		log.Error("failed to enqueue report webhooks", slog.Any("error", err))
+	}
+	log.Info("reused report", slog.String("report_id", report.ID.String()),
+		slog.String("reused_from", report.ReusedFrom.UUID.String()), slog.String("path", report.OutputFilePath.String))
+	return report, true, nil
+}
+
+// keepLease - renew the lease while the build runs, the build is stopped once the lease is lost
+func (b *ReportBuilder) keepLease(ctx context.Context, cancel context.CancelCauseFunc, report *Report) {
+	log := logger.FromContext(ctx)
+	ticker := time.NewTicker(b.leaseDuration / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := b.resportStore.RenewLease(ctx, report.UserID, report.ID, b.workerID, b.leaseDuration)
+			if errors.Is(err, sql.ErrNoRows) {
+				cancel(ErrLeaseLost)
+				return
+			}
+			if err != nil && ctx.Err() == nil {
+				log.Warn("failed to renew report lease", slog.Any("error", err))
+			}
+		}
+	}
+}
+
+// notifyCompleted - queue the completion webhooks, the payload carries a download url valid for DefaultWebhookDownloadURLExpiry
+func (b *ReportBuilder) notifyCompleted(ctx context.Context, report *Report) error {
+	apiReport := NewApiReport(report)
+	signedURL, err := b.blobStore.SignedURL(ctx, report.OutputFilePath.String, DefaultWebhookDownloadURLExpiry)
+	if err != nil {
+		return fmt.Errorf("failed to sign download url of report %s: %w", report.ID, err)
+	}
+	expiresAt := time.Now().UTC().Add(DefaultWebhookDownloadURLExpiry)
+	apiReport.DownloadURL = &signedURL
+	apiReport.DownloadURLExpiresAt = &expiresAt
+	return EnqueueWebhooks(ctx, b.webhookStore, report, apiReport)
+}
+
+// progress - tell the event streams which stage the build reached, a lost notification does not fail the build
+func (b *ReportBuilder) progress(ctx context.Context, report *Report, stage string) {
+	if err := b.resportStore.NotifyProgress(ctx, report, stage); err != nil && ctx.Err() == nil {
+		logger.FromContext(ctx).Warn("failed to notify report progress", slog.String("stage", stage), slog.Any("error", err))
+	}
+}
+
+// isAbortCause - build stopped from outside, the report must not be marked failed
+func isAbortCause(cause error) bool {
+	return errors.Is(cause, ErrReportCancelled) || errors.Is(cause, ErrLeaseLost) || errors.Is(cause, ErrWorkerShutdown)
+}
+
+// errorMessage - error text that fits the error_message columns
+func errorMessage(err error) string {
+	errMsg := err.Error()
+	if len(errMsg) > maxErrorMessageLength {
+		errMsg = errMsg[:maxErrorMessageLength]
+	}
+	return errMsg
+}
+
+// complete - persist the artifact of report, the given report is kept when it fails so that failure could still be recorded.
+// Completion webhooks must not be sent when the lease was lost in the meantime
+func (b *ReportBuilder) complete(ctx context.Context, report *Report) (*Report, error) {
+	completed, err := b.resportStore.Complete(ctx, report, b.workerID)
+	if err != nil {
+		return report, err
+	}
+	return completed, nil
+}
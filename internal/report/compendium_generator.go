@@ -0,0 +1,174 @@
+package report
+
+import (
+	"context"
+	"fmt"
+)
+
+// compendiumGenerator - generate report from one compendium category
+type compendiumGenerator[T any] struct {
+	category string
+	columns  []string
+	fetch    func(ctx context.Context, lozClient *LozClient, game Game) ([]T, error)
+	toRow    func(entry T) Row
+}
+
+func (g *compendiumGenerator[T]) Columns() []string {
+	return g.columns
+}
+
+func (g *compendiumGenerator[T]) Generate(ctx context.Context, lozClient *LozClient, game Game) ([]Row, error) {
+	entries, err := g.fetch(ctx, lozClient, game)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s data: %w", g.category, err)
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("no %s data found", g.category)
+	}
+	rows := make([]Row, 0, len(entries))
+	for _, entry := range entries {
+		rows = append(rows, g.toRow(entry))
+	}
+	return rows, nil
+}
+
+func NewMonstersGenerator() ReportGenerator {
+	return &compendiumGenerator[Monster]{
+		category: "monsters",
+		columns:  []string{"name", "id", "category", "description", "image", "common_locations", "drops", "dlc"},
+		fetch: func(ctx context.Context, lozClient *LozClient, game Game) ([]Monster, error) {
+			resp, err := lozClient.GetMonsters(ctx, game)
+			if err != nil {
+				return nil, err
+			}
+			return resp.Data, nil
+		},
+		toRow: func(monster Monster) Row {
+			return Row{
+				"name":             monster.Name,
+				"id":               monster.ID,
+				"category":         monster.Category,
+				"description":      monster.Description,
+				"image":            monster.Image,
+				"common_locations": monster.CommonLocations,
+				"drops":            monster.Drops,
+				"dlc":              monster.Dlc,
+			}
+		},
+	}
+}
+
+func NewCreaturesGenerator() ReportGenerator {
+	return &compendiumGenerator[Creature]{
+		category: "creatures",
+		columns: []string{"name", "id", "category", "description", "image", "common_locations", "drops",
+			"edible", "cooking_effect", "hearts_recovered", "dlc"},
+		fetch: func(ctx context.Context, lozClient *LozClient, game Game) ([]Creature, error) {
+			resp, err := lozClient.GetCreatures(ctx, game)
+			if err != nil {
+				return nil, err
+			}
+			return resp.Data, nil
+		},
+		toRow: func(creature Creature) Row {
+			return Row{
+				"name":             creature.Name,
+				"id":               creature.ID,
+				"category":         creature.Category,
+				"description":      creature.Description,
+				"image":            creature.Image,
+				"common_locations": creature.CommonLocations,
+				"drops":            creature.Drops,
+				"edible":           creature.Edible,
+				"cooking_effect":   creature.CookingEffect,
+				"hearts_recovered": creature.HeartsRecovered,
+				"dlc":              creature.Dlc,
+			}
+		},
+	}
+}
+
+func NewEquipmentGenerator() ReportGenerator {
+	return &compendiumGenerator[Equipment]{
+		category: "equipment",
+		columns: []string{"name", "id", "category", "description", "image", "common_locations",
+			"attack", "defense", "effect", "type", "dlc"},
+		fetch: func(ctx context.Context, lozClient *LozClient, game Game) ([]Equipment, error) {
+			resp, err := lozClient.GetEquipment(ctx, game)
+			if err != nil {
+				return nil, err
+			}
+			return resp.Data, nil
+		},
+		toRow: func(equipment Equipment) Row {
+			return Row{
+				"name":             equipment.Name,
+				"id":               equipment.ID,
+				"category":         equipment.Category,
+				"description":      equipment.Description,
+				"image":            equipment.Image,
+				"common_locations": equipment.CommonLocations,
+				"attack":           equipment.Properties.Attack,
+				"defense":          equipment.Properties.Defense,
+				"effect":           equipment.Properties.Effect,
+				"type":             equipment.Properties.Type,
+				"dlc":              equipment.Dlc,
+			}
+		},
+	}
+}
+
+func NewMaterialsGenerator() ReportGenerator {
+	return &compendiumGenerator[Material]{
+		category: "materials",
+		columns: []string{"name", "id", "category", "description", "image", "common_locations",
+			"cooking_effect", "hearts_recovered", "fuse_attack_power", "dlc"},
+		fetch: func(ctx context.Context, lozClient *LozClient, game Game) ([]Material, error) {
+			resp, err := lozClient.GetMaterials(ctx, game)
+			if err != nil {
+				return nil, err
+			}
+			return resp.Data, nil
+		},
+		toRow: func(material Material) Row {
+			return Row{
+				"name":              material.Name,
+				"id":                material.ID,
+				"category":          material.Category,
+				"description":       material.Description,
+				"image":             material.Image,
+				"common_locations":  material.CommonLocations,
+				"cooking_effect":    material.CookingEffect,
+				"hearts_recovered":  material.HeartsRecovered,
+				"fuse_attack_power": material.FuseAttackPower,
+				"dlc":               material.Dlc,
+			}
+		},
+	}
+}
+
+func NewTreasureGenerator() ReportGenerator {
+	return &compendiumGenerator[Treasure]{
+		category: "treasure",
+		columns:  []string{"name", "id", "category", "description", "image", "common_locations", "drops", "dlc"},
+		fetch: func(ctx context.Context, lozClient *LozClient, game Game) ([]Treasure, error) {
+			resp, err := lozClient.GetTreasure(ctx, game)
+			if err != nil {
+				return nil, err
+			}
+			return resp.Data, nil
+		},
+		toRow: func(treasure Treasure) Row {
+			return Row{
+				"name":             treasure.Name,
+				"id":               treasure.ID,
+				"category":         treasure.Category,
+				"description":      treasure.Description,
+				"image":            treasure.Image,
+				"common_locations": treasure.CommonLocations,
+				"drops":            treasure.Drops,
+				"dlc":              treasure.Dlc,
+			}
+		},
+	}
+}
@@ -0,0 +1,224 @@
+package report
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// ReportEventsChannel - postgres channel the report status transitions are notified on
+const ReportEventsChannel = "report_events"
+
+const (
+	// EventProgress - status of the events sent while a report is built
+	EventProgress = "progress"
+	// DefaultEventsKeepAlive - how often an idle event stream sends a comment so proxies keep it open
+	DefaultEventsKeepAlive = 15 * time.Second
+	// eventsSubscriberBuffer - events kept for a slow subscriber before new ones are dropped
+	eventsSubscriberBuffer = 16
+)
+
+// Progress stages of a report build
+const (
+	StageGenerating = "generating"
+	StageEncoding   = "encoding"
+	StageUploading  = "uploading"
+)
+
+// ReportEvent - status transition of a report, the payload of ReportEventsChannel notifications
+type ReportEvent struct {
+	UserID   uuid.UUID `json:"user_id"`
+	ReportID uuid.UUID `json:"report_id"`
+	Status   string    `json:"status"`
+	Stage    string    `json:"stage,omitempty"`
+}
+
+// notifyEvent - notify event within tx, listeners only receive it once tx commits
+func notifyEvent(ctx context.Context, tx *sqlx.Tx, event ReportEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal report event: %w", err)
+	}
+	const prepareStmt = `SELECT pg_notify($1, $2);`
+	if _, err := tx.ExecContext(ctx, prepareStmt, ReportEventsChannel, string(payload)); err != nil {
+		return fmt.Errorf("failed to notify %s event of report %s: %w", event.Status, event.ReportID, err)
+	}
+	return nil
+}
+
+// notifyStatus - notify the current status of report within tx
+func notifyStatus(ctx context.Context, tx *sqlx.Tx, report *Report) error {
+	return notifyEvent(ctx, tx, ReportEvent{
+		UserID:   report.UserID,
+		ReportID: report.ID,
+		Status:   report.Status(),
+	})
+}
+
+// NotifyProgress - notify that the build of report reached stage
+func (s *ReportStore) NotifyProgress(ctx context.Context, report *Report, stage string) error {
+	return s.withTx(ctx, func(tx *sqlx.Tx) error {
+		return notifyEvent(ctx, tx, ReportEvent{
+			UserID:   report.UserID,
+			ReportID: report.ID,
+			Status:   EventProgress,
+			Stage:    stage,
+		})
+	})
+}
+
+// WriteEvent - write event as a server-sent event named after its status
+func WriteEvent(w io.Writer, event string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s event: %w", event, err)
+	}
+	if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload); err != nil {
+		return fmt.Errorf("failed to write %s event: %w", event, err)
+	}
+	return nil
+}
+
+// EventBroker - LISTEN on ReportEventsChannel and fan the events out to the streams of this instance.
+// A subscriber receives a zero ReportEvent after the listener reconnected, notifications could be
+// lost meanwhile so the subscriber should reload the report
+type EventBroker struct {
+	dbURL       string
+	logger      *slog.Logger
+	mu          sync.Mutex
+	subscribers map[uuid.UUID]map[chan ReportEvent]struct{}
+	closed      bool
+}
+
+func NewEventBroker(dbURL string, logger *slog.Logger) *EventBroker {
+	return &EventBroker{
+		dbURL:       dbURL,
+		logger:      logger,
+		subscribers: make(map[uuid.UUID]map[chan ReportEvent]struct{}),
+	}
+}
+
+// Subscribe - events of reportID until unsubscribe is called, the channel is closed once the broker stops
+func (b *EventBroker) Subscribe(reportID uuid.UUID) (<-chan ReportEvent, func()) {
+	events := make(chan ReportEvent, eventsSubscriberBuffer)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(events)
+		return events, func() {}
+	}
+	if b.subscribers[reportID] == nil {
+		b.subscribers[reportID] = make(map[chan ReportEvent]struct{})
+	}
+	b.subscribers[reportID][events] = struct{}{}
+	var once sync.Once
+	return events, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			if _, ok := b.subscribers[reportID][events]; !ok {
+				return
+			}
+			delete(b.subscribers[reportID], events)
+			if len(b.subscribers[reportID]) == 0 {
+				delete(b.subscribers, reportID)
+			}
+			close(events)
+		})
+	}
+}
+
+// Publish - deliver event to the subscribers of its report, dropped for subscribers that are not keeping up
+func (b *EventBroker) Publish(event ReportEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for events := range b.subscribers[event.ReportID] {
+		select {
+		case events <- event:
+		default:
+			b.logger.Warn("dropped report event for slow subscriber",
+				slog.String("report_id", event.ReportID.String()), slog.String("status", event.Status))
+		}
+	}
+}
+
+// resync - ask every subscriber to reload its report
+func (b *EventBroker) resync() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, subscribers := range b.subscribers {
+		for events := range subscribers {
+			select {
+			case events <- ReportEvent{}:
+			default:
+			}
+		}
+	}
+}
+
+// close - end every subscription, later subscriptions are closed right away
+func (b *EventBroker) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for reportID, subscribers := range b.subscribers {
+		for events := range subscribers {
+			close(events)
+		}
+		delete(b.subscribers, reportID)
+	}
+}
+
+// Start - listen for report events until ctx is done, then close the subscriptions
+func (b *EventBroker) Start(ctx context.Context) error {
+	defer b.close()
+	listener := pq.NewListener(b.dbURL, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			b.logger.WarnContext(ctx, "report events listener", slog.Any("error", err))
+		}
+	})
+	// Listen waits for the first connection, closing the listener is the only way to stop it
+	stop := context.AfterFunc(ctx, func() { listener.Close() })
+	defer stop()
+	defer listener.Close()
+	if err := listener.Listen(ReportEventsChannel); err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return fmt.Errorf("failed to listen on %s: %w", ReportEventsChannel, err)
+	}
+	ticker := time.NewTicker(90 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case notification, ok := <-listener.Notify:
+			if !ok {
+				return nil
+			}
+			// nil after the connection was re-established
+			if notification == nil {
+				b.resync()
+				continue
+			}
+			var event ReportEvent
+			if err := json.Unmarshal([]byte(notification.Extra), &event); err != nil {
+				b.logger.WarnContext(ctx, "invalid report event", slog.String("payload", notification.Extra), slog.Any("error", err))
+				continue
+			}
+			b.Publish(event)
+		case <-ticker.C:
+			// detect a dead connection while no notification arrives
+			go listener.Ping()
+		}
+	}
+}
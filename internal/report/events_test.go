@@ -0,0 +1,68 @@
+package report_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/leetcode-golang-classroom/golang-async-api/internal/report"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteEvent(t *testing.T) {
+	reportID := uuid.MustParse("9a0f4c5e-3f7c-4b6a-9d8e-1a2b3c4d5e6f")
+	var buffer bytes.Buffer
+	require.NoError(t, report.WriteEvent(&buffer, "progress", &report.ApiReportEvent{
+		ReportID: reportID,
+		Status:   report.EventProgress,
+		Stage:    report.StageEncoding,
+	}))
+	assert.Equal(t, "event: progress\ndata: {\"report_id\":\"9a0f4c5e-3f7c-4b6a-9d8e-1a2b3c4d5e6f\",\"status\":\"progress\",\"stage\":\"encoding\"}\n\n", buffer.String())
+}
+
+func TestEventBroker(t *testing.T) {
+	broker := report.NewEventBroker("", slog.Default())
+	reportID := uuid.New()
+	events, unsubscribe := broker.Subscribe(reportID)
+	otherEvents, unsubscribeOther := broker.Subscribe(uuid.New())
+	defer unsubscribeOther()
+
+	event := report.ReportEvent{ReportID: reportID, Status: "processing"}
+	broker.Publish(event)
+	select {
+	case received := <-events:
+		assert.Equal(t, event, received)
+	case <-time.After(time.Second):
+		t.Fatal("event was not delivered")
+	}
+	select {
+	case <-otherEvents:
+		t.Fatal("event delivered to the subscriber of another report")
+	default:
+	}
+
+	unsubscribe()
+	unsubscribe()
+	_, ok := <-events
+	assert.False(t, ok)
+	// publishing without subscribers is a no-op
+	broker.Publish(event)
+
+	t.Run("closed once stopped", func(t *testing.T) {
+		broker := report.NewEventBroker("postgres://127.0.0.1:1/none?sslmode=disable&connect_timeout=1", slog.Default())
+		events, unsubscribe := broker.Subscribe(reportID)
+		defer unsubscribe()
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		broker.Start(ctx)
+		_, ok := <-events
+		assert.False(t, ok)
+		events, _ = broker.Subscribe(reportID)
+		_, ok = <-events
+		assert.False(t, ok)
+	})
+}
@@ -0,0 +1,316 @@
+package report
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/google/uuid"
+	"github.com/klauspost/compress/zstd"
+	"github.com/parquet-go/parquet-go"
+	"github.com/xuri/excelize/v2"
+)
+
+// OutputFormat - file format of the generated report
+type OutputFormat string
+
+const (
+	FormatCSV     OutputFormat = "csv"
+	FormatNDJSON  OutputFormat = "ndjson"
+	FormatJSON    OutputFormat = "json"
+	FormatXLSX    OutputFormat = "xlsx"
+	FormatParquet OutputFormat = "parquet"
+)
+
+// Compression - compression applied on top of the output format
+type Compression string
+
+const (
+	CompressionGzip Compression = "gzip"
+	CompressionZstd Compression = "zstd"
+	CompressionNone Compression = "none"
+)
+
+// Extension - file extension of the format
+func (f OutputFormat) Extension() string {
+	return string(f)
+}
+
+// ContentType - mime type stored as blob metadata
+func (f OutputFormat) ContentType() string {
+	switch f {
+	case FormatCSV:
+		return "text/csv"
+	case FormatNDJSON:
+		return "application/x-ndjson"
+	case FormatJSON:
+		return "application/json"
+	case FormatXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	case FormatParquet:
+		return "application/vnd.apache.parquet"
+	}
+	return "application/octet-stream"
+}
+
+// DefaultCompression - text formats are gzipped, binary formats already compress their content
+func (f OutputFormat) DefaultCompression() Compression {
+	switch f {
+	case FormatXLSX, FormatParquet:
+		return CompressionNone
+	}
+	return CompressionGzip
+}
+
+// Extension - file extension suffix of the compression, empty for none
+func (c Compression) Extension() string {
+	switch c {
+	case CompressionGzip:
+		return ".gz"
+	case CompressionZstd:
+		return ".zst"
+	}
+	return ""
+}
+
+// ContentEncoding - content encoding stored as blob metadata, empty for none
+func (c Compression) ContentEncoding() string {
+	switch c {
+	case CompressionGzip:
+		return "gzip"
+	case CompressionZstd:
+		return "zstd"
+	}
+	return ""
+}
+
+// ObjectKey - blob key of the generated report file
+func ObjectKey(userID uuid.UUID, reportID uuid.UUID, format OutputFormat, compression Compression) string {
+	return fmt.Sprintf("/users/%s/report/%s.%s%s", userID, reportID, format.Extension(), compression.Extension())
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// NewCompressWriter - wrap w with the compression writer, Close must be called to flush
+func NewCompressWriter(w io.Writer, compression Compression) (io.WriteCloser, error) {
+	switch compression {
+	case CompressionGzip:
+		return gzip.NewWriter(w), nil
+	case CompressionZstd:
+		zstdWriter, err := zstd.NewWriter(w)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create zstd writer: %w", err)
+		}
+		return zstdWriter, nil
+	case CompressionNone:
+		return nopWriteCloser{w}, nil
+	}
+	return nil, fmt.Errorf("unsupported compression %q", compression)
+}
+
+// EncodeReport - write header and rows into w with format
+func EncodeReport(w io.Writer, format OutputFormat, columns []string, rows []Row) error {
+	switch format {
+	case FormatCSV:
+		return encodeCSV(w, columns, rows)
+	case FormatNDJSON:
+		return encodeNDJSON(w, columns, rows)
+	case FormatJSON:
+		return encodeJSON(w, columns, rows)
+	case FormatXLSX:
+		return encodeXLSX(w, columns, rows)
+	case FormatParquet:
+		return encodeParquet(w, columns, rows)
+	}
+	return fmt.Errorf("unsupported output format %q", format)
+}
+
+func encodeCSV(w io.Writer, columns []string, rows []Row) error {
+	csvWriter := csv.NewWriter(w)
+	if err := csvWriter.Write(columns); err != nil {
+		return fmt.Errorf("failed to write csv header: %w", err)
+	}
+	for _, row := range rows {
+		csvRow := make([]string, 0, len(columns))
+		for _, column := range columns {
+			csvRow = append(csvRow, FormatValue(row[column]))
+		}
+		if err := csvWriter.Write(csvRow); err != nil {
+			return fmt.Errorf("failed to write csv row: %w", err)
+		}
+	}
+	csvWriter.Flush()
+	if err := csvWriter.Error(); err != nil {
+		return fmt.Errorf("failed to flush csv writer: %w", err)
+	}
+	return nil
+}
+
+// marshalRow - encode row as json object keeping the column order
+func marshalRow(columns []string, row Row) ([]byte, error) {
+	var buffer bytes.Buffer
+	buffer.WriteByte('{')
+	for i, column := range columns {
+		if i > 0 {
+			buffer.WriteByte(',')
+		}
+		key, err := json.Marshal(column)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(row[column])
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal column %s: %w", column, err)
+		}
+		buffer.Write(key)
+		buffer.WriteByte(':')
+		buffer.Write(value)
+	}
+	buffer.WriteByte('}')
+	return buffer.Bytes(), nil
+}
+
+func encodeNDJSON(w io.Writer, columns []string, rows []Row) error {
+	for _, row := range rows {
+		line, err := marshalRow(columns, row)
+		if err != nil {
+			return fmt.Errorf("failed to write ndjson row: %w", err)
+		}
+		line = append(line, '\n')
+		if _, err := w.Write(line); err != nil {
+			return fmt.Errorf("failed to write ndjson row: %w", err)
+		}
+	}
+	return nil
+}
+
+func encodeJSON(w io.Writer, columns []string, rows []Row) error {
+	var buffer bytes.Buffer
+	buffer.WriteByte('[')
+	for i, row := range rows {
+		if i > 0 {
+			buffer.WriteByte(',')
+		}
+		object, err := marshalRow(columns, row)
+		if err != nil {
+			return fmt.Errorf("failed to write json row: %w", err)
+		}
+		buffer.Write(object)
+	}
+	buffer.WriteByte(']')
+	var pretty bytes.Buffer
+	if err := json.Indent(&pretty, buffer.Bytes(), "", "  "); err != nil {
+		return fmt.Errorf("failed to indent json: %w", err)
+	}
+	pretty.WriteByte('\n')
+	if _, err := w.Write(pretty.Bytes()); err != nil {
+		return fmt.Errorf("failed to write json: %w", err)
+	}
+	return nil
+}
+
+func encodeXLSX(w io.Writer, columns []string, rows []Row) error {
+	file := excelize.NewFile()
+	defer file.Close()
+	sheet := file.GetSheetName(file.GetActiveSheetIndex())
+	streamWriter, err := file.NewStreamWriter(sheet)
+	if err != nil {
+		return fmt.Errorf("failed to create xlsx stream writer: %w", err)
+	}
+	header := make([]any, 0, len(columns))
+	for _, column := range columns {
+		header = append(header, column)
+	}
+	if err := streamWriter.SetRow("A1", header); err != nil {
+		return fmt.Errorf("failed to write xlsx header: %w", err)
+	}
+	for i, row := range rows {
+		cells := make([]any, 0, len(columns))
+		for _, column := range columns {
+			switch value := row[column].(type) {
+			case string, bool, int, int32, float64, nil:
+				cells = append(cells, value)
+			default:
+				cells = append(cells, FormatValue(value))
+			}
+		}
+		cell, err := excelize.CoordinatesToCellName(1, i+2)
+		if err != nil {
+			return fmt.Errorf("failed to locate xlsx row: %w", err)
+		}
+		if err := streamWriter.SetRow(cell, cells); err != nil {
+			return fmt.Errorf("failed to write xlsx row: %w", err)
+		}
+	}
+	if err := streamWriter.Flush(); err != nil {
+		return fmt.Errorf("failed to flush xlsx stream writer: %w", err)
+	}
+	if err := file.Write(w); err != nil {
+		return fmt.Errorf("failed to write xlsx: %w", err)
+	}
+	return nil
+}
+
+// parquetNode - infer parquet column type from the first non nil value of column
+func parquetNode(column string, rows []Row) parquet.Node {
+	for _, row := range rows {
+		switch row[column].(type) {
+		case nil:
+			continue
+		case bool:
+			return parquet.Optional(parquet.Leaf(parquet.BooleanType))
+		case int32:
+			return parquet.Optional(parquet.Int(32))
+		case int:
+			return parquet.Optional(parquet.Int(64))
+		case float64:
+			return parquet.Optional(parquet.Leaf(parquet.DoubleType))
+		case []string:
+			return parquet.List(parquet.String())
+		default:
+			return parquet.Optional(parquet.String())
+		}
+	}
+	return parquet.Optional(parquet.String())
+}
+
+func encodeParquet(w io.Writer, columns []string, rows []Row) error {
+	group := parquet.Group{}
+	for _, column := range columns {
+		group[column] = parquetNode(column, rows)
+	}
+	schema := parquet.NewSchema("report", group)
+	parquetWriter := parquet.NewWriter(w, schema)
+	for _, row := range rows {
+		record := make(map[string]any, len(columns))
+		for _, column := range columns {
+			value := row[column]
+			if !isParquetNative(value) {
+				value = FormatValue(value)
+			}
+			record[column] = value
+		}
+		if err := parquetWriter.Write(record); err != nil {
+			return fmt.Errorf("failed to write parquet row: %w", err)
+		}
+	}
+	if err := parquetWriter.Close(); err != nil {
+		return fmt.Errorf("failed to close parquet writer: %w", err)
+	}
+	return nil
+}
+
+func isParquetNative(value any) bool {
+	switch value.(type) {
+	case nil, string, bool, int32, int, float64, []string:
+		return true
+	}
+	return false
+}
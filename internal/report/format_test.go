@@ -0,0 +1,113 @@
+package report_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/klauspost/compress/zstd"
+	"github.com/leetcode-golang-classroom/golang-async-api/internal/report"
+	"github.com/parquet-go/parquet-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xuri/excelize/v2"
+)
+
+var (
+	testColumns = []string{"name", "id", "drops", "dlc"}
+	testRows    = []report.Row{
+		{"name": "bokoblin", "id": int32(1), "drops": []string{"horn", "fang"}, "dlc": false},
+		{"name": "lynel", "id": int32(2), "drops": []string{"hoof"}, "dlc": true},
+	}
+)
+
+func encode(t *testing.T, format report.OutputFormat, compression report.Compression) []byte {
+	t.Helper()
+	var buffer bytes.Buffer
+	compressWriter, err := report.NewCompressWriter(&buffer, compression)
+	require.NoError(t, err)
+	require.NoError(t, report.EncodeReport(compressWriter, format, testColumns, testRows))
+	require.NoError(t, compressWriter.Close())
+	return buffer.Bytes()
+}
+
+func TestEncodeReport(t *testing.T) {
+	t.Run("gzip csv", func(t *testing.T) {
+		gzipReader, err := gzip.NewReader(bytes.NewReader(encode(t, report.FormatCSV, report.CompressionGzip)))
+		require.NoError(t, err)
+		content, err := io.ReadAll(gzipReader)
+		require.NoError(t, err)
+		assert.Equal(t, "name,id,drops,dlc\nbokoblin,1,\"horn, fang\",false\nlynel,2,hoof,true\n", string(content))
+	})
+
+	t.Run("zstd ndjson", func(t *testing.T) {
+		zstdReader, err := zstd.NewReader(bytes.NewReader(encode(t, report.FormatNDJSON, report.CompressionZstd)))
+		require.NoError(t, err)
+		defer zstdReader.Close()
+		content, err := io.ReadAll(zstdReader)
+		require.NoError(t, err)
+		lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+		require.Len(t, lines, 2)
+		assert.Equal(t, `{"name":"bokoblin","id":1,"drops":["horn","fang"],"dlc":false}`, lines[0])
+	})
+
+	t.Run("json", func(t *testing.T) {
+		var entries []map[string]any
+		require.NoError(t, json.Unmarshal(encode(t, report.FormatJSON, report.CompressionNone), &entries))
+		require.Len(t, entries, 2)
+		assert.Equal(t, "lynel", entries[1]["name"])
+		assert.Equal(t, true, entries[1]["dlc"])
+	})
+
+	t.Run("xlsx", func(t *testing.T) {
+		file, err := excelize.OpenReader(bytes.NewReader(encode(t, report.FormatXLSX, report.CompressionNone)))
+		require.NoError(t, err)
+		defer file.Close()
+		rows, err := file.GetRows(file.GetSheetName(file.GetActiveSheetIndex()))
+		require.NoError(t, err)
+		require.Len(t, rows, 3)
+		assert.Equal(t, testColumns, rows[0])
+		assert.Equal(t, []string{"bokoblin", "1", "horn, fang", "FALSE"}, rows[1])
+	})
+
+	t.Run("parquet", func(t *testing.T) {
+		content := encode(t, report.FormatParquet, report.CompressionNone)
+		file, err := parquet.OpenFile(bytes.NewReader(content), int64(len(content)))
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), file.NumRows())
+		fields := make([]string, 0, len(testColumns))
+		for _, field := range file.Schema().Fields() {
+			fields = append(fields, field.Name())
+		}
+		assert.ElementsMatch(t, testColumns, fields)
+	})
+
+	t.Run("unsupported format", func(t *testing.T) {
+		require.Error(t, report.EncodeReport(io.Discard, report.OutputFormat("pdf"), testColumns, testRows))
+	})
+}
+
+func TestObjectKey(t *testing.T) {
+	userID := uuid.New()
+	reportID := uuid.New()
+	assert.Equal(t, "/users/"+userID.String()+"/report/"+reportID.String()+".csv.gz",
+		report.ObjectKey(userID, reportID, report.FormatCSV, report.CompressionGzip))
+	assert.Equal(t, "/users/"+userID.String()+"/report/"+reportID.String()+".ndjson.zst",
+		report.ObjectKey(userID, reportID, report.FormatNDJSON, report.CompressionZstd))
+	assert.Equal(t, "/users/"+userID.String()+"/report/"+reportID.String()+".parquet",
+		report.ObjectKey(userID, reportID, report.FormatParquet, report.CompressionNone))
+}
+
+func TestReportOptionsWithDefaults(t *testing.T) {
+	options := report.CreateReportRequest{ReportType: "monsters"}.Options()
+	assert.Equal(t, report.GameTOTK, options.Game)
+	assert.Equal(t, report.FormatCSV, options.OutputFormat)
+	assert.Equal(t, report.CompressionGzip, options.Compression)
+
+	options = report.CreateReportRequest{ReportType: "monsters", OutputFormat: report.FormatXLSX}.Options()
+	assert.Equal(t, report.CompressionNone, options.Compression)
+}
@@ -0,0 +1,106 @@
+package report
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Row - one record of a generated report keyed by column name
+type Row map[string]any
+
+// ReportGenerator - produce the rows for one report type
+type ReportGenerator interface {
+	// Columns - the ordered header of the report
+	Columns() []string
+	// Generate - fetch the data and convert it into rows
+	Generate(ctx context.Context, lozClient *LozClient, game Game) ([]Row, error)
+}
+
+// GeneratorRegistry - named report generators that ReportBuilder dispatches on
+type GeneratorRegistry struct {
+	mu         sync.RWMutex
+	generators map[string]ReportGenerator
+}
+
+// NewGeneratorRegistry - create registry with the built-in compendium generators
+func NewGeneratorRegistry() *GeneratorRegistry {
+	registry := &GeneratorRegistry{
+		generators: make(map[string]ReportGenerator),
+	}
+	registry.Register("monsters", NewMonstersGenerator())
+	registry.Register("creatures", NewCreaturesGenerator())
+	registry.Register("equipment", NewEquipmentGenerator())
+	registry.Register("materials", NewMaterialsGenerator())
+	registry.Register("treasure", NewTreasureGenerator())
+	return registry
+}
+
+// Register - add or replace the generator for reportType
+func (r *GeneratorRegistry) Register(reportType string, generator ReportGenerator) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.generators[reportType] = generator
+}
+
+// Get - find the generator for reportType
+func (r *GeneratorRegistry) Get(reportType string) (ReportGenerator, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	generator, ok := r.generators[reportType]
+	return generator, ok
+}
+
+// Names - sorted list of registered report types
+func (r *GeneratorRegistry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.generators))
+	for name := range r.generators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Validate - check reportType is registered
+func (r *GeneratorRegistry) Validate(reportType string) error {
+	if _, ok := r.Get(reportType); !ok {
+		return fmt.Errorf("unknown report_type %q, valid types are: %s", reportType, strings.Join(r.Names(), ", "))
+	}
+	return nil
+}
+
+// ValidateParameters - check reportType is registered and parameters only reference its columns
+func (r *GeneratorRegistry) ValidateParameters(reportType string, parameters ReportParameters) error {
+	generator, ok := r.Get(reportType)
+	if !ok {
+		return r.Validate(reportType)
+	}
+	return parameters.Validate(generator.Columns())
+}
+
+// FormatValue - format row value as csv cell
+func FormatValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []string:
+		return strings.Join(v, ", ")
+	case bool:
+		return strconv.FormatBool(v)
+	case int32:
+		return strconv.FormatInt(int64(v), 10)
+	case int:
+		return strconv.Itoa(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
@@ -0,0 +1,74 @@
+package report_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/leetcode-golang-classroom/golang-async-api/internal/report"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeHTTPClient struct {
+	body     string
+	requests []*http.Request
+}
+
+func (c *fakeHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	c.requests = append(c.requests, req)
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(strings.NewReader(c.body)),
+	}, nil
+}
+
+type staticGenerator struct{}
+
+func (staticGenerator) Columns() []string {
+	return []string{"name"}
+}
+
+func (staticGenerator) Generate(ctx context.Context, lozClient *report.LozClient, game report.Game) ([]report.Row, error) {
+	return []report.Row{{"name": "hyrule"}}, nil
+}
+
+func TestGeneratorRegistry(t *testing.T) {
+	registry := report.NewGeneratorRegistry()
+	assert.Equal(t, []string{"creatures", "equipment", "materials", "monsters", "treasure"}, registry.Names())
+
+	require.NoError(t, registry.Validate("monsters"))
+	err := registry.Validate("food")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "creatures, equipment, materials, monsters, treasure")
+
+	registry.Register("static", staticGenerator{})
+	require.NoError(t, registry.Validate("static"))
+	generator, ok := registry.Get("static")
+	require.True(t, ok)
+	rows, err := generator.Generate(context.Background(), nil, report.DefaultGame)
+	require.NoError(t, err)
+	assert.Equal(t, "hyrule", rows[0]["name"])
+}
+
+func TestCompendiumGenerator(t *testing.T) {
+	httpClient := &fakeHTTPClient{
+		body: `{"data":[{"name":"horse","id":1,"category":"creatures","common_locations":["Hyrule Field"],"drops":["raw meat","hide"],"dlc":true}]}`,
+	}
+	lozClient := report.NewClient(httpClient)
+	generator, ok := report.NewGeneratorRegistry().Get("creatures")
+	require.True(t, ok)
+
+	rows, err := generator.Generate(context.Background(), lozClient, report.GameBOTW)
+	require.NoError(t, err)
+	require.Len(t, rows, 1)
+	require.Len(t, httpClient.requests, 1)
+	assert.Equal(t, "/api/v3/compendium/category/creatures", httpClient.requests[0].URL.Path)
+	assert.Equal(t, "botw", httpClient.requests[0].URL.Query().Get("game"))
+	assert.Equal(t, "horse", report.FormatValue(rows[0]["name"]))
+	assert.Equal(t, "1", report.FormatValue(rows[0]["id"]))
+	assert.Equal(t, "raw meat, hide", report.FormatValue(rows[0]["drops"]))
+	assert.Equal(t, "true", report.FormatValue(rows[0]["dlc"]))
+}
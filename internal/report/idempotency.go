@@ -0,0 +1,127 @@
+package report
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	// IdempotencyKeyHeader - header that makes POST /reports safe to retry
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader - set on responses replayed for a known Idempotency-Key
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+	// DefaultIdempotencyKeyTTL - how long a key is remembered when IDEMPOTENCY_KEY_TTL is not set
+	DefaultIdempotencyKeyTTL = 24 * time.Hour
+	maxIdempotencyKeyLength  = 255
+)
+
+// ErrIdempotencyKeyReused - the key was already used with a different request
+var ErrIdempotencyKeyReused = errors.New("idempotency key was already used with a different request")
+
+// IdempotencyKey - stored response of the first request sent with a key
+type IdempotencyKey struct {
+	UserID         uuid.UUID `db:"user_id"`
+	Key            string    `db:"key"`
+	RequestHash    string    `db:"request_hash"`
+	ResponseStatus int       `db:"response_status"`
+	ResponseBody   []byte    `db:"response_body"`
+	CreatedAt      time.Time `db:"created_at"`
+	ExpiresAt      time.Time `db:"expires_at"`
+}
+
+// IdempotentRequest - key sent by the client and the hash of the request it guards
+type IdempotentRequest struct {
+	Key         string
+	RequestHash string
+	TTL         time.Duration
+}
+
+// ValidateIdempotencyKey - keys are 1 to 255 visible ascii characters
+func ValidateIdempotencyKey(key string) error {
+	if key == "" || len(key) > maxIdempotencyKeyLength {
+		return fmt.Errorf("%s must be between 1 and %d characters", IdempotencyKeyHeader, maxIdempotencyKeyLength)
+	}
+	for _, c := range key {
+		if c < 0x21 || c > 0x7e {
+			return fmt.Errorf("%s must only contain visible ascii characters", IdempotencyKeyHeader)
+		}
+	}
+	return nil
+}
+
+// RequestHash - hash of the decoded request, so retries that only differ in formatting match
+func (r CreateReportRequest) RequestHash() (string, error) {
+	body, err := json.Marshal(r)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal request: %w", err)
+	}
+	hash := sha256.Sum256(body)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// CreateIdempotent - Create guarded by an idempotency key. The first request creates the report and stores
+// its response, later requests with the same key get the stored response and replayed is true.
+// A concurrent request with the same key waits for the first one to commit. ErrIdempotencyKeyReused
+// when the key was used with a different request hash
+func (s *ReportStore) CreateIdempotent(ctx context.Context, userID uuid.UUID, reportType string, options ReportOptions,
+	request IdempotentRequest) (*IdempotencyKey, bool, error) {
+	const deleteExpiredStmt = `DELETE FROM idempotency_keys WHERE user_id = $1 AND expires_at < $2;`
+	const insertStmt = `
+INSERT INTO idempotency_keys(user_id, key, request_hash, response_status, response_body, expires_at)
+VALUES ($1, $2, $3, $4, $5, $6)
+ON CONFLICT (user_id, key) DO NOTHING
+RETURNING *;
+	`
+	var result IdempotencyKey
+	err := s.withTx(ctx, func(tx *sqlx.Tx) error {
+		now := time.Now().UTC()
+		// expired keys of the user are dropped here, there is no other cleanup
+		if _, err := tx.ExecContext(ctx, deleteExpiredStmt, userID, now); err != nil {
+			return fmt.Errorf("failed to delete expired idempotency keys for user %s: %w", userID, err)
+		}
+		report, err := createReport(ctx, tx, userID, reportType, options)
+		if err != nil {
+			return err
+		}
+		body, err := json.Marshal(NewApiReport(report))
+		if err != nil {
+			return fmt.Errorf("failed to marshal report %s: %w", report.ID, err)
+		}
+		if err := tx.GetContext(ctx, &result, insertStmt, userID, request.Key, request.RequestHash,
+			http.StatusCreated, body, now.Add(request.TTL)); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				// the key is known, the report created above is rolled back
+				return errKeyExists
+			}
+			return fmt.Errorf("failed to insert idempotency key for user %s: %w", userID, err)
+		}
+		return nil
+	})
+	if errors.Is(err, errKeyExists) {
+		const selectStmt = `SELECT * FROM idempotency_keys WHERE user_id = $1 AND key = $2;`
+		if err := s.db.GetContext(ctx, &result, selectStmt, userID, request.Key); err != nil {
+			return nil, false, fmt.Errorf("failed to get idempotency key for user %s: %w", userID, err)
+		}
+		if result.RequestHash != request.RequestHash {
+			return nil, false, ErrIdempotencyKeyReused
+		}
+		return &result, true, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return &result, false, nil
+}
+
+// errKeyExists - rolls back the transaction of CreateIdempotent when the key is already stored
+var errKeyExists = errors.New("idempotency key exists")
@@ -0,0 +1,313 @@
+package report
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/config"
+	"github.com/leetcode-golang-classroom/golang-async-api/internal/webhook"
+)
+
+// ErrLeaseLost - cause of the build context when another worker took over the report
+var ErrLeaseLost = errors.New("report lease lost")
+
+// DefaultMaxAttempts - attempts since the last retry after which a stale report is failed instead of re-queued
+const DefaultMaxAttempts = 3
+
+// Claim - take the lease of a report that is not started yet or whose lease expired,
+// sql.ErrNoRows when it is done or leased by another worker
+func (s *ReportStore) Claim(ctx context.Context, userID uuid.UUID, id uuid.UUID, workerID string, leaseDuration time.Duration) (*Report, error) {
+	const prepareStmt = `
+UPDATE reports
+SET started_at = $3,
+    worker_id = $4,
+    lease_expires_at = $5
+WHERE user_id = $1 AND id = $2
+  AND cancelled_at IS NULL AND completed_at IS NULL AND failed_at IS NULL
+  AND (started_at IS NULL OR lease_expires_at IS NULL OR lease_expires_at < $3)
+RETURNING *;
+	`
+	now := time.Now().UTC()
+	var report Report
+	err := s.withTx(ctx, func(tx *sqlx.Tx) error {
+		if err := tx.GetContext(ctx, &report, prepareStmt, userID, id, now, workerID, now.Add(leaseDuration)); err != nil {
+			return fmt.Errorf("failed to claim report %s for user %s: %w", id, userID, err)
+		}
+		return notifyStatus(ctx, tx, &report)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// RenewLease - extend the lease held by workerID, sql.ErrNoRows when the lease was lost
+func (s *ReportStore) RenewLease(ctx context.Context, userID uuid.UUID, id uuid.UUID, workerID string, leaseDuration time.Duration) error {
+	const prepareStmt = `
+UPDATE reports
+SET lease_expires_at = $4
+WHERE user_id = $1 AND id = $2 AND worker_id = $3
+  AND cancelled_at IS NULL AND completed_at IS NULL AND failed_at IS NULL
+RETURNING id;
+	`
+	var reportID uuid.UUID
+	if err := s.db.GetContext(ctx, &reportID, prepareStmt, userID, id, workerID, time.Now().UTC().Add(leaseDuration)); err != nil {
+		return fmt.Errorf("failed to renew lease of report %s for user %s: %w", id, userID, err)
+	}
+	return nil
+}
+
+// ReleaseLease - give up the lease held by workerID so the report could be claimed right away,
+// sql.ErrNoRows when the lease is not held by workerID
+func (s *ReportStore) ReleaseLease(ctx context.Context, userID uuid.UUID, id uuid.UUID, workerID string) error {
+	const prepareStmt = `
+UPDATE reports
+SET started_at = NULL,
+    worker_id = NULL,
+    lease_expires_at = NULL
+WHERE user_id = $1 AND id = $2 AND worker_id = $3
+  AND cancelled_at IS NULL AND completed_at IS NULL AND failed_at IS NULL
+RETURNING id;
+	`
+	var reportID uuid.UUID
+	if err := s.db.GetContext(ctx, &reportID, prepareStmt, userID, id, workerID); err != nil {
+		return fmt.Errorf("failed to release lease of report %s for user %s: %w", id, userID, err)
+	}
+	return nil
+}
+
+// Complete - record the artifact of a report built under the lease of workerID, ErrLeaseLost when the lease
+// expired or was taken over so the artifact of the new owner is never overwritten, ErrReportCancelled when
+// the report was cancelled and sql.ErrNoRows when it was deleted in the meantime
+func (s *ReportStore) Complete(ctx context.Context, report *Report, workerID string) (*Report, error) {
+	const prepareStmt = `
+UPDATE reports
+SET output_file_path = $4,
+    reused_from = $5,
+    completed_at = $6
+WHERE user_id = $1 AND id = $2 AND worker_id = $3 AND lease_expires_at > $6
+  AND cancelled_at IS NULL AND completed_at IS NULL AND failed_at IS NULL
+RETURNING *;
+	`
+	return s.finishLeased(ctx, report, "complete", prepareStmt, report.UserID, report.ID, workerID,
+		report.OutputFilePath, report.ReusedFrom, time.Now().UTC())
+}
+
+// Fail - record the failure of a report built under the lease of workerID, errors are the ones of Complete
+func (s *ReportStore) Fail(ctx context.Context, report *Report, workerID string, errorMessage string) (*Report, error) {
+	const prepareStmt = `
+UPDATE reports
+SET error_message = $4,
+    failed_at = $5
+WHERE user_id = $1 AND id = $2 AND worker_id = $3 AND lease_expires_at > $5
+  AND cancelled_at IS NULL AND completed_at IS NULL AND failed_at IS NULL
+RETURNING *;
+	`
+	return s.finishLeased(ctx, report, "fail", prepareStmt, report.UserID, report.ID, workerID,
+		errorMessage, time.Now().UTC())
+}
+
+// finishLeased - run the completion or failure prepareStmt of Complete and Fail
+func (s *ReportStore) finishLeased(ctx context.Context, report *Report, action string, prepareStmt string, args ...any) (*Report, error) {
+	var result Report
+	err := s.withTx(ctx, func(tx *sqlx.Tx) error {
+		if err := tx.GetContext(ctx, &result, prepareStmt, args...); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				err = leaseLostCause(ctx, tx, report)
+			}
+			return fmt.Errorf("failed to %s report %s for user %s: %w", action, report.ID, report.UserID, err)
+		}
+		return notifyStatus(ctx, tx, &result)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// leaseLostCause - why report could not be completed or failed by its worker
+func leaseLostCause(ctx context.Context, tx *sqlx.Tx, report *Report) error {
+	const prepareStmt = `SELECT cancelled_at IS NOT NULL FROM reports WHERE user_id = $1 AND id = $2;`
+	var cancelled bool
+	if err := tx.GetContext(ctx, &cancelled, prepareStmt, report.UserID, report.ID); err != nil {
+		return err
+	}
+	if cancelled {
+		return ErrReportCancelled
+	}
+	return ErrLeaseLost
+}
+
+// StaleReports - running reports whose lease expired before staleBefore
+func (s *ReportStore) StaleReports(ctx context.Context, staleBefore time.Time, limit int) ([]Report, error) {
+	const prepareStmt = `
+SELECT * FROM reports
+WHERE started_at IS NOT NULL AND lease_expires_at < $1
+  AND cancelled_at IS NULL AND completed_at IS NULL AND failed_at IS NULL
+ORDER BY lease_expires_at
+LIMIT $2;
+	`
+	var reports []Report
+	if err := s.db.SelectContext(ctx, &reports, prepareStmt, staleBefore.UTC(), limit); err != nil {
+		return nil, fmt.Errorf("failed to query stale reports: %w", err)
+	}
+	return reports, nil
+}
+
+// Requeue - release a stale lease and enqueue the report again, sql.ErrNoRows when it is no longer stale
+func (s *ReportStore) Requeue(ctx context.Context, report *Report, staleBefore time.Time) (*Report, error) {
+	const prepareStmt = `
+UPDATE reports
+SET started_at = NULL,
+    worker_id = NULL,
+    lease_expires_at = NULL
+WHERE user_id = $1 AND id = $2 AND lease_expires_at < $3
+  AND cancelled_at IS NULL AND completed_at IS NULL AND failed_at IS NULL
+RETURNING *;
+	`
+	var result Report
+	err := s.withTx(ctx, func(tx *sqlx.Tx) error {
+		if err := tx.GetContext(ctx, &result, prepareStmt, report.UserID, report.ID, staleBefore.UTC()); err != nil {
+			return fmt.Errorf("failed to requeue report %s for user %s: %w", report.ID, report.UserID, err)
+		}
+		if err := notifyStatus(ctx, tx, &result); err != nil {
+			return err
+		}
+		return insertOutbox(ctx, tx, &result)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// FailStale - fail a report whose lease is stale, sql.ErrNoRows when it is no longer stale
+func (s *ReportStore) FailStale(ctx context.Context, report *Report, staleBefore time.Time, errorMessage string) (*Report, error) {
+	const prepareStmt = `
+UPDATE reports
+SET failed_at = $4,
+    error_message = $5
+WHERE user_id = $1 AND id = $2 AND lease_expires_at < $3
+  AND cancelled_at IS NULL AND completed_at IS NULL AND failed_at IS NULL
+RETURNING *;
+	`
+	var result Report
+	err := s.withTx(ctx, func(tx *sqlx.Tx) error {
+		if err := tx.GetContext(ctx, &result, prepareStmt, report.UserID, report.ID, staleBefore.UTC(),
+			time.Now().UTC(), errorMessage); err != nil {
+			return fmt.Errorf("failed to fail report %s for user %s: %w", report.ID, report.UserID, err)
+		}
+		return notifyStatus(ctx, tx, &result)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// AbandonAttempts - finish attempts of report left open by a crashed worker
+func (s *ReportStore) AbandonAttempts(ctx context.Context, userID uuid.UUID, reportID uuid.UUID, errorMessage string) error {
+	const prepareStmt = `
+UPDATE report_attempts
+SET finished_at = $3, error_message = $4
+WHERE user_id = $1 AND report_id = $2 AND finished_at IS NULL;
+	`
+	if _, err := s.db.ExecContext(ctx, prepareStmt, userID, reportID, time.Now().UTC(), errorMessage); err != nil {
+		return fmt.Errorf("failed to abandon attempts of report %s: %w", reportID, err)
+	}
+	return nil
+}
+
+// Reaper - re-queue or fail reports whose worker stopped renewing the lease
+type Reaper struct {
+	reportStore  *ReportStore
+	webhookStore *webhook.WebhookStore
+	logger       *slog.Logger
+	interval     time.Duration
+	staleAfter   time.Duration
+	maxAttempts  int
+}
+
+func NewReaper(
+	reportStore *ReportStore,
+	webhookStore *webhook.WebhookStore,
+	logger *slog.Logger,
+	workerConfig config.WorkerConfig,
+) *Reaper {
+	return &Reaper{
+		reportStore:  reportStore,
+		webhookStore: webhookStore,
+		logger:       logger,
+		interval:     workerConfig.ReaperInterval,
+		staleAfter:   workerConfig.StaleLeaseAfter,
+		maxAttempts:  DefaultMaxAttempts,
+	}
+}
+
+// Start - reap stale reports every interval until ctx is done
+func (r *Reaper) Start(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.Reap(ctx); err != nil {
+				r.logger.ErrorContext(ctx, "failed to reap stale reports", slog.Any("error", err))
+			}
+		}
+	}
+}
+
+// Reap - handle every report whose lease has been expired for longer than staleAfter
+func (r *Reaper) Reap(ctx context.Context) error {
+	staleBefore := time.Now().UTC().Add(-r.staleAfter)
+	reports, err := r.reportStore.StaleReports(ctx, staleBefore, 100)
+	if err != nil {
+		return err
+	}
+	for i := range reports {
+		report := &reports[i]
+		const abandonMessage = "worker lease expired"
+		if err := r.reportStore.AbandonAttempts(ctx, report.UserID, report.ID, abandonMessage); err != nil {
+			return err
+		}
+		// attempts before a retry by the user were already given up on
+		attempts, err := r.reportStore.AttemptsSinceRetry(ctx, report)
+		if err != nil {
+			return err
+		}
+		if attempts >= r.maxAttempts {
+			failed, err := r.reportStore.FailStale(ctx, report, staleBefore,
+				fmt.Sprintf("%s after %d attempts", abandonMessage, attempts))
+			if err != nil {
+				if errors.Is(err, sql.ErrNoRows) {
+					continue
+				}
+				return err
+			}
+			if err := EnqueueWebhooks(ctx, r.webhookStore, failed, NewApiReport(failed)); err != nil {
+				r.logger.ErrorContext(ctx, "failed to enqueue report webhooks", slog.Any("error", err))
+			}
+			r.logger.WarnContext(ctx, "failed stale report", slog.String("report_id", report.ID.String()),
+				slog.Int("attempts", attempts))
+			continue
+		}
+		if _, err := r.reportStore.Requeue(ctx, report, staleBefore); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				continue
+			}
+			return err
+		}
+		r.logger.InfoContext(ctx, "requeued stale report", slog.String("report_id", report.ID.String()),
+			slog.String("worker_id", report.WorkerID.String))
+	}
+	return nil
+}
@@ -1,13 +1,28 @@
 package report
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
+	"sync"
+	"time"
 )
 
 const BaseURL = "https://botw-compendium.herokuapp.com/api/v3/compendium"
 
+// Game - the compendium edition to query
+type Game string
+
+const (
+	GameBOTW Game = "botw"
+	GameTOTK Game = "totk"
+)
+
+// DefaultGame - game used when report request does not choose one
+const DefaultGame = GameTOTK
+
 type HTTPClient interface {
 	Do(*http.Request) (*http.Response, error)
 }
@@ -15,6 +30,7 @@ type HTTPClient interface {
 type LozClient struct {
 	baseURL    string
 	httpClient HTTPClient
+	monsters   *monstersCache
 }
 
 func NewClient(httpClient HTTPClient) *LozClient {
@@ -24,6 +40,75 @@ func NewClient(httpClient HTTPClient) *LozClient {
 	}
 }
 
+// WithMonstersCache - keep the GetMonsters response of each game for ttl, the cached response is shared
+// between callers and must not be modified
+func (c *LozClient) WithMonstersCache(ttl time.Duration) *LozClient {
+	c.monsters = &monstersCache{
+		ttl:     ttl,
+		entries: make(map[Game]*monstersCacheEntry),
+		calls:   make(map[Game]*monstersCall),
+	}
+	return c
+}
+
+// monstersCache - fetched monsters per game, concurrent misses of a game wait for a single fetch
+type monstersCache struct {
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[Game]*monstersCacheEntry
+	calls   map[Game]*monstersCall
+}
+
+type monstersCacheEntry struct {
+	response  *GetMonstersResponse
+	fetchedAt time.Time
+}
+
+// monstersCall - fetch in flight for a game, done is closed once response and err are set
+type monstersCall struct {
+	done     chan struct{}
+	response *GetMonstersResponse
+	err      error
+}
+
+// get - cached monsters of game, or the result of the fetch in flight for it; every caller
+// stops waiting when its own ctx is done, the fetch itself is not cancelled by any caller
+func (c *monstersCache) get(ctx context.Context, game Game,
+	fetch func(ctx context.Context) (*GetMonstersResponse, error)) (*GetMonstersResponse, error) {
+	c.mu.Lock()
+	if entry, ok := c.entries[game]; ok && time.Since(entry.fetchedAt) < c.ttl {
+		c.mu.Unlock()
+		return entry.response, nil
+	}
+	call, ok := c.calls[game]
+	if !ok {
+		call = &monstersCall{done: make(chan struct{})}
+		c.calls[game] = call
+		go c.fetch(context.WithoutCancel(ctx), game, call, fetch)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.response, call.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *monstersCache) fetch(ctx context.Context, game Game, call *monstersCall,
+	fetch func(ctx context.Context) (*GetMonstersResponse, error)) {
+	call.response, call.err = fetch(ctx)
+	c.mu.Lock()
+	// failed fetches are not cached
+	if call.err == nil {
+		c.entries[game] = &monstersCacheEntry{response: call.response, fetchedAt: time.Now()}
+	}
+	delete(c.calls, game)
+	c.mu.Unlock()
+	close(call.done)
+}
+
 type Monster struct {
 	Name            string   `json:"name"`
 	ID              int32    `json:"id"`
@@ -38,25 +123,191 @@ type GetMonstersResponse struct {
 	Data []Monster `json:"data"`
 }
 
-func (c *LozClient) GetMonsters() (*GetMonstersResponse, error) {
-	req, err := http.NewRequest("GET", fmt.Sprintf("%s/category/monsters", c.baseURL), nil)
+type Creature struct {
+	Name            string   `json:"name"`
+	ID              int32    `json:"id"`
+	Category        string   `json:"category"`
+	Description     string   `json:"description"`
+	Image           string   `json:"image"`
+	CommonLocations []string `json:"common_locations"`
+	Drops           []string `json:"drops"`
+	Edible          bool     `json:"edible"`
+	CookingEffect   string   `json:"cooking_effect"`
+	HeartsRecovered float64  `json:"hearts_recovered"`
+	Dlc             bool     `json:"dlc"`
+}
+type GetCreaturesResponse struct {
+	Data []Creature `json:"data"`
+}
+
+type EquipmentProperties struct {
+	Attack  int32  `json:"attack"`
+	Defense int32  `json:"defense"`
+	Effect  string `json:"effect"`
+	Type    string `json:"type"`
+}
+type Equipment struct {
+	Name            string              `json:"name"`
+	ID              int32               `json:"id"`
+	Category        string              `json:"category"`
+	Description     string              `json:"description"`
+	Image           string              `json:"image"`
+	CommonLocations []string            `json:"common_locations"`
+	Properties      EquipmentProperties `json:"properties"`
+	Dlc             bool                `json:"dlc"`
+}
+type GetEquipmentResponse struct {
+	Data []Equipment `json:"data"`
+}
+
+type Material struct {
+	Name            string   `json:"name"`
+	ID              int32    `json:"id"`
+	Category        string   `json:"category"`
+	Description     string   `json:"description"`
+	Image           string   `json:"image"`
+	CommonLocations []string `json:"common_locations"`
+	CookingEffect   string   `json:"cooking_effect"`
+	HeartsRecovered float64  `json:"hearts_recovered"`
+	FuseAttackPower int32    `json:"fuse_attack_power"`
+	Dlc             bool     `json:"dlc"`
+}
+type GetMaterialsResponse struct {
+	Data []Material `json:"data"`
+}
+
+type Treasure struct {
+	Name            string   `json:"name"`
+	ID              int32    `json:"id"`
+	Category        string   `json:"category"`
+	Description     string   `json:"description"`
+	Image           string   `json:"image"`
+	CommonLocations []string `json:"common_locations"`
+	Drops           []string `json:"drops"`
+	Dlc             bool     `json:"dlc"`
+}
+type GetTreasureResponse struct {
+	Data []Treasure `json:"data"`
+}
+
+// Entry - single compendium entry of any category
+type Entry struct {
+	Name            string   `json:"name"`
+	ID              int32    `json:"id"`
+	Category        string   `json:"category"`
+	Description     string   `json:"description"`
+	Image           string   `json:"image"`
+	CommonLocations []string `json:"common_locations"`
+	Dlc             bool     `json:"dlc"`
+	raw             json.RawMessage
+}
+
+func (e *Entry) UnmarshalJSON(data []byte) error {
+	type entry Entry
+	var decoded entry
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	*e = Entry(decoded)
+	e.raw = append(json.RawMessage(nil), data...)
+	return nil
+}
+
+// Decode - decode the entry into its category struct, such as *Monster or *Equipment
+func (e *Entry) Decode(v any) error {
+	if err := json.Unmarshal(e.raw, v); err != nil {
+		return fmt.Errorf("failed to decode %s entry %d: %w", e.Category, e.ID, err)
+	}
+	return nil
+}
+
+type GetEntryResponse struct {
+	Data Entry `json:"data"`
+}
+
+func (c *LozClient) GetMonsters(ctx context.Context, game Game) (*GetMonstersResponse, error) {
+	fetch := func(ctx context.Context) (*GetMonstersResponse, error) {
+		var response GetMonstersResponse
+		if err := c.get(ctx, "/category/monsters", game, &response); err != nil {
+			return nil, err
+		}
+		return &response, nil
+	}
+	if c.monsters == nil {
+		return fetch(ctx)
+	}
+	if game == "" {
+		game = DefaultGame
+	}
+	return c.monsters.get(ctx, game, fetch)
+}
+
+func (c *LozClient) GetCreatures(ctx context.Context, game Game) (*GetCreaturesResponse, error) {
+	var response GetCreaturesResponse
+	if err := c.get(ctx, "/category/creatures", game, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+func (c *LozClient) GetEquipment(ctx context.Context, game Game) (*GetEquipmentResponse, error) {
+	var response GetEquipmentResponse
+	if err := c.get(ctx, "/category/equipment", game, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+func (c *LozClient) GetMaterials(ctx context.Context, game Game) (*GetMaterialsResponse, error) {
+	var response GetMaterialsResponse
+	if err := c.get(ctx, "/category/materials", game, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+func (c *LozClient) GetTreasure(ctx context.Context, game Game) (*GetTreasureResponse, error) {
+	var response GetTreasureResponse
+	if err := c.get(ctx, "/category/treasure", game, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// GetEntry - fetch single entry by id or by name
+func (c *LozClient) GetEntry(ctx context.Context, game Game, idOrName string) (*GetEntryResponse, error) {
+	var response GetEntryResponse
+	if err := c.get(ctx, fmt.Sprintf("/entry/%s", url.PathEscape(idOrName)), game, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+func (c *LozClient) get(ctx context.Context, path string, game Game, response any) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s%s", c.baseURL, path), nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create monsters request: %w", err)
+		return fmt.Errorf("failed to create %s request: %w", path, err)
 	}
 
+	if game == "" {
+		game = DefaultGame
+	}
 	reqURL := req.URL
 	queryParams := req.URL.Query()
-	queryParams.Set("game", "totk")
+	queryParams.Set("game", string(game))
 	reqURL.RawQuery = queryParams.Encode()
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to submit monsters http request: %w", err)
+		return fmt.Errorf("failed to submit %s http request: %w", path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d for %s http request", resp.StatusCode, path)
 	}
 
-	var response GetMonstersResponse
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal monsters http response: %w", err)
+	if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+		return fmt.Errorf("failed to unmarshal %s http response: %w", path, err)
 	}
-	return &response, nil
+	return nil
 }
@@ -0,0 +1,113 @@
+package report_test
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/leetcode-golang-classroom/golang-async-api/internal/report"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLozClientGetEntry(t *testing.T) {
+	httpClient := &fakeHTTPClient{
+		body: `{"data":{"name":"master sword","id":388,"category":"equipment","common_locations":null,"properties":{"attack":30,"defense":0,"effect":"","type":"sword"},"dlc":false}}`,
+	}
+	lozClient := report.NewClient(httpClient)
+
+	resp, err := lozClient.GetEntry(context.Background(), report.GameBOTW, "master sword")
+	require.NoError(t, err)
+	require.Len(t, httpClient.requests, 1)
+	assert.Equal(t, "/api/v3/compendium/entry/master sword", httpClient.requests[0].URL.Path)
+	assert.Equal(t, "botw", httpClient.requests[0].URL.Query().Get("game"))
+	assert.Equal(t, "equipment", resp.Data.Category)
+	assert.Equal(t, int32(388), resp.Data.ID)
+
+	var equipment report.Equipment
+	require.NoError(t, resp.Data.Decode(&equipment))
+	assert.Equal(t, int32(30), equipment.Properties.Attack)
+	assert.Equal(t, "sword", equipment.Properties.Type)
+}
+
+func TestLozClientDefaultGame(t *testing.T) {
+	httpClient := &fakeHTTPClient{
+		body: `{"data":[{"name":"bokoblin","id":1,"category":"monsters"}]}`,
+	}
+	lozClient := report.NewClient(httpClient)
+
+	resp, err := lozClient.GetMonsters(context.Background(), "")
+	require.NoError(t, err)
+	require.Len(t, resp.Data, 1)
+	assert.Equal(t, "totk", httpClient.requests[0].URL.Query().Get("game"))
+}
+
+func TestLozClientMonstersCache(t *testing.T) {
+	httpClient := &fakeHTTPClient{
+		body: `{"data":[{"name":"bokoblin","id":1,"category":"monsters"}]}`,
+	}
+	lozClient := report.NewClient(httpClient).WithMonstersCache(time.Minute)
+
+	first, err := lozClient.GetMonsters(context.Background(), "")
+	require.NoError(t, err)
+	second, err := lozClient.GetMonsters(context.Background(), report.GameTOTK)
+	require.NoError(t, err)
+	assert.Same(t, first, second)
+	require.Len(t, httpClient.requests, 1)
+
+	_, err = lozClient.GetMonsters(context.Background(), report.GameBOTW)
+	require.NoError(t, err)
+	require.Len(t, httpClient.requests, 2)
+	assert.Equal(t, "botw", httpClient.requests[1].URL.Query().Get("game"))
+}
+
+// blockingHTTPClient - fakeHTTPClient that answers once release is closed
+type blockingHTTPClient struct {
+	mu      sync.Mutex
+	client  fakeHTTPClient
+	release chan struct{}
+}
+
+func (c *blockingHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	<-c.release
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.client.Do(req)
+}
+
+func TestLozClientMonstersCacheWaiterCancelled(t *testing.T) {
+	httpClient := &blockingHTTPClient{
+		client:  fakeHTTPClient{body: `{"data":[{"name":"bokoblin","id":1,"category":"monsters"}]}`},
+		release: make(chan struct{}),
+	}
+	lozClient := report.NewClient(httpClient).WithMonstersCache(time.Minute)
+
+	// the first caller gives up while the fetch is in flight, the fetch still completes for the others
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := lozClient.GetMonsters(ctx, report.GameTOTK)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	type result struct {
+		response *report.GetMonstersResponse
+		err      error
+	}
+	results := make(chan result, 1)
+	go func() {
+		response, err := lozClient.GetMonsters(context.Background(), report.GameTOTK)
+		results <- result{response, err}
+	}()
+	close(httpClient.release)
+	waited := <-results
+	require.NoError(t, waited.err)
+	require.Len(t, waited.response.Data, 1)
+
+	cached, err := lozClient.GetMonsters(context.Background(), report.GameTOTK)
+	require.NoError(t, err)
+	assert.Same(t, waited.response, cached)
+	httpClient.mu.Lock()
+	defer httpClient.mu.Unlock()
+	assert.Len(t, httpClient.client.requests, 1)
+}
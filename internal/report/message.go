@@ -0,0 +1,28 @@
+package report
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/queue"
+)
+
+// QueueMessage - report job sent to the worker queue
+type QueueMessage struct {
+	UserID   uuid.UUID `json:"user_id"`
+	ReportID uuid.UUID `json:"report_id"`
+}
+
+// PublishMessage - send the report job to queue
+func PublishMessage(ctx context.Context, q queue.Queue, message QueueMessage) error {
+	bytes, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("failed to marshal queue message: %w", err)
+	}
+	if err := q.Publish(ctx, bytes); err != nil {
+		return fmt.Errorf("failed to publish report %s: %w", message.ReportID, err)
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+package report
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/queue"
+)
+
+// OutboxMessage - queue message written in the same transaction as the report change
+type OutboxMessage struct {
+	ID            int64          `db:"id"`
+	UserID        uuid.UUID      `db:"user_id"`
+	ReportID      uuid.UUID      `db:"report_id"`
+	Payload       []byte         `db:"payload"`
+	Attempts      int            `db:"attempts"`
+	LastError     sql.NullString `db:"last_error"`
+	CreatedAt     time.Time      `db:"created_at"`
+	NextAttemptAt time.Time      `db:"next_attempt_at"`
+	SentAt        sql.NullTime   `db:"sent_at"`
+}
+
+const (
+	// DefaultOutboxPollInterval - how often the relay looks for pending messages
+	DefaultOutboxPollInterval = time.Second
+	// DefaultOutboxBatchSize - messages claimed at once
+	DefaultOutboxBatchSize = 20
+	// DefaultOutboxMaxBackoff - upper bound of the delay between two publish attempts
+	DefaultOutboxMaxBackoff = 5 * time.Minute
+	outboxBaseBackoff       = time.Second
+	// outboxClaimLease - how long claimed messages are hidden from other relays, long enough to publish a batch
+	outboxClaimLease = time.Minute
+)
+
+// OutboxBackoff - delay before the next publish after attempts failed publishes, doubled per attempt
+func OutboxBackoff(attempts int) time.Duration {
+	backoff := outboxBaseBackoff
+	for i := 1; i < attempts && backoff < DefaultOutboxMaxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, DefaultOutboxMaxBackoff)
+}
+
+// withTx - run fn in a transaction, committed only when fn succeeds
+func (s *ReportStore) withTx(ctx context.Context, fn func(tx *sqlx.Tx) error) (err error) {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+	if err = fn(tx); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// insertOutbox - write the queue message of report within tx
+func insertOutbox(ctx context.Context, tx *sqlx.Tx, report *Report) error {
+	payload, err := json.Marshal(QueueMessage{
+		UserID:   report.UserID,
+		ReportID: report.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal outbox message: %w", err)
+	}
+	const prepareStmt = `INSERT INTO report_outbox(user_id, report_id, payload) VALUES ($1, $2, $3);`
+	if _, err := tx.ExecContext(ctx, prepareStmt, report.UserID, report.ID, payload); err != nil {
+		return fmt.Errorf("failed to insert outbox message for report %s: %w", report.ID, err)
+	}
+	return nil
+}
+
+// OutboxMessages - queue messages of report, oldest first
+func (s *ReportStore) OutboxMessages(ctx context.Context, userID uuid.UUID, reportID uuid.UUID) ([]OutboxMessage, error) {
+	const prepareStmt = `SELECT * FROM report_outbox WHERE user_id = $1 AND report_id = $2 ORDER BY id;`
+	var messages []OutboxMessage
+	if err := s.db.SelectContext(ctx, &messages, prepareStmt, userID, reportID); err != nil {
+		return nil, fmt.Errorf("failed to query outbox messages for report %s: %w", reportID, err)
+	}
+	return messages, nil
+}
+
+// PublishOutbox - publish up to limit pending messages that are due, a failed publish is retried after OutboxBackoff.
+// Messages are claimed in a short transaction that hides them from other relays for outboxClaimLease, SKIP LOCKED
+// lets several relays run side by side. Publishing happens outside any transaction and each result is recorded on
+// its own, so delivery is at least once: a message whose result could not be recorded is published again once the
+// claim runs out, the worker skips it since the report is already claimed or done. Returns the number of handled messages
+func (s *ReportStore) PublishOutbox(ctx context.Context, limit int, publish func(ctx context.Context, message QueueMessage) error) (int, error) {
+	const claimStmt = `
+UPDATE report_outbox SET next_attempt_at = $3
+WHERE id IN (
+  SELECT id FROM report_outbox
+  WHERE sent_at IS NULL AND next_attempt_at <= $1
+  ORDER BY next_attempt_at, id
+  LIMIT $2
+  FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+	`
+	now := time.Now().UTC()
+	var messages []OutboxMessage
+	if err := s.db.SelectContext(ctx, &messages, claimStmt, now, limit, now.Add(outboxClaimLease)); err != nil {
+		return 0, fmt.Errorf("failed to claim pending outbox messages: %w", err)
+	}
+	for i := range messages {
+		message := &messages[i]
+		var queueMessage QueueMessage
+		publishErr := json.Unmarshal(message.Payload, &queueMessage)
+		if publishErr == nil {
+			publishErr = publish(ctx, queueMessage)
+		}
+		now := time.Now().UTC()
+		if publishErr != nil {
+			const retryStmt = `UPDATE report_outbox SET attempts = attempts + 1, last_error = $2, next_attempt_at = $3 WHERE id = $1;`
+			if _, err := s.db.ExecContext(ctx, retryStmt, message.ID, errorMessage(publishErr),
+				now.Add(OutboxBackoff(message.Attempts+1))); err != nil {
+				return i, fmt.Errorf("failed to reschedule outbox message %d: %w", message.ID, err)
+			}
+			continue
+		}
+		const sentStmt = `UPDATE report_outbox SET attempts = attempts + 1, last_error = NULL, sent_at = $2 WHERE id = $1;`
+		if _, err := s.db.ExecContext(ctx, sentStmt, message.ID, now); err != nil {
+			return i, fmt.Errorf("failed to mark outbox message %d sent: %w", message.ID, err)
+		}
+	}
+	return len(messages), nil
+}
+
+// OutboxRelay - publish outbox messages to the worker queue
+type OutboxRelay struct {
+	reportStore *ReportStore
+	queue       queue.Queue
+	logger      *slog.Logger
+	interval    time.Duration
+	batchSize   int
+}
+
+func NewOutboxRelay(
+	reportStore *ReportStore,
+	queue queue.Queue,
+	logger *slog.Logger,
+) *OutboxRelay {
+	return &OutboxRelay{
+		reportStore: reportStore,
+		queue:       queue,
+		logger:      logger,
+		interval:    DefaultOutboxPollInterval,
+		batchSize:   DefaultOutboxBatchSize,
+	}
+}
+
+// Start - relay pending messages every interval until ctx is done
+func (r *OutboxRelay) Start(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.Relay(ctx); err != nil && ctx.Err() == nil {
+				r.logger.ErrorContext(ctx, "failed to relay outbox messages", slog.Any("error", err))
+			}
+		}
+	}
+}
+
+// Relay - publish batches until no due message is left
+func (r *OutboxRelay) Relay(ctx context.Context) error {
+	publish := func(ctx context.Context, message QueueMessage) error {
+		if err := PublishMessage(ctx, r.queue, message); err != nil {
+			r.logger.WarnContext(ctx, "failed to publish outbox message",
+				slog.String("report_id", message.ReportID.String()), slog.Any("error", err))
+			return err
+		}
+		return nil
+	}
+	for {
+		handled, err := r.reportStore.PublishOutbox(ctx, r.batchSize, publish)
+		if err != nil {
+			return err
+		}
+		if handled < r.batchSize {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,17 @@
+package report_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/leetcode-golang-classroom/golang-async-api/internal/report"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutboxBackoff(t *testing.T) {
+	assert.Equal(t, time.Second, report.OutboxBackoff(0))
+	assert.Equal(t, time.Second, report.OutboxBackoff(1))
+	assert.Equal(t, 2*time.Second, report.OutboxBackoff(2))
+	assert.Equal(t, 8*time.Second, report.OutboxBackoff(4))
+	assert.Equal(t, report.DefaultOutboxMaxBackoff, report.OutboxBackoff(100))
+}
@@ -0,0 +1,174 @@
+package report
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// ReportFilters - row filters applied before the report is written
+type ReportFilters struct {
+	Dlc              *bool  `json:"dlc,omitempty"`
+	Category         string `json:"category,omitempty"`
+	LocationContains string `json:"location_contains,omitempty"`
+	DropsContains    string `json:"drops_contains,omitempty"`
+}
+
+// ReportParameters - column selection, filters and sort key of a report,
+// sort key is a column name and a leading "-" sorts descending
+type ReportParameters struct {
+	Columns []string      `json:"columns,omitempty"`
+	Filters ReportFilters `json:"filters"`
+	Sort    string        `json:"sort,omitempty"`
+}
+
+// Value - store parameters as jsonb
+func (p ReportParameters) Value() (driver.Value, error) {
+	bytes, err := json.Marshal(p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal report parameters: %w", err)
+	}
+	return bytes, nil
+}
+
+// Scan - load parameters from jsonb
+func (p *ReportParameters) Scan(src any) error {
+	var bytes []byte
+	switch v := src.(type) {
+	case nil:
+		*p = ReportParameters{}
+		return nil
+	case []byte:
+		bytes = v
+	case string:
+		bytes = []byte(v)
+	default:
+		return fmt.Errorf("unsupported report parameters type %T", src)
+	}
+	if err := json.Unmarshal(bytes, p); err != nil {
+		return fmt.Errorf("failed to unmarshal report parameters: %w", err)
+	}
+	return nil
+}
+
+func (p ReportParameters) sortColumn() (string, bool) {
+	if column, ok := strings.CutPrefix(p.Sort, "-"); ok {
+		return column, true
+	}
+	return p.Sort, false
+}
+
+// Validate - check every referenced column exists in the report columns
+func (p ReportParameters) Validate(columns []string) error {
+	for _, column := range p.Columns {
+		if !slices.Contains(columns, column) {
+			return fmt.Errorf("unknown column %q, valid columns are: %s", column, strings.Join(columns, ", "))
+		}
+	}
+	if p.Sort != "" {
+		if column, _ := p.sortColumn(); !slices.Contains(columns, column) {
+			return fmt.Errorf("unknown sort column %q, valid columns are: %s", column, strings.Join(columns, ", "))
+		}
+	}
+	filterColumns := []struct {
+		column string
+		used   bool
+	}{
+		{"dlc", p.Filters.Dlc != nil},
+		{"category", p.Filters.Category != ""},
+		{"common_locations", p.Filters.LocationContains != ""},
+		{"drops", p.Filters.DropsContains != ""},
+	}
+	for _, filter := range filterColumns {
+		if filter.used && !slices.Contains(columns, filter.column) {
+			return fmt.Errorf("filter on %q is not supported by this report type", filter.column)
+		}
+	}
+	return nil
+}
+
+// Apply - filter and sort rows then select the requested columns
+func (p ReportParameters) Apply(columns []string, rows []Row) ([]string, []Row) {
+	filtered := make([]Row, 0, len(rows))
+	for _, row := range rows {
+		if p.Filters.match(row) {
+			filtered = append(filtered, row)
+		}
+	}
+	if p.Sort != "" {
+		column, descending := p.sortColumn()
+		sort.SliceStable(filtered, func(i, j int) bool {
+			if descending {
+				return lessValue(filtered[j][column], filtered[i][column])
+			}
+			return lessValue(filtered[i][column], filtered[j][column])
+		})
+	}
+	if len(p.Columns) > 0 {
+		columns = p.Columns
+	}
+	return columns, filtered
+}
+
+func (f ReportFilters) match(row Row) bool {
+	if f.Dlc != nil {
+		if dlc, ok := row["dlc"].(bool); !ok || dlc != *f.Dlc {
+			return false
+		}
+	}
+	if f.Category != "" && !strings.EqualFold(FormatValue(row["category"]), f.Category) {
+		return false
+	}
+	if f.LocationContains != "" && !containsFold(row["common_locations"], f.LocationContains) {
+		return false
+	}
+	if f.DropsContains != "" && !containsFold(row["drops"], f.DropsContains) {
+		return false
+	}
+	return true
+}
+
+// containsFold - any value of the list contains substr, case insensitive
+func containsFold(value any, substr string) bool {
+	substr = strings.ToLower(substr)
+	values, ok := value.([]string)
+	if !ok {
+		return strings.Contains(strings.ToLower(FormatValue(value)), substr)
+	}
+	for _, v := range values {
+		if strings.Contains(strings.ToLower(v), substr) {
+			return true
+		}
+	}
+	return false
+}
+
+// lessValue - compare numbers numerically and everything else as case insensitive text
+func lessValue(a, b any) bool {
+	if x, ok := toFloat(a); ok {
+		if y, ok := toFloat(b); ok {
+			return x < y
+		}
+	}
+	if x, ok := a.(bool); ok {
+		if y, ok := b.(bool); ok {
+			return !x && y
+		}
+	}
+	return strings.ToLower(FormatValue(a)) < strings.ToLower(FormatValue(b))
+}
+
+func toFloat(value any) (float64, bool) {
+	switch v := value.(type) {
+	case int32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
@@ -0,0 +1,73 @@
+package report_test
+
+import (
+	"testing"
+
+	"github.com/leetcode-golang-classroom/golang-async-api/internal/report"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReportParametersValidate(t *testing.T) {
+	columns := report.NewMonstersGenerator().Columns()
+	require.NoError(t, report.ReportParameters{
+		Columns: []string{"name", "drops"},
+		Sort:    "-id",
+	}.Validate(columns))
+
+	err := report.ReportParameters{Columns: []string{"name", "attack"}}.Validate(columns)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `unknown column "attack"`)
+
+	require.Error(t, report.ReportParameters{Sort: "-attack"}.Validate(columns))
+
+	equipmentColumns := report.NewEquipmentGenerator().Columns()
+	require.Error(t, report.ReportParameters{
+		Filters: report.ReportFilters{DropsContains: "horn"},
+	}.Validate(equipmentColumns))
+}
+
+func TestReportParametersApply(t *testing.T) {
+	dlc := false
+	rows := []report.Row{
+		{"name": "Lynel", "id": int32(3), "category": "monsters", "common_locations": []string{"Hyrule Field"}, "drops": []string{"Lynel Hoof"}, "dlc": false},
+		{"name": "bokoblin", "id": int32(1), "category": "monsters", "common_locations": []string{"Great Hyrule Forest"}, "drops": []string{"Bokoblin Horn"}, "dlc": false},
+		{"name": "Moblin", "id": int32(2), "category": "monsters", "common_locations": []string{"Hyrule Field"}, "drops": []string{"Moblin Horn"}, "dlc": false},
+		{"name": "Igneo Talus", "id": int32(10), "category": "monsters", "common_locations": []string{"Hyrule Field"}, "drops": []string{"Flint"}, "dlc": true},
+	}
+
+	columns, result := report.ReportParameters{
+		Columns: []string{"id", "name"},
+		Filters: report.ReportFilters{
+			Dlc:              &dlc,
+			LocationContains: "hyrule",
+			DropsContains:    "HORN",
+		},
+		Sort: "-id",
+	}.Apply(report.NewMonstersGenerator().Columns(), rows)
+	assert.Equal(t, []string{"id", "name"}, columns)
+	require.Len(t, result, 2)
+	assert.Equal(t, "Moblin", result[0]["name"])
+	assert.Equal(t, "bokoblin", result[1]["name"])
+
+	columns, result = report.ReportParameters{Sort: "name"}.Apply(report.NewMonstersGenerator().Columns(), rows)
+	assert.Equal(t, report.NewMonstersGenerator().Columns(), columns)
+	require.Len(t, result, 4)
+	assert.Equal(t, []any{"bokoblin", "Igneo Talus", "Lynel", "Moblin"},
+		[]any{result[0]["name"], result[1]["name"], result[2]["name"], result[3]["name"]})
+}
+
+func TestReportParametersScan(t *testing.T) {
+	dlc := true
+	parameters := report.ReportParameters{
+		Columns: []string{"name"},
+		Filters: report.ReportFilters{Dlc: &dlc, Category: "monsters"},
+		Sort:    "name",
+	}
+	value, err := parameters.Value()
+	require.NoError(t, err)
+
+	var scanned report.ReportParameters
+	require.NoError(t, scanned.Scan(value))
+	assert.Equal(t, parameters, scanned)
+}
@@ -1,14 +1,30 @@
 package report
 
 import (
+	"fmt"
+	"net/url"
+	"strconv"
 	"time"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/google/uuid"
+	"github.com/leetcode-golang-classroom/golang-async-api/internal/webhook"
 )
 
 type CreateReportRequest struct {
-	ReportType string `json:"report_type" validate:"required"`
+	ReportType   string        `json:"report_type" validate:"required"`
+	Game         Game          `json:"game" validate:"omitempty,oneof=botw totk"`
+	OutputFormat OutputFormat  `json:"output_format" validate:"omitempty,oneof=csv ndjson json xlsx parquet"`
+	Compression  Compression   `json:"compression" validate:"omitempty,oneof=gzip zstd none"`
+	Columns      []string      `json:"columns" validate:"omitempty,unique,dive,required"`
+	Filters      ReportFilters `json:"filters"`
+	Sort         string        `json:"sort"`
+	// WebhookURL - endpoint that receives the completion of this report in addition to the account webhooks
+	WebhookURL    string `json:"webhook_url" validate:"omitempty,http_url,max=2048"`
+	WebhookSecret string `json:"webhook_secret" validate:"required_with=WebhookURL,omitempty,min=16,max=255"`
+	// Reuse - point at the artifact of a recent completed report of the user with the same type and parameters
+	// instead of generating it again
+	Reuse bool `json:"reuse"`
 }
 
 func (r CreateReportRequest) Validate(validator *validator.Validate) error {
@@ -16,19 +32,205 @@ func (r CreateReportRequest) Validate(validator *validator.Validate) error {
 	if err != nil {
 		return err
 	}
+	if r.WebhookURL != "" {
+		return webhook.ValidateURL(r.WebhookURL)
+	}
 	return nil
 }
 
+// Options - report options with defaults applied
+func (r CreateReportRequest) Options() ReportOptions {
+	options := ReportOptions{
+		Game:         r.Game,
+		OutputFormat: r.OutputFormat,
+		Compression:  r.Compression,
+		Parameters: ReportParameters{
+			Columns: r.Columns,
+			Filters: r.Filters,
+			Sort:    r.Sort,
+		},
+		WebhookURL:    r.WebhookURL,
+		WebhookSecret: r.WebhookSecret,
+		Reuse:         r.Reuse,
+	}
+	return options.WithDefaults()
+}
+
+// ReportOptions - how the report should be generated and stored
+type ReportOptions struct {
+	Game         Game
+	OutputFormat OutputFormat
+	Compression  Compression
+	Parameters   ReportParameters
+	// WebhookURL - optional endpoint signed with WebhookSecret
+	WebhookURL    string
+	WebhookSecret string
+	// Reuse - allow the worker to reuse a recent identical report
+	Reuse bool
+}
+
+// WithDefaults - fill unset options, csv output is gzip compressed by default
+func (o ReportOptions) WithDefaults() ReportOptions {
+	if o.Game == "" {
+		o.Game = DefaultGame
+	}
+	if o.OutputFormat == "" {
+		o.OutputFormat = FormatCSV
+	}
+	if o.Compression == "" {
+		o.Compression = o.OutputFormat.DefaultCompression()
+	}
+	return o
+}
+
 type ApiReport struct {
-	ID                   uuid.UUID  `json:"id"`
-	ReportType           string     `json:"report_type"`
-	OutputFilePath       *string    `json:"output_file_path,omitempty"`
+	ID                   uuid.UUID          `json:"id"`
+	ReportType           string             `json:"report_type"`
+	Game                 Game               `json:"game"`
+	OutputFormat         OutputFormat       `json:"output_format"`
+	Compression          Compression        `json:"compression"`
+	Parameters           ReportParameters   `json:"parameters"`
+	OutputFilePath       *string            `json:"output_file_path,omitempty"`
+	DownloadURL          *string            `json:"download_url,omitempty"`
+	DownloadURLExpiresAt *time.Time         `json:"download_url_expires_at,omitempty"`
+	ErrorMessage         *string            `json:"error_message,omitempty"`
+	CreatedAt            time.Time          `json:"created_at"`
+	StartedAt            *time.Time         `json:"started_at,omitempty"`
+	CompletedAt          *time.Time         `json:"completed_at,omitempty"`
+	FailedAt             *time.Time         `json:"failed_at,omitempty"`
+	CancelledAt          *time.Time         `json:"cancelled_at,omitempty"`
+	Status               string             `json:"status,omitempty"`
+	Attempts             []ApiReportAttempt `json:"attempts,omitempty"`
+	WebhookURL           *string            `json:"webhook_url,omitempty"`
+	Reuse                bool               `json:"reuse,omitempty"`
+	// ReusedFrom - report that generated the artifact when it was reused
+	ReusedFrom *uuid.UUID `json:"reused_from,omitempty"`
+}
+
+// ApiReportEvent - data of the events sent by GET /reports/{id}/events,
+// the completed event carries the download url
+type ApiReportEvent struct {
+	ReportID             uuid.UUID  `json:"report_id"`
+	Status               string     `json:"status"`
+	Stage                string     `json:"stage,omitempty"`
 	DownloadURL          *string    `json:"download_url,omitempty"`
 	DownloadURLExpiresAt *time.Time `json:"download_url_expires_at,omitempty"`
 	ErrorMessage         *string    `json:"error_message,omitempty"`
-	CreatedAt            time.Time  `json:"created_at"`
-	StartedAt            *time.Time `json:"started_at,omitempty"`
-	CompletedAt          *time.Time `json:"completed_at,omitempty"`
-	FailedAt             *time.Time `json:"failed_at,omitempty"`
-	Status               string     `json:"status,omitempty"`
+}
+
+func NewApiReportEvent(report *Report) *ApiReportEvent {
+	apiReport := NewApiReport(report)
+	return &ApiReportEvent{
+		ReportID:             report.ID,
+		Status:               apiReport.Status,
+		DownloadURL:          apiReport.DownloadURL,
+		DownloadURLExpiresAt: apiReport.DownloadURLExpiresAt,
+		ErrorMessage:         apiReport.ErrorMessage,
+	}
+}
+
+const (
+	DefaultListReportsLimit = 20
+	MaxListReportsLimit     = 100
+)
+
+// ParseListReportsQuery - parse status, report_type, created_after, created_before, cursor and limit
+func ParseListReportsQuery(query url.Values) (ListReportsFilter, error) {
+	filter := ListReportsFilter{
+		Status:     query.Get("status"),
+		ReportType: query.Get("report_type"),
+		Limit:      DefaultListReportsLimit,
+	}
+	if _, ok := statusConditions[filter.Status]; filter.Status != "" && !ok {
+		return filter, fmt.Errorf("unknown status %q", filter.Status)
+	}
+	for name, target := range map[string]**time.Time{
+		"created_after":  &filter.CreatedAfter,
+		"created_before": &filter.CreatedBefore,
+	} {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return filter, fmt.Errorf("%s must be RFC3339 time: %w", name, err)
+		}
+		*target = &parsed
+	}
+	if limit := query.Get("limit"); limit != "" {
+		parsed, err := strconv.Atoi(limit)
+		if err != nil || parsed < 1 || parsed > MaxListReportsLimit {
+			return filter, fmt.Errorf("limit must be between 1 and %d", MaxListReportsLimit)
+		}
+		filter.Limit = parsed
+	}
+	if cursor := query.Get("cursor"); cursor != "" {
+		parsed, err := DecodeReportCursor(cursor)
+		if err != nil {
+			return filter, err
+		}
+		filter.Cursor = parsed
+	}
+	return filter, nil
+}
+
+// HasFilter - at least one of status, report_type or created range is set
+func (f ListReportsFilter) HasFilter() bool {
+	return f.Status != "" || f.ReportType != "" || f.CreatedAfter != nil || f.CreatedBefore != nil
+}
+
+type DeleteReportsResponse struct {
+	Deleted int `json:"deleted"`
+	Skipped int `json:"skipped"`
+}
+
+type ListReportsResponse struct {
+	Reports    []ApiReport `json:"reports"`
+	NextCursor *string     `json:"next_cursor,omitempty"`
+}
+
+func NewApiReport(report *Report) *ApiReport {
+	apiReport := &ApiReport{
+		ID:           report.ID,
+		ReportType:   report.ReportType,
+		Game:         report.Game,
+		OutputFormat: report.OutputFormat,
+		Compression:  report.Compression,
+		Parameters:   report.Parameters,
+		CreatedAt:    report.CreatedAt,
+		Status:       report.Status(),
+		Reuse:        report.Reuse,
+	}
+	if report.OutputFilePath.Valid {
+		apiReport.OutputFilePath = &report.OutputFilePath.String
+	}
+	if report.DownloadURL.Valid {
+		apiReport.DownloadURL = &report.DownloadURL.String
+	}
+	if report.DownloadURLExpiresAt.Valid {
+		apiReport.DownloadURLExpiresAt = &report.DownloadURLExpiresAt.Time
+	}
+	if report.ErrorMessage.Valid {
+		apiReport.ErrorMessage = &report.ErrorMessage.String
+	}
+	if report.StartedAt.Valid {
+		apiReport.StartedAt = &report.StartedAt.Time
+	}
+	if report.CompletedAt.Valid {
+		apiReport.CompletedAt = &report.CompletedAt.Time
+	}
+	if report.FailedAt.Valid {
+		apiReport.FailedAt = &report.FailedAt.Time
+	}
+	if report.CancelledAt.Valid {
+		apiReport.CancelledAt = &report.CancelledAt.Time
+	}
+	if report.WebhookURL.Valid {
+		apiReport.WebhookURL = &report.WebhookURL.String
+	}
+	if report.ReusedFrom.Valid {
+		apiReport.ReusedFrom = &report.ReusedFrom.UUID
+	}
+	return apiReport
 }
@@ -0,0 +1,92 @@
+package report_test
+
+import (
+	"database/sql"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/leetcode-golang-classroom/golang-async-api/internal/report"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseListReportsQuery(t *testing.T) {
+	cursor := report.ReportCursor{
+		CreatedAt: time.Date(2025, 5, 1, 10, 0, 0, 123456000, time.UTC),
+		ID:        uuid.New(),
+	}
+	filter, err := report.ParseListReportsQuery(url.Values{
+		"status":        {"completed"},
+		"report_type":   {"monsters"},
+		"created_after": {"2025-05-01T00:00:00Z"},
+		"limit":         {"5"},
+		"cursor":        {cursor.Encode()},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "completed", filter.Status)
+	assert.Equal(t, "monsters", filter.ReportType)
+	assert.Equal(t, 5, filter.Limit)
+	require.NotNil(t, filter.CreatedAfter)
+	assert.Nil(t, filter.CreatedBefore)
+	require.NotNil(t, filter.Cursor)
+	assert.True(t, cursor.CreatedAt.Equal(filter.Cursor.CreatedAt))
+	assert.Equal(t, cursor.ID, filter.Cursor.ID)
+
+	filter, err = report.ParseListReportsQuery(url.Values{})
+	require.NoError(t, err)
+	assert.Equal(t, report.DefaultListReportsLimit, filter.Limit)
+
+	for name, query := range map[string]url.Values{
+		"unknown status": {"status": {"done"}},
+		"invalid time":   {"created_before": {"yesterday"}},
+		"limit too big":  {"limit": {"1000"}},
+		"invalid cursor": {"cursor": {"not-a-cursor"}},
+	} {
+		_, err := report.ParseListReportsQuery(query)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestReportStatus(t *testing.T) {
+	now := sql.NullTime{Time: time.Now(), Valid: true}
+	testCases := []struct {
+		name   string
+		report report.Report
+		status string
+	}{
+		{name: "requested", report: report.Report{}, status: "requested"},
+		{name: "processing", report: report.Report{StartedAt: now}, status: "processing"},
+		{name: "completed", report: report.Report{StartedAt: now, CompletedAt: now}, status: "completed"},
+		{name: "failed", report: report.Report{StartedAt: now, FailedAt: now}, status: "failed"},
+		{name: "cancelled before start", report: report.Report{CancelledAt: now}, status: "cancelled"},
+		{name: "cancelled while processing", report: report.Report{StartedAt: now, CancelledAt: now}, status: "cancelled"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.status, tc.report.Status())
+		})
+	}
+}
+
+func TestValidateIdempotencyKey(t *testing.T) {
+	require.NoError(t, report.ValidateIdempotencyKey("8e2b6c1a-retry-1"))
+	require.Error(t, report.ValidateIdempotencyKey(""))
+	require.Error(t, report.ValidateIdempotencyKey("has space"))
+	require.Error(t, report.ValidateIdempotencyKey(string(make([]byte, 256))))
+}
+
+func TestCreateReportRequestHash(t *testing.T) {
+	request := report.CreateReportRequest{ReportType: "monsters", Columns: []string{"name"}}
+	hash, err := request.RequestHash()
+	require.NoError(t, err)
+	assert.Len(t, hash, 64)
+	same, err := report.CreateReportRequest{ReportType: "monsters", Columns: []string{"name"}}.RequestHash()
+	require.NoError(t, err)
+	assert.Equal(t, hash, same)
+	request.Columns = []string{"drops"}
+	other, err := request.RequestHash()
+	require.NoError(t, err)
+	assert.NotEqual(t, hash, other)
+}
@@ -1,59 +1,69 @@
 package report
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
-	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	"github.com/go-playground/validator/v10"
 	"github.com/google/uuid"
+	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/blob"
 	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/config"
 	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/helper"
 	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/jwt"
+	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/logger"
 	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/response"
 	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/util"
 )
 
 type Handler struct {
-	logger          *slog.Logger
-	validator       *validator.Validate
-	jwtManager      *jwt.JWTManager
-	reportStore     *ReportStore
-	sqsClient       *sqs.Client
-	appConfig       *config.Config
-	preSignedClient *s3.PresignClient
+	logger      *slog.Logger
+	validator   *validator.Validate
+	jwtManager  *jwt.JWTManager
+	reportStore *ReportStore
+	appConfig   *config.Config
+	blobStore   blob.BlobStore
+	generators  *GeneratorRegistry
+	events      *EventBroker
 }
 
 func NewHandler(logger *slog.Logger,
 	validator *validator.Validate,
 	jwtManager *jwt.JWTManager,
 	reportStore *ReportStore,
-	sqsClient *sqs.Client,
 	appConfig *config.Config,
-	preSignedClient *s3.PresignClient,
+	blobStore blob.BlobStore,
+	generators *GeneratorRegistry,
+	events *EventBroker,
 ) *Handler {
 	return &Handler{
-		logger:          logger,
-		validator:       validator,
-		jwtManager:      jwtManager,
-		reportStore:     reportStore,
-		sqsClient:       sqsClient,
-		appConfig:       appConfig,
-		preSignedClient: preSignedClient,
+		logger:      logger,
+		validator:   validator,
+		jwtManager:  jwtManager,
+		reportStore: reportStore,
+		appConfig:   appConfig,
+		blobStore:   blobStore,
+		generators:  generators,
+		events:      events,
 	}
 }
 
 func (h *Handler) RegisterRoute(router *http.ServeMux) {
 	// setup route
 	router.HandleFunc("POST /reports", h.createReportHandler())
+	router.HandleFunc("GET /reports", h.listReportsHandler())
+	router.HandleFunc("DELETE /reports", h.deleteReportsHandler())
 	router.HandleFunc("GET /reports/{id}", h.getReportHandler())
+	router.HandleFunc("GET /reports/{id}/events", h.reportEventsHandler())
+	router.HandleFunc("DELETE /reports/{id}", h.deleteReportHandler())
+	router.HandleFunc("POST /reports/{id}/cancel", h.cancelReportHandler())
+	router.HandleFunc("POST /reports/{id}/retry", h.retryReportHandler())
 }
 
 func (h *Handler) createReportHandler() http.HandlerFunc {
@@ -66,6 +76,12 @@ func (h *Handler) createReportHandler() http.HandlerFunc {
 			)
 		}
 		defer r.Body.Close()
+		if err := h.generators.ValidateParameters(req.ReportType, req.Options().Parameters); err != nil {
+			return helper.NewErrWithStatus(
+				http.StatusBadRequest,
+				err,
+			)
+		}
 		user, ok := util.UserFromContext(r.Context())
 		if !ok {
 			return helper.NewErrWithStatus(
@@ -74,7 +90,11 @@ func (h *Handler) createReportHandler() http.HandlerFunc {
 			)
 		}
 
-		report, err := h.reportStore.Create(r.Context(), user.ID, req.ReportType)
+		if key := r.Header.Get(IdempotencyKeyHeader); key != "" {
+			return h.createReportIdempotent(w, r, user.ID, key, req)
+		}
+
+		report, err := h.reportStore.Create(r.Context(), user.ID, req.ReportType, req.Options())
 		if err != nil {
 			return helper.NewErrWithStatus(
 				http.StatusInternalServerError,
@@ -82,80 +102,397 @@ func (h *Handler) createReportHandler() http.HandlerFunc {
 			)
 		}
 
-		sqsMessage := SQSMessage{
-			UserID:   report.UserID,
-			ReportID: report.ID,
+		if err := helper.Encode(response.ApiResponse[ApiReport]{
+			Data: NewApiReport(report),
+		},
+			http.StatusCreated,
+			w,
+		); err != nil {
+			return helper.NewErrWithStatus(
+				http.StatusInternalServerError,
+				err,
+			)
 		}
-		bytes, err := json.Marshal(sqsMessage)
+		return nil
+	})
+}
+
+// createReportIdempotent - create the report once per Idempotency-Key, a retry gets the original report and status
+func (h *Handler) createReportIdempotent(w http.ResponseWriter, r *http.Request, userID uuid.UUID, key string, req CreateReportRequest) error {
+	if err := ValidateIdempotencyKey(key); err != nil {
+		return helper.NewErrWithStatus(
+			http.StatusBadRequest,
+			err,
+		)
+	}
+	requestHash, err := req.RequestHash()
+	if err != nil {
+		return helper.NewErrWithStatus(
+			http.StatusInternalServerError,
+			err,
+		)
+	}
+	ttl := h.appConfig.IdempotencyKeyTTL
+	if ttl <= 0 {
+		ttl = DefaultIdempotencyKeyTTL
+	}
+	idempotencyKey, replayed, err := h.reportStore.CreateIdempotent(r.Context(), userID, req.ReportType, req.Options(),
+		IdempotentRequest{
+			Key:         key,
+			RequestHash: requestHash,
+			TTL:         ttl,
+		})
+	if err != nil {
+		if errors.Is(err, ErrIdempotencyKeyReused) {
+			return helper.NewErrWithStatus(
+				http.StatusUnprocessableEntity,
+				err,
+			)
+		}
+		return helper.NewErrWithStatus(
+			http.StatusInternalServerError,
+			err,
+		)
+	}
+	var apiReport ApiReport
+	if err := json.Unmarshal(idempotencyKey.ResponseBody, &apiReport); err != nil {
+		return helper.NewErrWithStatus(
+			http.StatusInternalServerError,
+			fmt.Errorf("failed to unmarshal stored response: %w", err),
+		)
+	}
+	if replayed {
+		w.Header().Set(IdempotentReplayedHeader, "true")
+	}
+	if err := helper.Encode(response.ApiResponse[ApiReport]{
+		Data: &apiReport,
+	},
+		idempotencyKey.ResponseStatus,
+		w,
+	); err != nil {
+		return helper.NewErrWithStatus(
+			http.StatusInternalServerError,
+			err,
+		)
+	}
+	return nil
+}
+
+func (h *Handler) getReportHandler() http.HandlerFunc {
+	return helper.Handler(func(w http.ResponseWriter, r *http.Request) error {
+		reportIDStr := r.PathValue("id")
+		reportID, err := uuid.Parse(reportIDStr)
 		if err != nil {
+			return helper.NewErrWithStatus(
+				http.StatusBadRequest,
+				err,
+			)
+		}
+
+		user, ok := util.UserFromContext(r.Context())
+		if !ok {
+			return helper.NewErrWithStatus(
+				http.StatusUnauthorized,
+				fmt.Errorf("user not found in context"),
+			)
+		}
+
+		report, err := h.reportStore.ByPrimaryKey(r.Context(), user.ID, reportID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return helper.NewErrWithStatus(
+					http.StatusNotFound,
+					fmt.Errorf("report not found"),
+				)
+			}
 			return helper.NewErrWithStatus(
 				http.StatusInternalServerError,
 				err,
 			)
 		}
-		queueURLOutput, err := h.sqsClient.GetQueueUrl(r.Context(), &sqs.GetQueueUrlInput{
-			QueueName: aws.String(h.appConfig.SQSQueue),
-		})
+		report, err = h.refreshDownloadURL(r.Context(), report)
 		if err != nil {
 			return helper.NewErrWithStatus(
 				http.StatusInternalServerError,
 				err,
 			)
 		}
-		_, err = h.sqsClient.SendMessage(r.Context(), &sqs.SendMessageInput{
-			QueueUrl:    queueURLOutput.QueueUrl,
-			MessageBody: aws.String(string(bytes)),
-		})
+		attempts, err := h.reportStore.Attempts(r.Context(), user.ID, reportID)
 		if err != nil {
 			return helper.NewErrWithStatus(
 				http.StatusInternalServerError,
 				err,
 			)
 		}
-		var outputFilePath *string
-		if report.OutputFilePath.Valid {
-			outputFilePath = &report.OutputFilePath.String
+		apiReport := NewApiReport(report)
+		apiReport.Attempts = NewApiReportAttempts(attempts)
+		if err := helper.Encode(response.ApiResponse[ApiReport]{
+			Data: apiReport,
+		},
+			http.StatusOK,
+			w,
+		); err != nil {
+			return helper.NewErrWithStatus(
+				http.StatusInternalServerError,
+				err,
+			)
 		}
-		var downloadURL *string
-		if report.DownloadURL.Valid {
-			downloadURL = &report.DownloadURL.String
+		return nil
+	})
+}
+
+// refreshDownloadURL - sign a new download url for a completed report when it has none or it expired
+func (h *Handler) refreshDownloadURL(ctx context.Context, report *Report) (*Report, error) {
+	if !report.CompletedAt.Valid {
+		return report, nil
+	}
+	needRefresh := report.DownloadURLExpiresAt.Valid && report.DownloadURLExpiresAt.Time.Before(time.Now().UTC())
+	if report.DownloadURL.Valid && !needRefresh {
+		return report, nil
+	}
+	expiresAt := time.Now().Add(10 * time.Second)
+	signedURL, err := h.blobStore.SignedURL(ctx, report.OutputFilePath.String, time.Second*10)
+	if err != nil {
+		return nil, err
+	}
+	report.DownloadURL = sql.NullString{
+		String: signedURL,
+		Valid:  true,
+	}
+	report.DownloadURLExpiresAt = sql.NullTime{
+		Time:  expiresAt,
+		Valid: true,
+	}
+	return h.reportStore.Update(ctx, report)
+}
+
+// reportEventsHandler - stream the status transitions of a report as server-sent events,
+// the stream ends after the completed, failed or cancelled event
+func (h *Handler) reportEventsHandler() http.HandlerFunc {
+	return helper.Handler(func(w http.ResponseWriter, r *http.Request) error {
+		reportID, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			return helper.NewErrWithStatus(
+				http.StatusBadRequest,
+				err,
+			)
+		}
+
+		user, ok := util.UserFromContext(r.Context())
+		if !ok {
+			return helper.NewErrWithStatus(
+				http.StatusUnauthorized,
+				fmt.Errorf("user not found in context"),
+			)
+		}
+
+		// subscribe before loading the report so no transition is missed in between
+		events, unsubscribe := h.events.Subscribe(reportID)
+		defer unsubscribe()
+		report, err := h.reportStore.ByPrimaryKey(r.Context(), user.ID, reportID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return helper.NewErrWithStatus(
+					http.StatusNotFound,
+					fmt.Errorf("report not found"),
+				)
+			}
+			return helper.NewErrWithStatus(
+				http.StatusInternalServerError,
+				err,
+			)
+		}
+
+		controller := http.NewResponseController(w)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+
+		// from here on errors end the stream with a log line, EventSource clients reconnect on their own
+		log := logger.FromContext(r.Context())
+		var lastStatus string
+		sendStatus := func(report *Report) (bool, error) {
+			status := report.Status()
+			if status == lastStatus {
+				return false, nil
+			}
+			report, err := h.refreshDownloadURL(r.Context(), report)
+			if err != nil {
+				return false, err
+			}
+			if err := WriteEvent(w, status, NewApiReportEvent(report)); err != nil {
+				return false, err
+			}
+			lastStatus = status
+			return report.IsDone(), controller.Flush()
+		}
+		done, err := sendStatus(report)
+		if err != nil || done {
+			if err != nil {
+				log.ErrorContext(r.Context(), "failed to send report event", slog.Any("err", err))
+			}
+			return nil
+		}
+
+		keepAlive := time.NewTicker(DefaultEventsKeepAlive)
+		defer keepAlive.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return nil
+			case <-keepAlive.C:
+				if _, err := io.WriteString(w, ": keep-alive\n\n"); err != nil {
+					return nil
+				}
+				if err := controller.Flush(); err != nil {
+					return nil
+				}
+			case event, ok := <-events:
+				if !ok {
+					// the server is shutting down
+					return nil
+				}
+				if event.Status == EventProgress {
+					if event.UserID != user.ID || lastStatus != "processing" {
+						continue
+					}
+					err = WriteEvent(w, EventProgress, &ApiReportEvent{
+						ReportID: reportID,
+						Status:   EventProgress,
+						Stage:    event.Stage,
+					})
+					if err == nil {
+						err = controller.Flush()
+					}
+				} else {
+					// transitions and listener reconnects reload the report, so the event carries the stored state
+					report, err = h.reportStore.ByPrimaryKey(r.Context(), user.ID, reportID)
+					if err == nil {
+						done, err = sendStatus(report)
+					}
+				}
+				if err != nil {
+					if !errors.Is(err, sql.ErrNoRows) && r.Context().Err() == nil {
+						log.ErrorContext(r.Context(), "failed to send report event", slog.Any("err", err))
+					}
+					return nil
+				}
+				if done {
+					return nil
+				}
+			}
+		}
+	})
+}
+
+// listReportsHandler - stored reports of the user, download urls are refreshed by GET /reports/{id}
+func (h *Handler) listReportsHandler() http.HandlerFunc {
+	return helper.Handler(func(w http.ResponseWriter, r *http.Request) error {
+		filter, err := ParseListReportsQuery(r.URL.Query())
+		if err != nil {
+			return helper.NewErrWithStatus(
+				http.StatusBadRequest,
+				err,
+			)
+		}
+
+		user, ok := util.UserFromContext(r.Context())
+		if !ok {
+			return helper.NewErrWithStatus(
+				http.StatusUnauthorized,
+				fmt.Errorf("user not found in context"),
+			)
 		}
-		var downloadURLExpiresAt *time.Time
-		if report.DownloadURLExpiresAt.Valid {
-			downloadURLExpiresAt = &report.DownloadURLExpiresAt.Time
+
+		reports, nextCursor, err := h.reportStore.List(r.Context(), user.ID, filter)
+		if err != nil {
+			return helper.NewErrWithStatus(
+				http.StatusInternalServerError,
+				err,
+			)
 		}
-		var errorMessage *string
-		if report.ErrorMessage.Valid {
-			errorMessage = &report.ErrorMessage.String
+		resp := ListReportsResponse{
+			Reports: make([]ApiReport, 0, len(reports)),
 		}
-		var startedAt *time.Time
-		if report.StartedAt.Valid {
-			startedAt = &report.StartedAt.Time
+		for i := range reports {
+			resp.Reports = append(resp.Reports, *NewApiReport(&reports[i]))
 		}
-		var completedAt *time.Time
-		if report.CompletedAt.Valid {
-			completedAt = &report.CompletedAt.Time
+		if nextCursor != nil {
+			encoded := nextCursor.Encode()
+			resp.NextCursor = &encoded
 		}
-		var failedAt *time.Time
-		if report.FailedAt.Valid {
-			failedAt = &report.FailedAt.Time
+		if err := helper.Encode(response.ApiResponse[ListReportsResponse]{
+			Data: &resp,
+		},
+			http.StatusOK,
+			w,
+		); err != nil {
+			return helper.NewErrWithStatus(
+				http.StatusInternalServerError,
+				err,
+			)
+		}
+		return nil
+	})
+}
+
+func (h *Handler) cancelReportHandler() http.HandlerFunc {
+	return helper.Handler(func(w http.ResponseWriter, r *http.Request) error {
+		reportID, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			return helper.NewErrWithStatus(
+				http.StatusBadRequest,
+				err,
+			)
+		}
+
+		user, ok := util.UserFromContext(r.Context())
+		if !ok {
+			return helper.NewErrWithStatus(
+				http.StatusUnauthorized,
+				fmt.Errorf("user not found in context"),
+			)
+		}
+
+		report, err := h.reportStore.ByPrimaryKey(r.Context(), user.ID, reportID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return helper.NewErrWithStatus(
+					http.StatusNotFound,
+					fmt.Errorf("report not found"),
+				)
+			}
+			return helper.NewErrWithStatus(
+				http.StatusInternalServerError,
+				err,
+			)
+		}
+		if report.IsDone() {
+			return helper.NewErrWithStatus(
+				http.StatusConflict,
+				fmt.Errorf("report is already %s", report.Status()),
+			)
+		}
+
+		report, err = h.reportStore.Cancel(r.Context(), user.ID, reportID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return helper.NewErrWithStatus(
+					http.StatusConflict,
+					fmt.Errorf("report finished before it could be cancelled"),
+				)
+			}
+			return helper.NewErrWithStatus(
+				http.StatusInternalServerError,
+				err,
+			)
 		}
 		if err := helper.Encode(response.ApiResponse[ApiReport]{
-			Data: &ApiReport{
-				ID:                   report.ID,
-				ReportType:           req.ReportType,
-				OutputFilePath:       outputFilePath,
-				DownloadURL:          downloadURL,
-				DownloadURLExpiresAt: downloadURLExpiresAt,
-				ErrorMessage:         errorMessage,
-				CreatedAt:            report.CreatedAt,
-				StartedAt:            startedAt,
-				CompletedAt:          completedAt,
-				FailedAt:             failedAt,
-				Status:               report.Status(),
-			},
+			Data: NewApiReport(report),
 		},
-			http.StatusCreated,
+			http.StatusOK,
 			w,
 		); err != nil {
 			return helper.NewErrWithStatus(
@@ -167,10 +504,15 @@ func (h *Handler) createReportHandler() http.HandlerFunc {
 	})
 }
 
-func (h *Handler) getReportHandler() http.HandlerFunc {
+// deleteReport - remove the stored file before the row, so a failed blob delete leaves the row for a retry.
+// The file is kept while reused reports still point at it
+func (h *Handler) deleteReport(ctx context.Context, report *Report) error {
+	return h.reportStore.DeleteWithArtifact(ctx, report.UserID, report.ID, h.blobStore.Delete)
+}
+
+func (h *Handler) deleteReportHandler() http.HandlerFunc {
 	return helper.Handler(func(w http.ResponseWriter, r *http.Request) error {
-		reportIDStr := r.PathValue("id")
-		reportID, err := uuid.Parse(reportIDStr)
+		reportID, err := uuid.Parse(r.PathValue("id"))
 		if err != nil {
 			return helper.NewErrWithStatus(
 				http.StatusBadRequest,
@@ -199,87 +541,155 @@ func (h *Handler) getReportHandler() http.HandlerFunc {
 				err,
 			)
 		}
-		var outputFilePath *string
-		if report.OutputFilePath.Valid {
-			outputFilePath = &report.OutputFilePath.String
-		}
-		var downloadURL *string
-		if report.DownloadURL.Valid {
-			downloadURL = &report.DownloadURL.String
-		}
-		var downloadURLExpiresAt *time.Time
-		if report.DownloadURLExpiresAt.Valid {
-			downloadURLExpiresAt = &report.DownloadURLExpiresAt.Time
-		}
-		var errorMessage *string
-		if report.ErrorMessage.Valid {
-			errorMessage = &report.ErrorMessage.String
-		}
-		var startedAt *time.Time
-		if report.StartedAt.Valid {
-			startedAt = &report.StartedAt.Time
-		}
-		var completedAt *time.Time
-		if report.CompletedAt.Valid {
-			completedAt = &report.CompletedAt.Time
-		}
-		if report.CompletedAt.Valid {
-			needRefresh := report.DownloadURLExpiresAt.Valid && report.DownloadURLExpiresAt.Time.Before(time.Now().UTC())
-			if !report.DownloadURL.Valid || needRefresh {
-				completedAt = &report.CompletedAt.Time
-				// to s3 client (presigned client)
-				expiresAt := time.Now().Add(10 * time.Second)
-				signedURL, err := h.preSignedClient.PresignGetObject(r.Context(), &s3.GetObjectInput{
-					Bucket: aws.String(h.appConfig.S3Bucket),
-					Key:    aws.String(report.OutputFilePath.String),
-				}, func(options *s3.PresignOptions) {
-					options.Expires = time.Second * 10
-				})
-				if err != nil {
-					return helper.NewErrWithStatus(
-						http.StatusInternalServerError,
-						err,
-					)
-				}
-				report.DownloadURL = sql.NullString{
-					String: signedURL.URL,
-					Valid:  true,
-				}
-				downloadURL = &signedURL.URL
-				report.DownloadURLExpiresAt = sql.NullTime{
-					Time:  expiresAt,
-					Valid: true,
+		if report.Status() == "processing" {
+			return helper.NewErrWithStatus(
+				http.StatusConflict,
+				fmt.Errorf("report is processing, cancel it before deleting"),
+			)
+		}
+		if err := h.deleteReport(r.Context(), report); err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return helper.NewErrWithStatus(
+				http.StatusInternalServerError,
+				err,
+			)
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	})
+}
+
+// deleteReportsHandler - bulk delete by the GET /reports filters, processing reports are skipped
+func (h *Handler) deleteReportsHandler() http.HandlerFunc {
+	return helper.Handler(func(w http.ResponseWriter, r *http.Request) error {
+		filter, err := ParseListReportsQuery(r.URL.Query())
+		if err != nil {
+			return helper.NewErrWithStatus(
+				http.StatusBadRequest,
+				err,
+			)
+		}
+		if !filter.HasFilter() {
+			return helper.NewErrWithStatus(
+				http.StatusBadRequest,
+				fmt.Errorf("at least one of status, report_type, created_after or created_before is required"),
+			)
+		}
+
+		user, ok := util.UserFromContext(r.Context())
+		if !ok {
+			return helper.NewErrWithStatus(
+				http.StatusUnauthorized,
+				fmt.Errorf("user not found in context"),
+			)
+		}
+
+		var resp DeleteReportsResponse
+		for {
+			reports, nextCursor, err := h.reportStore.List(r.Context(), user.ID, filter)
+			if err != nil {
+				return helper.NewErrWithStatus(
+					http.StatusInternalServerError,
+					err,
+				)
+			}
+			for i := range reports {
+				if reports[i].Status() == "processing" {
+					resp.Skipped++
+					continue
 				}
-				downloadURLExpiresAt = &expiresAt
-				report, err = h.reportStore.Update(r.Context(), report)
-				if err != nil {
+				if err := h.deleteReport(r.Context(), &reports[i]); err != nil && !errors.Is(err, sql.ErrNoRows) {
 					return helper.NewErrWithStatus(
 						http.StatusInternalServerError,
 						err,
 					)
 				}
+				resp.Deleted++
+			}
+			if nextCursor == nil {
+				break
+			}
+			filter.Cursor = nextCursor
+		}
+		if err := helper.Encode(response.ApiResponse[DeleteReportsResponse]{
+			Data: &resp,
+		},
+			http.StatusOK,
+			w,
+		); err != nil {
+			return helper.NewErrWithStatus(
+				http.StatusInternalServerError,
+				err,
+			)
+		}
+		return nil
+	})
+}
+
+func (h *Handler) retryReportHandler() http.HandlerFunc {
+	return helper.Handler(func(w http.ResponseWriter, r *http.Request) error {
+		reportID, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			return helper.NewErrWithStatus(
+				http.StatusBadRequest,
+				err,
+			)
+		}
+
+		user, ok := util.UserFromContext(r.Context())
+		if !ok {
+			return helper.NewErrWithStatus(
+				http.StatusUnauthorized,
+				fmt.Errorf("user not found in context"),
+			)
+		}
+
+		report, err := h.reportStore.ByPrimaryKey(r.Context(), user.ID, reportID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return helper.NewErrWithStatus(
+					http.StatusNotFound,
+					fmt.Errorf("report not found"),
+				)
+			}
+			return helper.NewErrWithStatus(
+				http.StatusInternalServerError,
+				err,
+			)
+		}
+		if report.Status() != "failed" {
+			return helper.NewErrWithStatus(
+				http.StatusConflict,
+				fmt.Errorf("only failed reports can be retried, report is %s", report.Status()),
+			)
+		}
+
+		report, err = h.reportStore.ResetForRetry(r.Context(), user.ID, reportID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return helper.NewErrWithStatus(
+					http.StatusConflict,
+					fmt.Errorf("report is no longer failed"),
+				)
 			}
+			return helper.NewErrWithStatus(
+				http.StatusInternalServerError,
+				err,
+			)
 		}
-		var failedAt *time.Time
-		if report.FailedAt.Valid {
-			failedAt = &report.FailedAt.Time
+
+		attempts, err := h.reportStore.Attempts(r.Context(), user.ID, reportID)
+		if err != nil {
+			return helper.NewErrWithStatus(
+				http.StatusInternalServerError,
+				err,
+			)
 		}
+		apiReport := NewApiReport(report)
+		apiReport.Attempts = NewApiReportAttempts(attempts)
 		if err := helper.Encode(response.ApiResponse[ApiReport]{
-			Data: &ApiReport{
-				ID:                   report.ID,
-				ReportType:           report.ReportType,
-				OutputFilePath:       outputFilePath,
-				DownloadURL:          downloadURL,
-				DownloadURLExpiresAt: downloadURLExpiresAt,
-				ErrorMessage:         errorMessage,
-				CreatedAt:            report.CreatedAt,
-				StartedAt:            startedAt,
-				CompletedAt:          completedAt,
-				FailedAt:             failedAt,
-				Status:               report.Status(),
-			},
+			Data: apiReport,
 		},
-			http.StatusOK,
+			http.StatusAccepted,
 			w,
 		); err != nil {
 			return helper.NewErrWithStatus(
@@ -3,7 +3,9 @@ package report
 import (
 	"context"
 	"database/sql"
+	"encoding/base64"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -22,24 +24,38 @@ func NewReportStore(db *sql.DB) *ReportStore {
 }
 
 type Report struct {
-	UserID               uuid.UUID      `db:"user_id"`
-	ID                   uuid.UUID      `db:"id"`
-	ReportType           string         `db:"report_type"`
-	OutputFilePath       sql.NullString `db:"output_file_path"`
-	DownloadURL          sql.NullString `db:"download_url"`
-	DownloadURLExpiresAt sql.NullTime   `db:"download_url_expires_at"`
-	ErrorMessage         sql.NullString `db:"error_message"`
-	CreatedAt            time.Time      `db:"created_at"`
-	StartedAt            sql.NullTime   `db:"started_at"`
-	CompletedAt          sql.NullTime   `db:"completed_at"`
-	FailedAt             sql.NullTime   `db:"failed_at"`
+	UserID               uuid.UUID        `db:"user_id"`
+	ID                   uuid.UUID        `db:"id"`
+	ReportType           string           `db:"report_type"`
+	Game                 Game             `db:"game"`
+	OutputFormat         OutputFormat     `db:"output_format"`
+	Compression          Compression      `db:"compression"`
+	Parameters           ReportParameters `db:"parameters"`
+	OutputFilePath       sql.NullString   `db:"output_file_path"`
+	DownloadURL          sql.NullString   `db:"download_url"`
+	DownloadURLExpiresAt sql.NullTime     `db:"download_url_expires_at"`
+	ErrorMessage         sql.NullString   `db:"error_message"`
+	CreatedAt            time.Time        `db:"created_at"`
+	StartedAt            sql.NullTime     `db:"started_at"`
+	CompletedAt          sql.NullTime     `db:"completed_at"`
+	FailedAt             sql.NullTime     `db:"failed_at"`
+	CancelledAt          sql.NullTime     `db:"cancelled_at"`
+	WorkerID             sql.NullString   `db:"worker_id"`
+	LeaseExpiresAt       sql.NullTime     `db:"lease_expires_at"`
+	WebhookURL           sql.NullString   `db:"webhook_url"`
+	WebhookSecret        sql.NullString   `db:"webhook_secret"`
+	Reuse                bool             `db:"reuse"`
+	ReusedFrom           uuid.NullUUID    `db:"reused_from"`
+	RetriedAt            sql.NullTime     `db:"retried_at"`
 }
 
 func (r *Report) IsDone() bool {
-	return r.FailedAt.Valid || r.CompletedAt.Valid
+	return r.FailedAt.Valid || r.CompletedAt.Valid || r.CancelledAt.Valid
 }
 func (r *Report) Status() string {
 	switch {
+	case r.CancelledAt.Valid:
+		return "cancelled"
 	case r.StartedAt.Valid == false:
 		return "requested"
 	case r.StartedAt.Valid == true && !r.IsDone():
@@ -52,12 +68,35 @@ func (r *Report) Status() string {
 	return "unknown"
 }
 
-func (s *ReportStore) Create(ctx context.Context, userID uuid.UUID, reportType string) (*Report, error) {
-	const prepareStmt = `INSERT INTO reports(user_id, report_type) VALUES ($1, $2) RETURNING *`
+func nullString(value string) sql.NullString {
+	return sql.NullString{String: value, Valid: value != ""}
+}
+
+func (s *ReportStore) Create(ctx context.Context, userID uuid.UUID, reportType string, options ReportOptions) (*Report, error) {
+	var report *Report
+	err := s.withTx(ctx, func(tx *sqlx.Tx) (err error) {
+		report, err = createReport(ctx, tx, userID, reportType, options)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// createReport - insert the report within tx, the queue message is written with it and published by the outbox relay
+func createReport(ctx context.Context, tx *sqlx.Tx, userID uuid.UUID, reportType string, options ReportOptions) (*Report, error) {
+	const prepareStmt = `INSERT INTO reports(user_id, report_type, game, output_format, compression, parameters, webhook_url, webhook_secret, reuse) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING *`
 	var report Report
-	if err := s.db.GetContext(ctx, &report, prepareStmt, userID, reportType); err != nil {
+	options = options.WithDefaults()
+	if err := tx.GetContext(ctx, &report, prepareStmt, userID, reportType,
+		options.Game, options.OutputFormat, options.Compression, options.Parameters,
+		nullString(options.WebhookURL), nullString(options.WebhookSecret), options.Reuse); err != nil {
 		return nil, fmt.Errorf("failed to insert report: %w", err)
 	}
+	if err := insertOutbox(ctx, tx, &report); err != nil {
+		return nil, err
+	}
 	return &report, nil
 }
 
@@ -70,29 +109,136 @@ SET output_file_path = $1,
 		error_message = $4,
 		started_at = $5,
 	  completed_at = $6,
-		failed_at = $7
-WHERE user_id = $8 AND id = $9 RETURNING *;	
+		failed_at = $7,
+		reused_from = $8
+WHERE user_id = $9 AND id = $10 RETURNING *;	
 	`
 	var resultReport Report
-	if err := s.db.GetContext(
-		ctx,
-		&resultReport,
-		prepareStmt,
-		report.OutputFilePath,
-		report.DownloadURL,
-		report.DownloadURLExpiresAt,
-		report.ErrorMessage,
-		report.StartedAt,
-		report.CompletedAt,
-		report.FailedAt,
-		report.UserID,
-		report.ID,
-	); err != nil {
-		return nil, fmt.Errorf("failed to update report %s for user %s: %w", report.ID, report.UserID, err)
+	// event streams learn about the new status once the update commits
+	err := s.withTx(ctx, func(tx *sqlx.Tx) error {
+		if err := tx.GetContext(
+			ctx,
+			&resultReport,
+			prepareStmt,
+			report.OutputFilePath,
+			report.DownloadURL,
+			report.DownloadURLExpiresAt,
+			report.ErrorMessage,
+			report.StartedAt,
+			report.CompletedAt,
+			report.FailedAt,
+			report.ReusedFrom,
+			report.UserID,
+			report.ID,
+		); err != nil {
+			return fmt.Errorf("failed to update report %s for user %s: %w", report.ID, report.UserID, err)
+		}
+		return notifyStatus(ctx, tx, &resultReport)
+	})
+	if err != nil {
+		return nil, err
 	}
 	return &resultReport, nil
 }
 
+// FindReusable - latest report of the same user completed since since with the same type, game, format,
+// compression and parameters as report. Artifacts are stored under the key of their user, so reports
+// of other users are never reused. The artifact is the one of the report it points at, so chains of
+// reuses are not followed
+func (s *ReportStore) FindReusable(ctx context.Context, report *Report, since time.Time) (*Report, error) {
+	const prepareStmt = `
+SELECT * FROM reports
+WHERE report_type = $1 AND game = $2 AND output_format = $3 AND compression = $4
+  AND parameters = $5::jsonb
+  AND completed_at >= $6 AND output_file_path IS NOT NULL
+  AND id <> $7 AND user_id = $8
+ORDER BY completed_at DESC
+LIMIT 1;
+	`
+	var source Report
+	if err := s.db.GetContext(ctx, &source, prepareStmt, report.ReportType, report.Game, report.OutputFormat,
+		report.Compression, report.Parameters, since, report.ID, report.UserID); err != nil {
+		return nil, fmt.Errorf("failed to find reusable report for report %s: %w", report.ID, err)
+	}
+	return &source, nil
+}
+
+// DeleteWithArtifact - remove report row, deleteArtifact is called first with the path of its artifact when no
+// other report points at it. The row is kept when deleteArtifact fails so the delete could be retried, deleting an
+// object twice is harmless. Deletes of reports sharing an artifact are serialized on the path so they agree on the
+// last reference, sql.ErrNoRows when the report does not exist
+func (s *ReportStore) DeleteWithArtifact(ctx context.Context, userID uuid.UUID, id uuid.UUID,
+	deleteArtifact func(ctx context.Context, path string) error) error {
+	const selectStmt = `SELECT output_file_path FROM reports WHERE user_id = $1 AND id = $2 FOR UPDATE;`
+	const lockPathStmt = `SELECT pg_advisory_xact_lock(hashtext($1));`
+	const referencesStmt = `SELECT COUNT(*) FROM reports WHERE output_file_path = $1;`
+	const deleteStmt = `DELETE FROM reports WHERE user_id = $1 AND id = $2;`
+	return s.withTx(ctx, func(tx *sqlx.Tx) error {
+		var path sql.NullString
+		if err := tx.GetContext(ctx, &path, selectStmt, userID, id); err != nil {
+			return fmt.Errorf("failed to delete report %s for user %s: %w", id, userID, err)
+		}
+		if path.Valid {
+			// held until commit, a concurrent delete of a report sharing the artifact counts after this one is gone
+			if _, err := tx.ExecContext(ctx, lockPathStmt, path.String); err != nil {
+				return fmt.Errorf("failed to lock artifact %s: %w", path.String, err)
+			}
+			var references int
+			if err := tx.GetContext(ctx, &references, referencesStmt, path.String); err != nil {
+				return fmt.Errorf("failed to count reports of artifact %s: %w", path.String, err)
+			}
+			if references == 1 {
+				if err := deleteArtifact(ctx, path.String); err != nil {
+					return fmt.Errorf("failed to delete artifact %s of report %s: %w", path.String, id, err)
+				}
+			}
+		}
+		if _, err := tx.ExecContext(ctx, deleteStmt, userID, id); err != nil {
+			return fmt.Errorf("failed to delete report %s for user %s: %w", id, userID, err)
+		}
+		return nil
+	})
+}
+
+// Cancel - mark a report that is not done yet as cancelled, sql.ErrNoRows when it is already done
+func (s *ReportStore) Cancel(ctx context.Context, userID uuid.UUID, id uuid.UUID) (*Report, error) {
+	const prepareStmt = `
+UPDATE reports
+SET cancelled_at = $3
+WHERE user_id = $1 AND id = $2
+  AND cancelled_at IS NULL AND completed_at IS NULL AND failed_at IS NULL
+RETURNING *;
+	`
+	var report Report
+	err := s.withTx(ctx, func(tx *sqlx.Tx) error {
+		if err := tx.GetContext(ctx, &report, prepareStmt, userID, id, time.Now().UTC()); err != nil {
+			return fmt.Errorf("failed to cancel report %s for user %s: %w", id, userID, err)
+		}
+		return notifyStatus(ctx, tx, &report)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// Delete - remove report row, sql.ErrNoRows when it does not exist
+func (s *ReportStore) Delete(ctx context.Context, userID uuid.UUID, id uuid.UUID) error {
+	const prepareStmt = `DELETE FROM reports WHERE user_id = $1 AND id = $2;`
+	result, err := s.db.ExecContext(ctx, prepareStmt, userID, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete report %s for user %s: %w", id, userID, err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to delete report %s for user %s: %w", id, userID, err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("failed to delete report %s for user %s: %w", id, userID, sql.ErrNoRows)
+	}
+	return nil
+}
+
 func (s *ReportStore) ByPrimaryKey(ctx context.Context, userID uuid.UUID, id uuid.UUID) (*Report, error) {
 	const prepareStmt = `SELECT * FROM reports WHERE user_id = $1 AND id = $2;`
 	var report Report
@@ -101,3 +247,98 @@ func (s *ReportStore) ByPrimaryKey(ctx context.Context, userID uuid.UUID, id uui
 	}
 	return &report, nil
 }
+
+// statusConditions - sql condition matching each value of Report.Status
+var statusConditions = map[string]string{
+	"cancelled":  "cancelled_at IS NOT NULL",
+	"requested":  "cancelled_at IS NULL AND started_at IS NULL",
+	"processing": "cancelled_at IS NULL AND started_at IS NOT NULL AND completed_at IS NULL AND failed_at IS NULL",
+	"completed":  "cancelled_at IS NULL AND completed_at IS NOT NULL",
+	"failed":     "cancelled_at IS NULL AND failed_at IS NOT NULL AND completed_at IS NULL",
+}
+
+// ReportCursor - position of the last report of a page, ordered by created_at then id
+type ReportCursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+// Encode - opaque cursor string handed to the client
+func (c ReportCursor) Encode() string {
+	raw := fmt.Sprintf("%s|%s", c.CreatedAt.UTC().Format(time.RFC3339Nano), c.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeReportCursor - parse cursor string produced by ReportCursor.Encode
+func DecodeReportCursor(cursor string) (*ReportCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor: %w", err)
+	}
+	createdAtStr, idStr, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, createdAtStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor: %w", err)
+	}
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor: %w", err)
+	}
+	return &ReportCursor{CreatedAt: createdAt, ID: id}, nil
+}
+
+// ListReportsFilter - filter and page of ReportStore.List
+type ListReportsFilter struct {
+	Status        string
+	ReportType    string
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	Cursor        *ReportCursor
+	Limit         int
+}
+
+// List - reports of user newest first, next cursor is nil on the last page
+func (s *ReportStore) List(ctx context.Context, userID uuid.UUID, filter ListReportsFilter) ([]Report, *ReportCursor, error) {
+	conditions := []string{"user_id = $1"}
+	args := []any{userID}
+	if filter.Status != "" {
+		condition, ok := statusConditions[filter.Status]
+		if !ok {
+			return nil, nil, fmt.Errorf("unknown report status %q", filter.Status)
+		}
+		conditions = append(conditions, condition)
+	}
+	if filter.ReportType != "" {
+		args = append(args, filter.ReportType)
+		conditions = append(conditions, fmt.Sprintf("report_type = $%d", len(args)))
+	}
+	if filter.CreatedAfter != nil {
+		args = append(args, filter.CreatedAfter.UTC())
+		conditions = append(conditions, fmt.Sprintf("created_at >= $%d", len(args)))
+	}
+	if filter.CreatedBefore != nil {
+		args = append(args, filter.CreatedBefore.UTC())
+		conditions = append(conditions, fmt.Sprintf("created_at < $%d", len(args)))
+	}
+	if filter.Cursor != nil {
+		args = append(args, filter.Cursor.CreatedAt.UTC(), filter.Cursor.ID)
+		conditions = append(conditions, fmt.Sprintf("(created_at, id) < ($%d, $%d)", len(args)-1, len(args)))
+	}
+	args = append(args, filter.Limit+1)
+	query := fmt.Sprintf(`SELECT * FROM reports WHERE %s ORDER BY created_at DESC, id DESC LIMIT $%d;`,
+		strings.Join(conditions, " AND "), len(args))
+
+	var reports []Report
+	if err := s.db.SelectContext(ctx, &reports, query, args...); err != nil {
+		return nil, nil, fmt.Errorf("failed to list reports for user %s: %w", userID, err)
+	}
+	if len(reports) <= filter.Limit {
+		return reports, nil, nil
+	}
+	reports = reports[:filter.Limit]
+	last := reports[len(reports)-1]
+	return reports, &ReportCursor{CreatedAt: last.CreatedAt, ID: last.ID}, nil
+}
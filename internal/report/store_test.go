@@ -3,7 +3,9 @@ package report_test
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"net/http"
 	"strings"
 	"testing"
 	"time"
@@ -11,6 +13,7 @@ import (
 	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/google/uuid"
 	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/config"
 	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/db"
 	"github.com/leetcode-golang-classroom/golang-async-api/internal/report"
@@ -49,10 +52,22 @@ func TestReportStore(t *testing.T) {
 	require.NoError(t, err)
 
 	now := time.Now().UTC()
-	report1, err := reportStore.Create(ctx, user1.ID, "monsters")
+	report1, err := reportStore.Create(ctx, user1.ID, "monsters", report.ReportOptions{
+		Game:         report.GameBOTW,
+		OutputFormat: report.FormatParquet,
+		Parameters: report.ReportParameters{
+			Columns: []string{"name", "drops"},
+			Sort:    "-name",
+		},
+	})
 	require.NoError(t, err)
 	assert.Equal(t, user1.ID, report1.UserID)
 	assert.Equal(t, "monsters", report1.ReportType)
+	assert.Equal(t, report.GameBOTW, report1.Game)
+	assert.Equal(t, report.FormatParquet, report1.OutputFormat)
+	assert.Equal(t, report.CompressionNone, report1.Compression)
+	assert.Equal(t, []string{"name", "drops"}, report1.Parameters.Columns)
+	assert.Equal(t, "-name", report1.Parameters.Sort)
 	assert.Less(t, now.UnixNano(), report1.CreatedAt.UnixNano())
 	startedAt := report1.CreatedAt.Add(time.Second)
 	completedAt := report1.CreatedAt.Add(2 * time.Second)
@@ -117,3 +132,417 @@ func TestReportStore(t *testing.T) {
 		require.NoError(t, err)
 	}
 }
+
+func TestReportStoreList(t *testing.T) {
+	db, m := SetupDB(t)
+	defer db.Close()
+	ctx := context.Background()
+	reportStore := report.NewReportStore(db)
+	userStore := user.NewUserStore(db)
+	user1, err := userStore.CreateUser(ctx, "list@test.com", "secretpassword")
+	require.NoError(t, err)
+
+	var created []*report.Report
+	for _, reportType := range []string{"monsters", "creatures", "monsters"} {
+		createdReport, err := reportStore.Create(ctx, user1.ID, reportType, report.ReportOptions{})
+		require.NoError(t, err)
+		created = append(created, createdReport)
+	}
+	created[0].StartedAt = sql.NullTime{Time: created[0].CreatedAt, Valid: true}
+	created[0].CompletedAt = sql.NullTime{Time: created[0].CreatedAt, Valid: true}
+	_, err = reportStore.Update(ctx, created[0])
+	require.NoError(t, err)
+
+	page1, cursor, err := reportStore.List(ctx, user1.ID, report.ListReportsFilter{Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, page1, 2)
+	require.NotNil(t, cursor)
+	assert.Equal(t, created[2].ID, page1[0].ID)
+	assert.Equal(t, created[1].ID, page1[1].ID)
+
+	page2, cursor, err := reportStore.List(ctx, user1.ID, report.ListReportsFilter{Limit: 2, Cursor: cursor})
+	require.NoError(t, err)
+	require.Len(t, page2, 1)
+	assert.Nil(t, cursor)
+	assert.Equal(t, created[0].ID, page2[0].ID)
+
+	monsters, _, err := reportStore.List(ctx, user1.ID, report.ListReportsFilter{Limit: 10, ReportType: "monsters"})
+	require.NoError(t, err)
+	assert.Len(t, monsters, 2)
+
+	completed, _, err := reportStore.List(ctx, user1.ID, report.ListReportsFilter{Limit: 10, Status: "completed"})
+	require.NoError(t, err)
+	require.Len(t, completed, 1)
+	assert.Equal(t, created[0].ID, completed[0].ID)
+
+	createdAfter := created[2].CreatedAt
+	recent, _, err := reportStore.List(ctx, user1.ID, report.ListReportsFilter{Limit: 10, CreatedAfter: &createdAfter})
+	require.NoError(t, err)
+	require.Len(t, recent, 1)
+	assert.Equal(t, created[2].ID, recent[0].ID)
+	if err := m.Down(); err != nil {
+		require.NoError(t, err)
+	}
+}
+
+func TestReportStoreCancel(t *testing.T) {
+	db, m := SetupDB(t)
+	defer db.Close()
+	ctx := context.Background()
+	reportStore := report.NewReportStore(db)
+	userStore := user.NewUserStore(db)
+	user1, err := userStore.CreateUser(ctx, "cancel@test.com", "secretpassword")
+	require.NoError(t, err)
+
+	report1, err := reportStore.Create(ctx, user1.ID, "monsters", report.ReportOptions{})
+	require.NoError(t, err)
+	cancelled, err := reportStore.Cancel(ctx, user1.ID, report1.ID)
+	require.NoError(t, err)
+	assert.True(t, cancelled.CancelledAt.Valid)
+	assert.Equal(t, "cancelled", cancelled.Status())
+
+	// update from a running build must not clear the cancellation
+	cancelled.StartedAt = sql.NullTime{Time: time.Now().UTC(), Valid: true}
+	updated, err := reportStore.Update(ctx, cancelled)
+	require.NoError(t, err)
+	assert.True(t, updated.CancelledAt.Valid)
+
+	_, err = reportStore.Cancel(ctx, user1.ID, report1.ID)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	// a build cancelled after it was claimed could not complete the report
+	report2, err := reportStore.Create(ctx, user1.ID, "monsters", report.ReportOptions{})
+	require.NoError(t, err)
+	claimed, err := reportStore.Claim(ctx, user1.ID, report2.ID, "worker-1", time.Minute)
+	require.NoError(t, err)
+	_, err = reportStore.Cancel(ctx, user1.ID, report2.ID)
+	require.NoError(t, err)
+	claimed.OutputFilePath = sql.NullString{String: "users/cancelled.csv", Valid: true}
+	_, err = reportStore.Complete(ctx, claimed, "worker-1")
+	require.ErrorIs(t, err, report.ErrReportCancelled)
+	stored, err := reportStore.ByPrimaryKey(ctx, user1.ID, report2.ID)
+	require.NoError(t, err)
+	assert.False(t, stored.CompletedAt.Valid)
+	assert.False(t, stored.OutputFilePath.Valid)
+	if err := m.Down(); err != nil {
+		require.NoError(t, err)
+	}
+}
+
+func TestReportStoreDelete(t *testing.T) {
+	db, m := SetupDB(t)
+	defer db.Close()
+	ctx := context.Background()
+	reportStore := report.NewReportStore(db)
+	userStore := user.NewUserStore(db)
+	user1, err := userStore.CreateUser(ctx, "delete@test.com", "secretpassword")
+	require.NoError(t, err)
+
+	report1, err := reportStore.Create(ctx, user1.ID, "monsters", report.ReportOptions{})
+	require.NoError(t, err)
+	require.NoError(t, reportStore.Delete(ctx, user1.ID, report1.ID))
+
+	_, err = reportStore.ByPrimaryKey(ctx, user1.ID, report1.ID)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+	require.ErrorIs(t, reportStore.Delete(ctx, user1.ID, report1.ID), sql.ErrNoRows)
+	if err := m.Down(); err != nil {
+		require.NoError(t, err)
+	}
+}
+
+func TestReportStoreAttempts(t *testing.T) {
+	db, m := SetupDB(t)
+	defer db.Close()
+	ctx := context.Background()
+	reportStore := report.NewReportStore(db)
+	userStore := user.NewUserStore(db)
+	user1, err := userStore.CreateUser(ctx, "attempts@test.com", "secretpassword")
+	require.NoError(t, err)
+
+	report1, err := reportStore.Create(ctx, user1.ID, "monsters", report.ReportOptions{})
+	require.NoError(t, err)
+
+	attempt1, err := reportStore.StartAttempt(ctx, user1.ID, report1.ID, "worker-1")
+	require.NoError(t, err)
+	attempt1, err = reportStore.FinishAttempt(ctx, attempt1, "upstream unavailable")
+	require.NoError(t, err)
+	assert.True(t, attempt1.FinishedAt.Valid)
+	assert.Equal(t, "upstream unavailable", attempt1.ErrorMessage.String)
+
+	_, err = reportStore.ResetForRetry(ctx, user1.ID, report1.ID)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	now := time.Now().UTC()
+	report1.StartedAt = sql.NullTime{Time: now, Valid: true}
+	report1.FailedAt = sql.NullTime{Time: now, Valid: true}
+	report1.ErrorMessage = sql.NullString{String: "upstream unavailable", Valid: true}
+	_, err = reportStore.Update(ctx, report1)
+	require.NoError(t, err)
+
+	reset, err := reportStore.ResetForRetry(ctx, user1.ID, report1.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "requested", reset.Status())
+	assert.False(t, reset.ErrorMessage.Valid)
+	assert.True(t, reset.RetriedAt.Valid)
+	// attempts before the retry do not count towards the reaper limit
+	sinceRetry, err := reportStore.AttemptsSinceRetry(ctx, reset)
+	require.NoError(t, err)
+	assert.Zero(t, sinceRetry)
+
+	attempt2, err := reportStore.StartAttempt(ctx, user1.ID, report1.ID, "worker-2")
+	require.NoError(t, err)
+	_, err = reportStore.FinishAttempt(ctx, attempt2, "")
+	require.NoError(t, err)
+
+	attempts, err := reportStore.Attempts(ctx, user1.ID, report1.ID)
+	require.NoError(t, err)
+	require.Len(t, attempts, 2)
+	assert.Equal(t, "worker-1", attempts[0].WorkerID)
+	assert.Equal(t, "worker-2", attempts[1].WorkerID)
+	assert.False(t, attempts[1].ErrorMessage.Valid)
+	sinceRetry, err = reportStore.AttemptsSinceRetry(ctx, reset)
+	require.NoError(t, err)
+	assert.Equal(t, 1, sinceRetry)
+	if err := m.Down(); err != nil {
+		require.NoError(t, err)
+	}
+}
+
+func TestReportStoreLease(t *testing.T) {
+	db, m := SetupDB(t)
+	defer db.Close()
+	ctx := context.Background()
+	reportStore := report.NewReportStore(db)
+	userStore := user.NewUserStore(db)
+	user1, err := userStore.CreateUser(ctx, "lease@test.com", "secretpassword")
+	require.NoError(t, err)
+
+	report1, err := reportStore.Create(ctx, user1.ID, "monsters", report.ReportOptions{})
+	require.NoError(t, err)
+
+	claimed, err := reportStore.Claim(ctx, user1.ID, report1.ID, "worker-1", time.Millisecond)
+	require.NoError(t, err)
+	assert.Equal(t, "worker-1", claimed.WorkerID.String)
+	assert.Equal(t, "processing", claimed.Status())
+
+	time.Sleep(10 * time.Millisecond)
+	stale, err := reportStore.StaleReports(ctx, time.Now().UTC(), 10)
+	require.NoError(t, err)
+	require.Len(t, stale, 1)
+
+	// an expired lease could be taken over and the previous worker can not renew it anymore
+	claimed, err = reportStore.Claim(ctx, user1.ID, report1.ID, "worker-2", time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, "worker-2", claimed.WorkerID.String)
+	require.ErrorIs(t, reportStore.RenewLease(ctx, user1.ID, report1.ID, "worker-1", time.Minute), sql.ErrNoRows)
+	require.NoError(t, reportStore.RenewLease(ctx, user1.ID, report1.ID, "worker-2", time.Minute))
+	_, err = reportStore.Claim(ctx, user1.ID, report1.ID, "worker-3", time.Minute)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	_, err = reportStore.Requeue(ctx, claimed, time.Now().UTC())
+	require.ErrorIs(t, err, sql.ErrNoRows)
+	requeued, err := reportStore.Requeue(ctx, claimed, time.Now().UTC().Add(2*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, "requested", requeued.Status())
+	assert.False(t, requeued.WorkerID.Valid)
+
+	// only the worker holding a valid lease could record the outcome
+	claimed, err = reportStore.Claim(ctx, user1.ID, report1.ID, "worker-4", time.Millisecond)
+	require.NoError(t, err)
+	time.Sleep(10 * time.Millisecond)
+	claimed.OutputFilePath = sql.NullString{String: "users/lease.csv", Valid: true}
+	_, err = reportStore.Complete(ctx, claimed, "worker-4")
+	require.ErrorIs(t, err, report.ErrLeaseLost)
+	claimed, err = reportStore.Claim(ctx, user1.ID, report1.ID, "worker-5", time.Minute)
+	require.NoError(t, err)
+	_, err = reportStore.Fail(ctx, claimed, "worker-4", "stale worker")
+	require.ErrorIs(t, err, report.ErrLeaseLost)
+	claimed.OutputFilePath = sql.NullString{String: "users/lease.csv", Valid: true}
+	completed, err := reportStore.Complete(ctx, claimed, "worker-5")
+	require.NoError(t, err)
+	assert.Equal(t, "completed", completed.Status())
+	assert.Equal(t, "users/lease.csv", completed.OutputFilePath.String)
+	_, err = reportStore.Fail(ctx, claimed, "worker-5", "too late")
+	require.ErrorIs(t, err, report.ErrLeaseLost)
+	if err := m.Down(); err != nil {
+		require.NoError(t, err)
+	}
+}
+
+func TestReportStoreOutbox(t *testing.T) {
+	db, m := SetupDB(t)
+	defer db.Close()
+	ctx := context.Background()
+	reportStore := report.NewReportStore(db)
+	userStore := user.NewUserStore(db)
+	user1, err := userStore.CreateUser(ctx, "outbox@test.com", "secretpassword")
+	require.NoError(t, err)
+
+	report1, err := reportStore.Create(ctx, user1.ID, "monsters", report.ReportOptions{})
+	require.NoError(t, err)
+	messages, err := reportStore.OutboxMessages(ctx, user1.ID, report1.ID)
+	require.NoError(t, err)
+	require.Len(t, messages, 1)
+	assert.False(t, messages[0].SentAt.Valid)
+
+	// a failed publish is kept and rescheduled
+	handled, err := reportStore.PublishOutbox(ctx, 10, func(ctx context.Context, message report.QueueMessage) error {
+		return fmt.Errorf("queue unavailable")
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, handled)
+	messages, err = reportStore.OutboxMessages(ctx, user1.ID, report1.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, messages[0].Attempts)
+	assert.Equal(t, "queue unavailable", messages[0].LastError.String)
+	assert.True(t, messages[0].NextAttemptAt.After(time.Now().UTC()))
+
+	_, err = db.ExecContext(ctx, `UPDATE report_outbox SET next_attempt_at = $1`, time.Now().UTC().Add(-time.Second))
+	require.NoError(t, err)
+	var published []report.QueueMessage
+	handled, err = reportStore.PublishOutbox(ctx, 10, func(ctx context.Context, message report.QueueMessage) error {
+		published = append(published, message)
+		// a claimed message is hidden from other relays while it is published
+		concurrent, err := reportStore.PublishOutbox(ctx, 10, func(ctx context.Context, message report.QueueMessage) error {
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 0, concurrent)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, handled)
+	require.Len(t, published, 1)
+	assert.Equal(t, report1.ID, published[0].ReportID)
+	messages, err = reportStore.OutboxMessages(ctx, user1.ID, report1.ID)
+	require.NoError(t, err)
+	assert.True(t, messages[0].SentAt.Valid)
+
+	handled, err = reportStore.PublishOutbox(ctx, 10, func(ctx context.Context, message report.QueueMessage) error {
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 0, handled)
+	if err := m.Down(); err != nil {
+		require.NoError(t, err)
+	}
+}
+
+func TestReportStoreIdempotency(t *testing.T) {
+	db, m := SetupDB(t)
+	defer db.Close()
+	ctx := context.Background()
+	reportStore := report.NewReportStore(db)
+	userStore := user.NewUserStore(db)
+	user1, err := userStore.CreateUser(ctx, "idempotency@test.com", "secretpassword")
+	require.NoError(t, err)
+
+	request := report.IdempotentRequest{Key: "retry-1", RequestHash: "hash-1", TTL: time.Hour}
+	key, replayed, err := reportStore.CreateIdempotent(ctx, user1.ID, "monsters", report.ReportOptions{}, request)
+	require.NoError(t, err)
+	assert.False(t, replayed)
+	assert.Equal(t, http.StatusCreated, key.ResponseStatus)
+	var created report.ApiReport
+	require.NoError(t, json.Unmarshal(key.ResponseBody, &created))
+
+	replay, replayed, err := reportStore.CreateIdempotent(ctx, user1.ID, "monsters", report.ReportOptions{}, request)
+	require.NoError(t, err)
+	assert.True(t, replayed)
+	var replayedReport report.ApiReport
+	require.NoError(t, json.Unmarshal(replay.ResponseBody, &replayedReport))
+	assert.Equal(t, created.ID, replayedReport.ID)
+	// the replay did not create a second report or queue message
+	reports, _, err := reportStore.List(ctx, user1.ID, report.ListReportsFilter{Limit: 10})
+	require.NoError(t, err)
+	assert.Len(t, reports, 1)
+
+	_, _, err = reportStore.CreateIdempotent(ctx, user1.ID, "monsters", report.ReportOptions{},
+		report.IdempotentRequest{Key: "retry-1", RequestHash: "hash-2", TTL: time.Hour})
+	assert.ErrorIs(t, err, report.ErrIdempotencyKeyReused)
+
+	// an expired key is forgotten
+	_, err = db.ExecContext(ctx, `UPDATE idempotency_keys SET expires_at = $1`, time.Now().UTC().Add(-time.Second))
+	require.NoError(t, err)
+	_, replayed, err = reportStore.CreateIdempotent(ctx, user1.ID, "monsters", report.ReportOptions{},
+		report.IdempotentRequest{Key: "retry-1", RequestHash: "hash-2", TTL: time.Hour})
+	require.NoError(t, err)
+	assert.False(t, replayed)
+	if err := m.Down(); err != nil {
+		require.NoError(t, err)
+	}
+}
+
+func TestReportStoreReuse(t *testing.T) {
+	db, m := SetupDB(t)
+	defer db.Close()
+	ctx := context.Background()
+	reportStore := report.NewReportStore(db)
+	userStore := user.NewUserStore(db)
+	user1, err := userStore.CreateUser(ctx, "reuse@test.com", "secretpassword")
+	require.NoError(t, err)
+
+	options := report.ReportOptions{
+		Parameters: report.ReportParameters{Columns: []string{"name"}},
+		Reuse:      true,
+	}
+	source, err := reportStore.Create(ctx, user1.ID, "monsters", options)
+	require.NoError(t, err)
+	report1, err := reportStore.Create(ctx, user1.ID, "monsters", options)
+	require.NoError(t, err)
+	assert.True(t, report1.Reuse)
+
+	_, err = reportStore.FindReusable(ctx, report1, time.Now().UTC().Add(-time.Minute))
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	source.OutputFilePath = sql.NullString{String: "users/source.csv.gz", Valid: true}
+	source.CompletedAt = sql.NullTime{Time: time.Now().UTC(), Valid: true}
+	_, err = reportStore.Update(ctx, source)
+	require.NoError(t, err)
+
+	found, err := reportStore.FindReusable(ctx, report1, time.Now().UTC().Add(-time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, source.ID, found.ID)
+	// reports older than the window or with other parameters are not reused
+	_, err = reportStore.FindReusable(ctx, report1, time.Now().UTC().Add(time.Minute))
+	require.ErrorIs(t, err, sql.ErrNoRows)
+	other := *report1
+	other.Parameters = report.ReportParameters{Columns: []string{"id"}}
+	_, err = reportStore.FindReusable(ctx, &other, time.Now().UTC().Add(-time.Minute))
+	require.ErrorIs(t, err, sql.ErrNoRows)
+	// reports of other users are not reused
+	user2, err := userStore.CreateUser(ctx, "reuse2@test.com", "secretpassword")
+	require.NoError(t, err)
+	report2, err := reportStore.Create(ctx, user2.ID, "monsters", options)
+	require.NoError(t, err)
+	_, err = reportStore.FindReusable(ctx, report2, time.Now().UTC().Add(-time.Minute))
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	report1.OutputFilePath = found.OutputFilePath
+	report1.ReusedFrom = uuid.NullUUID{UUID: found.ID, Valid: true}
+	report1.CompletedAt = sql.NullTime{Time: time.Now().UTC(), Valid: true}
+	updated, err := reportStore.Update(ctx, report1)
+	require.NoError(t, err)
+	require.NotNil(t, report.NewApiReport(updated).ReusedFrom)
+	assert.Equal(t, source.ID, *report.NewApiReport(updated).ReusedFrom)
+	// the artifact is only deleted with the last report pointing at it
+	var deleted []string
+	deleteArtifact := func(ctx context.Context, path string) error {
+		deleted = append(deleted, path)
+		return nil
+	}
+	require.NoError(t, reportStore.DeleteWithArtifact(ctx, user1.ID, source.ID, deleteArtifact))
+	assert.Empty(t, deleted)
+	// the row is kept for a retry when the artifact could not be deleted
+	err = reportStore.DeleteWithArtifact(ctx, user1.ID, report1.ID, func(ctx context.Context, path string) error {
+		return fmt.Errorf("blob store unavailable")
+	})
+	require.Error(t, err)
+	_, err = reportStore.ByPrimaryKey(ctx, user1.ID, report1.ID)
+	require.NoError(t, err)
+	require.NoError(t, reportStore.DeleteWithArtifact(ctx, user1.ID, report1.ID, deleteArtifact))
+	assert.Equal(t, []string{"users/source.csv.gz"}, deleted)
+	require.ErrorIs(t, reportStore.DeleteWithArtifact(ctx, user1.ID, report1.ID, deleteArtifact), sql.ErrNoRows)
+	if err := m.Down(); err != nil {
+		require.NoError(t, err)
+	}
+}
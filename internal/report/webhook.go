@@ -0,0 +1,35 @@
+package report
+
+import (
+	"context"
+	"time"
+
+	"github.com/leetcode-golang-classroom/golang-async-api/internal/webhook"
+)
+
+// DefaultWebhookDownloadURLExpiry - how long the download url in a completion webhook stays valid
+const DefaultWebhookDownloadURLExpiry = time.Hour
+
+// EnqueueWebhooks - queue the report.completed or report.failed deliveries of report to the account
+// webhooks of the user and to the webhook given with the report
+func EnqueueWebhooks(ctx context.Context, webhookStore *webhook.WebhookStore, report *Report, apiReport *ApiReport) error {
+	eventType := webhook.EventReportFailed
+	if report.CompletedAt.Valid {
+		eventType = webhook.EventReportCompleted
+	}
+	var endpoint *webhook.Endpoint
+	if report.WebhookURL.Valid {
+		endpoint = &webhook.Endpoint{
+			URL:    report.WebhookURL.String,
+			Secret: report.WebhookSecret.String,
+		}
+	}
+	_, err := webhookStore.Enqueue(ctx, webhook.Event{
+		Type:      eventType,
+		UserID:    report.UserID,
+		ReportID:  report.ID,
+		CreatedAt: time.Now().UTC(),
+		Data:      apiReport,
+	}, endpoint)
+	return err
+}
@@ -2,124 +2,319 @@ package report
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"sync"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/sqs"
-	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/google/uuid"
+	"github.com/leetcode-golang-classroom/golang-async-api/internal/deadletter"
 	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/config"
+	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/queue"
 )
 
+const (
+	// cancellationPollInterval - how often a running build checks whether its report was cancelled
+	cancellationPollInterval = time.Second
+	// releaseTimeout - how long releasing a message may take once the worker is shutting down
+	releaseTimeout = 5 * time.Second
+	// DefaultMaxReceiveCount - deliveries of a failing message before it is moved to the dead letters
+	DefaultMaxReceiveCount = 5
+)
+
+// ErrWorkerShutdown - cause of the build context when the shutdown grace period is over
+var ErrWorkerShutdown = errors.New("worker shutting down")
+
+// errPoisonMessage - message that could never be processed, quarantined on its first delivery
+var errPoisonMessage = errors.New("poison message")
+
 type Worker struct {
-	appConfig   *config.Config
-	builder     *ReportBuilder
-	logger      *slog.Logger
-	sqsClient   *sqs.Client
-	channel     chan types.Message
-	concurrency int32
+	appConfig       *config.Config
+	builder         *ReportBuilder
+	reportStore     *ReportStore
+	deadLetterStore *deadletter.DeadLetterStore
+	logger          *slog.Logger
+	queue           queue.Queue
+	channel         chan queue.Message
+	// idle - one token per idle goroutine, messages are only received for idle goroutines so none waits
+	// unhandled, and without a visibility heartbeat, behind a long build
+	idle            chan struct{}
+	workerConfig    config.WorkerConfig
+	maxReceiveCount int
 }
 
 func NewWorker(
 	appConfig *config.Config,
 	builder *ReportBuilder,
+	reportStore *ReportStore,
+	deadLetterStore *deadletter.DeadLetterStore,
 	logger *slog.Logger,
-	sqsClient *sqs.Client,
-	maxCucurrency int32,
+	q queue.Queue,
+	workerConfig config.WorkerConfig,
 ) *Worker {
 	return &Worker{
-		appConfig:   appConfig,
-		builder:     builder,
-		logger:      logger,
-		sqsClient:   sqsClient,
-		channel:     make(chan types.Message, maxCucurrency),
-		concurrency: maxCucurrency,
+		appConfig:       appConfig,
+		builder:         builder,
+		reportStore:     reportStore,
+		deadLetterStore: deadLetterStore,
+		logger:          logger,
+		queue:           q,
+		channel:         make(chan queue.Message),
+		idle:            make(chan struct{}, workerConfig.Concurrency),
+		workerConfig:    workerConfig,
+		maxReceiveCount: DefaultMaxReceiveCount,
 	}
 }
 
+// Start - receive and build reports until ctx is done, then drain: in-flight builds get the shutdown grace period
+// to finish, messages that were received but not started are released back to the queue
 func (w *Worker) Start(ctx context.Context) error {
-	queueURLOutput, err := w.sqsClient.GetQueueUrl(ctx, &sqs.GetQueueUrlInput{
-		QueueName: aws.String(w.appConfig.SQSQueue),
-	})
-	if err != nil {
-		return fmt.Errorf("failed to get url for queue %s: %w", w.appConfig.SQSQueue, err)
-	}
 	w.logger.InfoContext(ctx, "starting worker", slog.String(
 		"queue", w.appConfig.SQSQueue,
-	), slog.String("queue_url", *queueURLOutput.QueueUrl))
+	), slog.String("queue_backend", fmt.Sprintf("%T", w.queue)),
+		slog.Int("concurrency", w.workerConfig.Concurrency))
 
-	for i := 0; i < int(w.concurrency); i++ {
+	// builds outlive ctx until the grace period is over
+	buildCtx, cancelBuilds := context.WithCancelCause(context.WithoutCancel(ctx))
+	defer cancelBuilds(nil)
+	var wg sync.WaitGroup
+	for i := 0; i < w.workerConfig.Concurrency; i++ {
+		w.idle <- struct{}{}
+		wg.Add(1)
 		go func(id int) {
+			defer wg.Done()
 			w.logger.Info(fmt.Sprintf("starting goroutine #%d", id))
-			for {
-				select {
-				case <-ctx.Done():
-					w.logger.Error("worker stopped", slog.Int("goroutine_id", id),
-						slog.Any("error", ctx.Err()),
-					)
-					return
-				case message := <-w.channel:
-					if err := w.processMessage(ctx, message); err != nil {
-						w.logger.Error("failed to process message", slog.Any("error", err),
-							slog.Int("goroutine_id", id),
-						)
-						continue
-					}
-					if _, err := w.sqsClient.DeleteMessage(ctx, &sqs.DeleteMessageInput{
-						QueueUrl:      queueURLOutput.QueueUrl,
-						ReceiptHandle: message.ReceiptHandle,
-					}); err != nil {
-						w.logger.Error("failed to delete message", slog.Any("error", err),
-							slog.Int("goroutine_id", id))
-					}
+			for message := range w.channel {
+				if ctx.Err() != nil {
+					w.release(buildCtx, message)
+				} else {
+					w.handleMessage(buildCtx, id, message)
 				}
+				w.idle <- struct{}{}
 			}
+			w.logger.Info("worker goroutine stopped", slog.Int("goroutine_id", id))
 		}(i)
 	}
 
+	w.receive(ctx)
+	close(w.channel)
+	return w.drain(&wg, cancelBuilds)
+}
+
+// receive - feed received messages to the goroutines until ctx is done, at most one message is received
+// per idle goroutine so every message is handed over, and its heartbeat started, right away
+func (w *Worker) receive(ctx context.Context) {
+	// consecutive receive errors, the wait before the next receive grows with each of them
+	var receiveErrors int
 	for {
-		output, err := w.sqsClient.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
-			QueueUrl:            queueURLOutput.QueueUrl,
-			MaxNumberOfMessages: w.concurrency + 1,
-		})
+		idle, ok := w.acquireIdle(ctx)
+		if !ok {
+			return
+		}
+		messages, err := w.queue.Receive(ctx, idle, w.workerConfig.ReceiveWaitTime)
+		// goroutines without a message stay idle
+		for range idle - len(messages) {
+			w.idle <- struct{}{}
+		}
 		if err != nil {
-			w.logger.Error("failed to receive message", slog.Any("error", err))
 			if ctx.Err() != nil {
-				return ctx.Err()
+				return
+			}
+			receiveErrors++
+			backoff := w.workerConfig.NextErrorBackoff(receiveErrors)
+			w.logger.Error("failed to receive message", slog.Any("error", err),
+				slog.Int("consecutive_errors", receiveErrors), slog.Duration("backoff", backoff))
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
 			}
+			continue
 		}
+		receiveErrors = 0
 
-		if len(output.Messages) == 0 {
-			continue
+		for i, message := range messages {
+			select {
+			case w.channel <- message:
+			case <-ctx.Done():
+				for _, unstarted := range messages[i:] {
+					w.release(ctx, unstarted)
+				}
+				return
+			}
 		}
-		for _, message := range output.Messages {
-			w.channel <- message
+	}
+}
+
+// acquireIdle - wait for an idle goroutine and take the other idle ones up to the receive batch size,
+// false once ctx is done
+func (w *Worker) acquireIdle(ctx context.Context) (int, bool) {
+	select {
+	case <-w.idle:
+	case <-ctx.Done():
+		return 0, false
+	}
+	idle := 1
+	for idle < w.workerConfig.ReceiveBatchSize {
+		select {
+		case <-w.idle:
+			idle++
+		default:
+			return idle, true
 		}
+	}
+	return idle, true
+}
 
+// drain - wait for the goroutines, builds still running after the grace period are stopped with ErrWorkerShutdown
+func (w *Worker) drain(wg *sync.WaitGroup, cancelBuilds context.CancelCauseFunc) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	w.logger.Info("worker stopped receiving, draining in-flight builds",
+		slog.Duration("grace_period", w.workerConfig.ShutdownGracePeriod))
+	select {
+	case <-done:
+	case <-time.After(w.workerConfig.ShutdownGracePeriod):
+		w.logger.Warn("shutdown grace period is over, stopping in-flight builds")
+		cancelBuilds(ErrWorkerShutdown)
+		<-done
 	}
+	w.logger.Info("worker drained")
+	return nil
 }
 
-func (w *Worker) processMessage(ctx context.Context, message types.Message) error {
-	w.logger.InfoContext(ctx, "processing message", slog.String("message_id", *message.MessageId))
-	if message.Body == nil || *message.Body == "" {
-		w.logger.ErrorContext(ctx, "message body is empty", slog.String("message_id", *message.MessageId))
-		return nil
+func (w *Worker) handleMessage(ctx context.Context, id int, message queue.Message) {
+	// keep the message hidden from other receivers while the build runs
+	// heartbeats happen well before the visibility timeout runs out
+	visibilityTimeout := w.workerConfig.VisibilityTimeout
+	stopHeartbeat := queue.Heartbeat(ctx, w.queue, message, visibilityTimeout, visibilityTimeout/3, w.logger)
+	err := w.processMessage(ctx, message)
+	stopHeartbeat()
+	if err != nil {
+		if errors.Is(err, ErrWorkerShutdown) {
+			w.release(ctx, message)
+			return
+		}
+		w.logger.Error("failed to process message", slog.Any("error", err),
+			slog.Int("goroutine_id", id), slog.Int("receive_count", message.ReceiveCount),
+		)
+		// left on the queue for redelivery until it runs out of deliveries
+		if !errors.Is(err, errPoisonMessage) && message.ReceiveCount < w.maxReceiveCount {
+			return
+		}
+		if err := w.quarantine(ctx, message, err); err != nil {
+			w.logger.Error("failed to quarantine message", slog.Any("error", err),
+				slog.Int("goroutine_id", id))
+			return
+		}
+	}
+	if err := w.queue.Ack(ctx, message); err != nil {
+		w.logger.Error("failed to delete message", slog.Any("error", err),
+			slog.Int("goroutine_id", id))
 	}
+}
+
+// release - make a message that will not be processed here visible to other workers right away
+func (w *Worker) release(ctx context.Context, message queue.Message) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), releaseTimeout)
+	defer cancel()
+	if err := w.queue.ExtendVisibility(ctx, message, 0); err != nil {
+		w.logger.Warn("failed to release message", slog.String("message_id", message.ID), slog.Any("error", err))
+		return
+	}
+	w.logger.Info("released message back to the queue", slog.String("message_id", message.ID))
+}
 
-	var msg SQSMessage
-	if err := json.Unmarshal([]byte(*message.Body), &msg); err != nil {
-		w.logger.Warn("message body is invalid", slog.String("message_id", *message.MessageId), slog.String("body", *message.Body))
-		return nil
+func (w *Worker) processMessage(ctx context.Context, message queue.Message) error {
+	w.logger.InfoContext(ctx, "processing message", slog.String("message_id", message.ID))
+	if len(message.Body) == 0 {
+		return fmt.Errorf("%w: message body is empty", errPoisonMessage)
+	}
+
+	var msg QueueMessage
+	if err := json.Unmarshal(message.Body, &msg); err != nil {
+		return fmt.Errorf("%w: message body is invalid: %w", errPoisonMessage, err)
+	}
+	if msg.UserID == uuid.Nil || msg.ReportID == uuid.Nil {
+		return fmt.Errorf("%w: message has no user_id or report_id", errPoisonMessage)
 	}
 
-	builderCtx, builderCancel := context.WithTimeout(ctx, time.Second*10)
-	defer builderCancel()
+	// the build timeout of the report type is applied by the builder
+	builderCtx, builderCancel := context.WithCancelCause(ctx)
+	defer builderCancel(nil)
+	go w.watchCancellation(builderCtx, builderCancel, msg)
 	_, err := w.builder.Build(builderCtx, msg.UserID, msg.ReportID)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			w.logger.InfoContext(ctx, "report deleted before processing", slog.String("report_id", msg.ReportID.String()))
+			return nil
+		}
+		if errors.Is(err, ErrReportCancelled) {
+			w.logger.InfoContext(ctx, "report cancelled while processing", slog.String("report_id", msg.ReportID.String()))
+			return nil
+		}
+		if cause := context.Cause(builderCtx); errors.Is(cause, ErrWorkerShutdown) && !errors.Is(err, ErrWorkerShutdown) {
+			return fmt.Errorf("%w: %w", cause, err)
+		}
+		if errors.Is(err, ErrLeaseLost) {
+			w.logger.WarnContext(ctx, "report lease taken over by another worker", slog.String("report_id", msg.ReportID.String()))
+			return nil
+		}
 		return fmt.Errorf("failed to build report: %w", err)
 	}
 
 	return nil
 }
+
+// quarantine - keep the message with its error in the dead letters, the message is acked afterwards
+func (w *Worker) quarantine(ctx context.Context, message queue.Message, cause error) error {
+	deadLetter := &deadletter.DeadLetter{
+		Queue:        w.appConfig.SQSQueue,
+		MessageID:    message.ID,
+		Body:         message.Body,
+		ErrorMessage: cause.Error(),
+		ReceiveCount: message.ReceiveCount,
+	}
+	var msg QueueMessage
+	if err := json.Unmarshal(message.Body, &msg); err == nil {
+		deadLetter.UserID = uuid.NullUUID{UUID: msg.UserID, Valid: msg.UserID != uuid.Nil}
+		deadLetter.ReportID = uuid.NullUUID{UUID: msg.ReportID, Valid: msg.ReportID != uuid.Nil}
+	}
+	deadLetter, err := w.deadLetterStore.Create(ctx, deadLetter)
+	if err != nil {
+		return err
+	}
+	w.logger.WarnContext(ctx, "message moved to dead letters", slog.String("message_id", message.ID),
+		slog.String("dead_letter_id", deadLetter.ID.String()), slog.Int("receive_count", message.ReceiveCount))
+	return nil
+}
+
+// watchCancellation - stop the build through its context once the report is cancelled
+func (w *Worker) watchCancellation(ctx context.Context, cancel context.CancelCauseFunc, msg QueueMessage) {
+	ticker := time.NewTicker(cancellationPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			report, err := w.reportStore.ByPrimaryKey(ctx, msg.UserID, msg.ReportID)
+			if err != nil {
+				if ctx.Err() == nil {
+					w.logger.WarnContext(ctx, "failed to check report cancellation", slog.Any("error", err))
+				}
+				continue
+			}
+			if report.CancelledAt.Valid {
+				cancel(ErrReportCancelled)
+				return
+			}
+		}
+	}
+}
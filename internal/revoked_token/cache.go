@@ -0,0 +1,78 @@
+package revokedtoken
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// DefaultRefreshInterval - how often the revoked tokens are reloaded, a revocation made by another
+// instance is enforced after at most this long
+const DefaultRefreshInterval = 5 * time.Second
+
+// Cache - in memory set of the revoked jti, so checking a token does not query the database.
+// The set stays small because access tokens expire within minutes
+type Cache struct {
+	store    *RevokedTokenStore
+	logger   *slog.Logger
+	interval time.Duration
+	mu       sync.RWMutex
+	revoked  map[string]struct{}
+}
+
+func NewCache(store *RevokedTokenStore, logger *slog.Logger) *Cache {
+	return &Cache{
+		store:    store,
+		logger:   logger,
+		interval: DefaultRefreshInterval,
+		revoked:  make(map[string]struct{}),
+	}
+}
+
+// IsRevoked - whether the token with jti was revoked as of the last load
+func (c *Cache) IsRevoked(jti string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	_, ok := c.revoked[jti]
+	return ok
+}
+
+// Load - replace the set with the revoked tokens in the database, called after a revocation
+// so that it is enforced by this instance right away
+func (c *Cache) Load(ctx context.Context) error {
+	jtis, err := c.store.Active(ctx)
+	if err != nil {
+		return err
+	}
+	revoked := make(map[string]struct{}, len(jtis))
+	for _, jti := range jtis {
+		revoked[jti] = struct{}{}
+	}
+	c.mu.Lock()
+	c.revoked = revoked
+	c.mu.Unlock()
+	return nil
+}
+
+// Start - reload the set every interval until ctx is done, expired revocations are deleted on the way
+func (c *Cache) Start(ctx context.Context) {
+	if err := c.Load(ctx); err != nil {
+		c.logger.ErrorContext(ctx, "failed to load revoked tokens", slog.Any("error", err))
+	}
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.store.DeleteExpired(ctx); err != nil && ctx.Err() == nil {
+				c.logger.WarnContext(ctx, "failed to delete expired revoked tokens", slog.Any("error", err))
+			}
+			if err := c.Load(ctx); err != nil && ctx.Err() == nil {
+				c.logger.ErrorContext(ctx, "failed to load revoked tokens", slog.Any("error", err))
+			}
+		}
+	}
+}
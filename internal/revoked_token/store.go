@@ -0,0 +1,41 @@
+package revokedtoken
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+)
+
+// RevokedTokenStore - jti of access tokens revoked before their expiration
+type RevokedTokenStore struct {
+	db *sqlx.DB
+}
+
+func NewRevokedTokenStore(db *sql.DB) *RevokedTokenStore {
+	return &RevokedTokenStore{
+		db: sqlx.NewDb(db, "postgres"),
+	}
+}
+
+// Active - jti of the revoked tokens that have not expired yet
+func (s *RevokedTokenStore) Active(ctx context.Context) ([]string, error) {
+	const prepareStmt = `SELECT jti FROM revoked_tokens WHERE expired_at > $1;`
+	var jtis []string
+	if err := s.db.SelectContext(ctx, &jtis, prepareStmt, time.Now().UTC()); err != nil {
+		return nil, fmt.Errorf("failed to query revoked tokens: %w", err)
+	}
+	return jtis, nil
+}
+
+// DeleteExpired - drop revocations of tokens that expired anyway
+func (s *RevokedTokenStore) DeleteExpired(ctx context.Context) error {
+	const prepareStmt = `DELETE FROM revoked_tokens WHERE expired_at <= $1;`
+	if _, err := s.db.ExecContext(ctx, prepareStmt, time.Now().UTC()); err != nil {
+		return fmt.Errorf("failed to delete expired revoked tokens: %w", err)
+	}
+	return nil
+}
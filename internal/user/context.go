@@ -0,0 +1,20 @@
+package user
+
+import "context"
+
+type userCtxKey struct{}
+
+// NewContext - ctx carrying the authenticated user, set by the auth middleware
+func NewContext(ctx context.Context, user *User) context.Context {
+	return context.WithValue(ctx, userCtxKey{}, user)
+}
+
+// FromContext - authenticated user of ctx, also used by the handlers of this package
+// that could not import util
+func FromContext(ctx context.Context) (*User, bool) {
+	user, ok := ctx.Value(userCtxKey{}).(*User)
+	if !ok || user == nil {
+		return nil, false
+	}
+	return user, true
+}
@@ -1,12 +1,12 @@
 package user
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
-	"time"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/google/uuid"
@@ -14,6 +14,7 @@ import (
 	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/jwt"
 	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/response"
 	refreshtoken "github.com/leetcode-golang-classroom/golang-async-api/internal/refresh_token"
+	revokedtoken "github.com/leetcode-golang-classroom/golang-async-api/internal/revoked_token"
 )
 
 type Handler struct {
@@ -22,11 +23,13 @@ type Handler struct {
 	userStore         *UserStore
 	refreshTokenStore *refreshtoken.RefreshTokenStore
 	jwtManager        *jwt.JWTManager
+	revokedTokens     *revokedtoken.Cache
 }
 
 func NewHandler(logger *slog.Logger, validator *validator.Validate, userStore *UserStore,
 	refreshTokenStore *refreshtoken.RefreshTokenStore,
 	jwtManager *jwt.JWTManager,
+	revokedTokens *revokedtoken.Cache,
 ) *Handler {
 	return &Handler{
 		logger:            logger,
@@ -34,6 +37,7 @@ func NewHandler(logger *slog.Logger, validator *validator.Validate, userStore *U
 		userStore:         userStore,
 		refreshTokenStore: refreshTokenStore,
 		jwtManager:        jwtManager,
+		revokedTokens:     revokedTokens,
 	}
 }
 
@@ -42,6 +46,10 @@ func (h *Handler) RegisterRoute(router *http.ServeMux) {
 	router.HandleFunc("POST /auth/signup", h.signUpHandler())
 	router.HandleFunc("POST /auth/signIn", h.signInHandler())
 	router.HandleFunc("POST /auth/refresh", h.refreshHandler())
+	router.HandleFunc("POST /auth/logout", h.logoutHandler())
+	router.HandleFunc("POST /auth/logout-all", h.logoutAllHandler())
+	router.HandleFunc("GET /auth/sessions", h.listSessionsHandler())
+	router.HandleFunc("DELETE /auth/sessions/{id}", h.revokeSessionHandler())
 }
 
 func (h *Handler) signUpHandler() http.HandlerFunc {
@@ -112,15 +120,16 @@ func (h *Handler) signInHandler() http.HandlerFunc {
 				err,
 			)
 		}
-		tokenPair, err := h.jwtManager.GenerateTokenPair(user.ID)
+		tokenPair, err := h.jwtManager.GenerateTokenPair(user.ID, user.TokenVersion)
 		if err != nil {
 			return helper.NewErrWithStatus(
 				http.StatusInternalServerError,
 				err,
 			)
 		}
-		// store refreshToken
-		_, err = h.refreshTokenStore.ResetUserToken(r.Context(), user.ID, tokenPair.RefreshToken)
+		// every sign in starts its own session, the sessions of other devices are kept
+		_, _, err = h.refreshTokenStore.CreateSession(r.Context(), user.ID, tokenPair.RefreshToken, tokenPair.AccessToken,
+			sessionInfo(r, req.Label))
 		if err != nil {
 			return helper.NewErrWithStatus(
 				http.StatusInternalServerError,
@@ -165,7 +174,7 @@ func (h *Handler) refreshHandler() http.HandlerFunc {
 			return helper.NewErrWithStatus(http.StatusUnauthorized, err)
 		}
 
-		currentRefreshTokenRecord, err := h.refreshTokenStore.ByPrimaryKey(r.Context(), userID, currentRefreshToken)
+		user, err := h.userStore.ByID(r.Context(), userID)
 		if err != nil {
 			status := http.StatusInternalServerError
 			if errors.Is(err, sql.ErrNoRows) {
@@ -173,15 +182,26 @@ func (h *Handler) refreshHandler() http.HandlerFunc {
 			}
 			return helper.NewErrWithStatus(status, err)
 		}
-		if currentRefreshTokenRecord.ExpiresAt.Before(time.Now()) {
-			return helper.NewErrWithStatus(http.StatusUnauthorized, fmt.Errorf("refresh token expired"))
-		}
-
-		tokenPair, err := h.jwtManager.GenerateTokenPair(userID)
+		tokenPair, err := h.jwtManager.GenerateTokenPair(userID, user.TokenVersion)
 		if err != nil {
 			return helper.NewErrWithStatus(http.StatusInternalServerError, err)
 		}
-		if _, err := h.refreshTokenStore.ResetUserToken(r.Context(), userID, tokenPair.RefreshToken); err != nil {
+		// the presented token is rotated into the new one, presenting it again revokes the family
+		currentRefreshTokenRecord, err := h.refreshTokenStore.Rotate(r.Context(), userID, currentRefreshToken,
+			tokenPair.RefreshToken, tokenPair.AccessToken)
+		if err != nil {
+			switch {
+			case errors.Is(err, refreshtoken.ErrRefreshTokenReused):
+				h.logger.WarnContext(r.Context(), "refresh token reuse detected, token family revoked",
+					slog.String("user_id", userID.String()),
+					slog.String("family_id", currentRefreshTokenRecord.FamilyID.String()))
+				h.reloadRevokedTokens(r.Context())
+				return helper.NewErrWithCode(http.StatusUnauthorized, CodeRefreshTokenReused, err)
+			case errors.Is(err, refreshtoken.ErrRefreshTokenRevoked):
+				return helper.NewErrWithCode(http.StatusUnauthorized, CodeRefreshTokenRevoked, err)
+			case errors.Is(err, refreshtoken.ErrRefreshTokenExpired), errors.Is(err, sql.ErrNoRows):
+				return helper.NewErrWithStatus(http.StatusUnauthorized, err)
+			}
 			return helper.NewErrWithStatus(http.StatusInternalServerError, err)
 		}
 		if err := helper.Encode(response.ApiResponse[TokenRefreshResponse]{
@@ -195,3 +215,127 @@ func (h *Handler) refreshHandler() http.HandlerFunc {
 		return nil
 	})
 }
+
+// logoutHandler - revoke the session of the presented refresh token, logging out twice succeeds
+func (h *Handler) logoutHandler() http.HandlerFunc {
+	return helper.Handler(func(w http.ResponseWriter, r *http.Request) error {
+		req, err := helper.Decode[LogoutRequest](r, h.validator)
+		if err != nil {
+			return helper.NewErrWithStatus(http.StatusBadRequest, err)
+		}
+		defer r.Body.Close()
+
+		refreshToken, err := h.jwtManager.Parse(req.RefreshToken)
+		if err != nil {
+			return helper.NewErrWithStatus(http.StatusUnauthorized, err)
+		}
+		userIDstr, err := refreshToken.Claims.GetSubject()
+		if err != nil {
+			return helper.NewErrWithStatus(http.StatusUnauthorized, err)
+		}
+		userID, err := uuid.Parse(userIDstr)
+		if err != nil {
+			return helper.NewErrWithStatus(http.StatusUnauthorized, err)
+		}
+		refreshTokenRecord, err := h.refreshTokenStore.ByPrimaryKey(r.Context(), userID, refreshToken)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, sql.ErrNoRows) {
+				status = http.StatusUnauthorized
+			}
+			return helper.NewErrWithStatus(status, err)
+		}
+		if err := h.refreshTokenStore.RevokeSession(r.Context(), userID, refreshTokenRecord.FamilyID); err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return helper.NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+		h.reloadRevokedTokens(r.Context())
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	})
+}
+
+// listSessionsHandler - active sessions of the authenticated user
+func (h *Handler) listSessionsHandler() http.HandlerFunc {
+	return helper.Handler(func(w http.ResponseWriter, r *http.Request) error {
+		user, ok := FromContext(r.Context())
+		if !ok {
+			return helper.NewErrWithStatus(
+				http.StatusUnauthorized,
+				fmt.Errorf("user not found in context"),
+			)
+		}
+		sessions, err := h.refreshTokenStore.Sessions(r.Context(), user.ID)
+		if err != nil {
+			return helper.NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+		resp := ListSessionsResponse{
+			Sessions: make([]ApiSession, 0, len(sessions)),
+		}
+		for i := range sessions {
+			resp.Sessions = append(resp.Sessions, NewApiSession(&sessions[i]))
+		}
+		if err := helper.Encode(response.ApiResponse[ListSessionsResponse]{
+			Data: &resp,
+		}, http.StatusOK, w); err != nil {
+			return helper.NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+		return nil
+	})
+}
+
+// revokeSessionHandler - sign out one device, its refresh token is rejected from now on
+func (h *Handler) revokeSessionHandler() http.HandlerFunc {
+	return helper.Handler(func(w http.ResponseWriter, r *http.Request) error {
+		id, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			return helper.NewErrWithStatus(http.StatusBadRequest, err)
+		}
+		user, ok := FromContext(r.Context())
+		if !ok {
+			return helper.NewErrWithStatus(
+				http.StatusUnauthorized,
+				fmt.Errorf("user not found in context"),
+			)
+		}
+		if err := h.refreshTokenStore.RevokeSession(r.Context(), user.ID, id); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return helper.NewErrWithStatus(http.StatusNotFound, fmt.Errorf("session not found"))
+			}
+			return helper.NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+		h.reloadRevokedTokens(r.Context())
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	})
+}
+
+// logoutAllHandler - invalidate every access and refresh token of the authenticated user, including
+// the one of this request
+func (h *Handler) logoutAllHandler() http.HandlerFunc {
+	return helper.Handler(func(w http.ResponseWriter, r *http.Request) error {
+		user, ok := FromContext(r.Context())
+		if !ok {
+			return helper.NewErrWithStatus(
+				http.StatusUnauthorized,
+				fmt.Errorf("user not found in context"),
+			)
+		}
+		// the auth middleware compares the version of every access token with the user
+		if _, err := h.userStore.IncrementTokenVersion(r.Context(), user.ID); err != nil {
+			return helper.NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+		if err := h.refreshTokenStore.RevokeSessions(r.Context(), user.ID); err != nil {
+			return helper.NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	})
+}
+
+// reloadRevokedTokens - enforce a revocation on this instance right away, other instances pick it
+// up on their next refresh
+func (h *Handler) reloadRevokedTokens(ctx context.Context) {
+	if err := h.revokedTokens.Load(ctx); err != nil {
+		h.logger.ErrorContext(ctx, "failed to reload revoked tokens", slog.Any("error", err))
+	}
+}
@@ -0,0 +1,67 @@
+package user
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	refreshtoken "github.com/leetcode-golang-classroom/golang-async-api/internal/refresh_token"
+)
+
+type ApiSession struct {
+	ID         uuid.UUID `json:"id"`
+	Label      *string   `json:"label,omitempty"`
+	UserAgent  *string   `json:"user_agent,omitempty"`
+	IPAddress  *string   `json:"ip_address,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+}
+
+func NewApiSession(session *refreshtoken.Session) ApiSession {
+	apiSession := ApiSession{
+		ID:         session.ID,
+		CreatedAt:  session.CreatedAt,
+		LastUsedAt: session.LastUsedAt,
+	}
+	if session.Label.Valid {
+		apiSession.Label = &session.Label.String
+	}
+	if session.UserAgent.Valid {
+		apiSession.UserAgent = &session.UserAgent.String
+	}
+	if session.IPAddress.Valid {
+		apiSession.IPAddress = &session.IPAddress.String
+	}
+	return apiSession
+}
+
+type ListSessionsResponse struct {
+	Sessions []ApiSession `json:"sessions"`
+}
+
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+func (r LogoutRequest) Validate(validator *validator.Validate) error {
+	err := validator.Struct(r)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// sessionInfo - device details of the sign in request
+func sessionInfo(r *http.Request, label string) refreshtoken.SessionInfo {
+	ipAddress, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ipAddress = r.RemoteAddr
+	}
+	return refreshtoken.SessionInfo{
+		Label:     label,
+		UserAgent: r.UserAgent(),
+		IPAddress: ipAddress,
+	}
+}
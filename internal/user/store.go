@@ -28,6 +28,8 @@ type User struct {
 	Email                string    `db:"email"`
 	HashedPasswordBase64 string    `db:"hashed_password"`
 	CreatedAt            time.Time `db:"created_at"`
+	// TokenVersion - tokens issued with an older version are rejected
+	TokenVersion int `db:"token_version"`
 }
 
 func (u *User) ComparePassword(password string) error {
@@ -73,3 +75,13 @@ func (s *UserStore) ByID(ctx context.Context, userID uuid.UUID) (*User, error) {
 	}
 	return &user, nil
 }
+
+// IncrementTokenVersion - invalidate every token issued to the user so far, returns the new version
+func (s *UserStore) IncrementTokenVersion(ctx context.Context, userID uuid.UUID) (int, error) {
+	const prepareStmt = `UPDATE users SET token_version = token_version + 1 WHERE id = $1 RETURNING token_version;`
+	var tokenVersion int
+	if err := s.db.GetContext(ctx, &tokenVersion, prepareStmt, userID); err != nil {
+		return 0, fmt.Errorf("failed to increment token version of user %s: %w", userID, err)
+	}
+	return tokenVersion, nil
+}
@@ -63,6 +63,14 @@ func TestUserStore(t *testing.T) {
 	assert.Equal(t, user1.ID, user2.ID)
 	assert.Equal(t, user1.HashedPasswordBase64, user2.HashedPasswordBase64)
 	assert.Equal(t, user1.CreatedAt.UnixNano(), user2.CreatedAt.UnixNano())
+
+	assert.Equal(t, 0, user1.TokenVersion)
+	tokenVersion, err := userStore.IncrementTokenVersion(ctx, user1.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, tokenVersion)
+	user2, err = userStore.ByID(ctx, user1.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, user2.TokenVersion)
 	if err := m.Down(); err != nil {
 		require.NoError(t, err)
 	}
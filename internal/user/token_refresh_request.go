@@ -2,6 +2,14 @@ package user
 
 import "github.com/go-playground/validator/v10"
 
+// Error codes of POST /auth/refresh
+const (
+	// CodeRefreshTokenReused - an already rotated refresh token was replayed, every token of its family is revoked
+	CodeRefreshTokenReused = "refresh_token_reused"
+	// CodeRefreshTokenRevoked - the family of the refresh token was revoked after a reuse
+	CodeRefreshTokenRevoked = "refresh_token_revoked"
+)
+
 type TokenRefreshRequest struct {
 	RefreshToken string `json:"refresh_token" validate:"required"`
 }
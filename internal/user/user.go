@@ -20,6 +20,8 @@ func (r SignUpRequest) Validate(validator *validator.Validate) error {
 type SignInRequest struct {
 	Email    string `json:"email" validate:"required"`
 	Password string `json:"password" validate:"required"`
+	// Label - name of the device shown in GET /auth/sessions
+	Label string `json:"label" validate:"omitempty,max=100"`
 }
 
 func (r SignInRequest) Validate(validator *validator.Validate) error {
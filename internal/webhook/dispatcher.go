@@ -0,0 +1,159 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const (
+	// DefaultPollInterval - how often the dispatcher looks for due deliveries
+	DefaultPollInterval = 2 * time.Second
+	// DefaultBatchSize - deliveries attempted per transaction
+	DefaultBatchSize = 10
+	// DefaultRequestTimeout - how long an endpoint may take to answer
+	DefaultRequestTimeout = 10 * time.Second
+	// maxResponseBody - bytes read from the endpoint response before the connection is reused
+	maxResponseBody = 4 << 10
+)
+
+// ErrPrivateAddress - endpoint resolved to an address inside the worker network
+var ErrPrivateAddress = errors.New("webhook endpoint resolves to a private address")
+
+// Dispatcher - post due deliveries to their endpoints
+type Dispatcher struct {
+	webhookStore *WebhookStore
+	client       *http.Client
+	logger       *slog.Logger
+	interval     time.Duration
+	batchSize    int
+	maxAttempts  int
+}
+
+func NewDispatcher(
+	webhookStore *WebhookStore,
+	logger *slog.Logger,
+) *Dispatcher {
+	return &Dispatcher{
+		webhookStore: webhookStore,
+		client:       NewClient(),
+		logger:       logger,
+		interval:     DefaultPollInterval,
+		batchSize:    DefaultBatchSize,
+		maxAttempts:  DefaultMaxAttempts,
+	}
+}
+
+// NewClient - http client for deliveries, redirects are not followed so a delivery always reaches
+// the registered url. Loopback, private, link-local and unspecified addresses are rejected when
+// dialing, after the host is resolved, so a hostname could not point a delivery into the worker network
+func NewClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   DefaultRequestTimeout,
+		KeepAlive: 30 * time.Second,
+		Control:   controlPublicAddress,
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// a proxy would be dialed instead of the endpoint and bypass the address check
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   DefaultRequestTimeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// WithClient - post deliveries with client instead of NewClient
+func (d *Dispatcher) WithClient(client *http.Client) *Dispatcher {
+	d.client = client
+	return d
+}
+
+// controlPublicAddress - net.Dialer.Control rejecting addresses that are not publicly routable
+func controlPublicAddress(network string, address string, conn syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("invalid address %s: %w", address, err)
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return fmt.Errorf("invalid address %s: %w", address, err)
+	}
+	ip = ip.Unmap()
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() {
+		return fmt.Errorf("%w: %s", ErrPrivateAddress, ip)
+	}
+	return nil
+}
+
+// Start - dispatch due deliveries every interval until ctx is done
+func (d *Dispatcher) Start(ctx context.Context) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := d.Dispatch(ctx); err != nil && ctx.Err() == nil {
+				d.logger.ErrorContext(ctx, "failed to dispatch webhook deliveries", slog.Any("error", err))
+			}
+		}
+	}
+}
+
+// Dispatch - attempt batches until no due delivery is left
+func (d *Dispatcher) Dispatch(ctx context.Context) error {
+	for {
+		handled, err := d.webhookStore.DeliverDue(ctx, d.batchSize, d.maxAttempts, d.Send)
+		if err != nil {
+			return err
+		}
+		if handled < d.batchSize {
+			return nil
+		}
+	}
+}
+
+// Send - post the signed payload of delivery, any status other than 2xx is a failed attempt
+func (d *Dispatcher) Send(ctx context.Context, delivery *Delivery) DeliveryResult {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return DeliveryResult{Err: fmt.Errorf("failed to create request: %w", err)}
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "golang-async-api-webhook")
+	req.Header.Set(HeaderID, delivery.ID.String())
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(delivery.Secret, timestamp, delivery.Payload))
+	resp, err := d.client.Do(req)
+	if err != nil {
+		d.logger.WarnContext(ctx, "failed to post webhook", slog.String("delivery_id", delivery.ID.String()), slog.Any("error", err))
+		return DeliveryResult{Err: fmt.Errorf("failed to post webhook: %w", err)}
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseBody))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		d.logger.WarnContext(ctx, "webhook endpoint rejected delivery", slog.String("delivery_id", delivery.ID.String()),
+			slog.Int("status", resp.StatusCode))
+		return DeliveryResult{
+			ResponseStatus: resp.StatusCode,
+			Err:            fmt.Errorf("endpoint responded with status %d", resp.StatusCode),
+		}
+	}
+	return DeliveryResult{ResponseStatus: resp.StatusCode}
+}
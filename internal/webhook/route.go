@@ -0,0 +1,285 @@
+package webhook
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/helper"
+	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/response"
+	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/util"
+)
+
+// Handler - webhook endpoints and delivery log of the authenticated user
+type Handler struct {
+	logger       *slog.Logger
+	validator    *validator.Validate
+	webhookStore *WebhookStore
+}
+
+func NewHandler(logger *slog.Logger,
+	validator *validator.Validate,
+	webhookStore *WebhookStore,
+) *Handler {
+	return &Handler{
+		logger:       logger,
+		validator:    validator,
+		webhookStore: webhookStore,
+	}
+}
+
+func (h *Handler) RegisterRoute(router *http.ServeMux) {
+	router.HandleFunc("POST /webhooks", h.createWebhookHandler())
+	router.HandleFunc("GET /webhooks", h.listWebhooksHandler())
+	router.HandleFunc("DELETE /webhooks/{id}", h.deleteWebhookHandler())
+	router.HandleFunc("GET /webhook-deliveries", h.listDeliveriesHandler())
+	router.HandleFunc("GET /webhook-deliveries/{id}", h.getDeliveryHandler())
+	router.HandleFunc("POST /webhook-deliveries/{id}/replay", h.replayDeliveryHandler())
+}
+
+// createWebhookHandler - register an endpoint, the secret is generated when not given and only returned here
+func (h *Handler) createWebhookHandler() http.HandlerFunc {
+	return helper.Handler(func(w http.ResponseWriter, r *http.Request) error {
+		req, err := helper.Decode[CreateWebhookRequest](r, h.validator)
+		if err != nil {
+			return helper.NewErrWithStatus(
+				http.StatusBadRequest,
+				err,
+			)
+		}
+		defer r.Body.Close()
+		user, ok := util.UserFromContext(r.Context())
+		if !ok {
+			return helper.NewErrWithStatus(
+				http.StatusUnauthorized,
+				fmt.Errorf("user not found in context"),
+			)
+		}
+		secret := req.Secret
+		if secret == "" {
+			if secret, err = GenerateSecret(); err != nil {
+				return helper.NewErrWithStatus(
+					http.StatusInternalServerError,
+					err,
+				)
+			}
+		}
+		webhook, err := h.webhookStore.Create(r.Context(), user.ID, req.URL, secret)
+		if err != nil {
+			return helper.NewErrWithStatus(
+				http.StatusInternalServerError,
+				err,
+			)
+		}
+		apiWebhook := NewApiWebhook(webhook)
+		apiWebhook.Secret = webhook.Secret
+		if err := helper.Encode(response.ApiResponse[ApiWebhook]{
+			Data: &apiWebhook,
+		},
+			http.StatusCreated,
+			w,
+		); err != nil {
+			return helper.NewErrWithStatus(
+				http.StatusInternalServerError,
+				err,
+			)
+		}
+		return nil
+	})
+}
+
+func (h *Handler) listWebhooksHandler() http.HandlerFunc {
+	return helper.Handler(func(w http.ResponseWriter, r *http.Request) error {
+		user, ok := util.UserFromContext(r.Context())
+		if !ok {
+			return helper.NewErrWithStatus(
+				http.StatusUnauthorized,
+				fmt.Errorf("user not found in context"),
+			)
+		}
+		webhooks, err := h.webhookStore.List(r.Context(), user.ID)
+		if err != nil {
+			return helper.NewErrWithStatus(
+				http.StatusInternalServerError,
+				err,
+			)
+		}
+		resp := ListWebhooksResponse{
+			Webhooks: make([]ApiWebhook, 0, len(webhooks)),
+		}
+		for i := range webhooks {
+			resp.Webhooks = append(resp.Webhooks, NewApiWebhook(&webhooks[i]))
+		}
+		if err := helper.Encode(response.ApiResponse[ListWebhooksResponse]{
+			Data: &resp,
+		},
+			http.StatusOK,
+			w,
+		); err != nil {
+			return helper.NewErrWithStatus(
+				http.StatusInternalServerError,
+				err,
+			)
+		}
+		return nil
+	})
+}
+
+func (h *Handler) deleteWebhookHandler() http.HandlerFunc {
+	return helper.Handler(func(w http.ResponseWriter, r *http.Request) error {
+		id, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			return helper.NewErrWithStatus(
+				http.StatusBadRequest,
+				err,
+			)
+		}
+		user, ok := util.UserFromContext(r.Context())
+		if !ok {
+			return helper.NewErrWithStatus(
+				http.StatusUnauthorized,
+				fmt.Errorf("user not found in context"),
+			)
+		}
+		if err := h.webhookStore.Delete(r.Context(), user.ID, id); err != nil {
+			return notFoundOrInternal(err, "webhook not found")
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	})
+}
+
+// listDeliveriesHandler - delivery log of the user filtered by report_id and status
+func (h *Handler) listDeliveriesHandler() http.HandlerFunc {
+	return helper.Handler(func(w http.ResponseWriter, r *http.Request) error {
+		filter, err := ParseListDeliveriesQuery(r.URL.Query())
+		if err != nil {
+			return helper.NewErrWithStatus(
+				http.StatusBadRequest,
+				err,
+			)
+		}
+		user, ok := util.UserFromContext(r.Context())
+		if !ok {
+			return helper.NewErrWithStatus(
+				http.StatusUnauthorized,
+				fmt.Errorf("user not found in context"),
+			)
+		}
+		deliveries, err := h.webhookStore.Deliveries(r.Context(), user.ID, filter)
+		if err != nil {
+			return helper.NewErrWithStatus(
+				http.StatusInternalServerError,
+				err,
+			)
+		}
+		resp := ListDeliveriesResponse{
+			Deliveries: make([]ApiDelivery, 0, len(deliveries)),
+		}
+		for i := range deliveries {
+			resp.Deliveries = append(resp.Deliveries, NewApiDelivery(&deliveries[i]))
+		}
+		if err := helper.Encode(response.ApiResponse[ListDeliveriesResponse]{
+			Data: &resp,
+		},
+			http.StatusOK,
+			w,
+		); err != nil {
+			return helper.NewErrWithStatus(
+				http.StatusInternalServerError,
+				err,
+			)
+		}
+		return nil
+	})
+}
+
+func (h *Handler) getDeliveryHandler() http.HandlerFunc {
+	return helper.Handler(func(w http.ResponseWriter, r *http.Request) error {
+		id, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			return helper.NewErrWithStatus(
+				http.StatusBadRequest,
+				err,
+			)
+		}
+		user, ok := util.UserFromContext(r.Context())
+		if !ok {
+			return helper.NewErrWithStatus(
+				http.StatusUnauthorized,
+				fmt.Errorf("user not found in context"),
+			)
+		}
+		delivery, err := h.webhookStore.DeliveryByID(r.Context(), user.ID, id)
+		if err != nil {
+			return notFoundOrInternal(err, "webhook delivery not found")
+		}
+		apiDelivery := NewApiDelivery(delivery)
+		if err := helper.Encode(response.ApiResponse[ApiDelivery]{
+			Data: &apiDelivery,
+		},
+			http.StatusOK,
+			w,
+		); err != nil {
+			return helper.NewErrWithStatus(
+				http.StatusInternalServerError,
+				err,
+			)
+		}
+		return nil
+	})
+}
+
+// replayDeliveryHandler - send the payload of a delivery again as a new delivery
+func (h *Handler) replayDeliveryHandler() http.HandlerFunc {
+	return helper.Handler(func(w http.ResponseWriter, r *http.Request) error {
+		id, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			return helper.NewErrWithStatus(
+				http.StatusBadRequest,
+				err,
+			)
+		}
+		user, ok := util.UserFromContext(r.Context())
+		if !ok {
+			return helper.NewErrWithStatus(
+				http.StatusUnauthorized,
+				fmt.Errorf("user not found in context"),
+			)
+		}
+		delivery, err := h.webhookStore.Replay(r.Context(), user.ID, id)
+		if err != nil {
+			return notFoundOrInternal(err, "webhook delivery not found")
+		}
+		apiDelivery := NewApiDelivery(delivery)
+		if err := helper.Encode(response.ApiResponse[ApiDelivery]{
+			Data: &apiDelivery,
+		},
+			http.StatusAccepted,
+			w,
+		); err != nil {
+			return helper.NewErrWithStatus(
+				http.StatusInternalServerError,
+				err,
+			)
+		}
+		return nil
+	})
+}
+
+func notFoundOrInternal(err error, notFound string) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return helper.NewErrWithStatus(
+			http.StatusNotFound,
+			errors.New(notFound),
+		)
+	}
+	return helper.NewErrWithStatus(
+		http.StatusInternalServerError,
+		err,
+	)
+}
@@ -0,0 +1,256 @@
+package webhook
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+)
+
+type WebhookStore struct {
+	db *sqlx.DB
+}
+
+func NewWebhookStore(db *sql.DB) *WebhookStore {
+	return &WebhookStore{
+		db: sqlx.NewDb(db, "postgres"),
+	}
+}
+
+// Webhook - endpoint of an account, receives the events of every report of the user
+type Webhook struct {
+	ID        uuid.UUID `db:"id"`
+	UserID    uuid.UUID `db:"user_id"`
+	URL       string    `db:"url"`
+	Secret    string    `db:"secret"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+// Delivery - one event posted to one endpoint, the url and secret are copied so a delivery
+// could still be replayed after the endpoint is removed
+type Delivery struct {
+	ID             uuid.UUID      `db:"id"`
+	UserID         uuid.UUID      `db:"user_id"`
+	WebhookID      uuid.NullUUID  `db:"webhook_id"`
+	ReportID       uuid.NullUUID  `db:"report_id"`
+	Event          string         `db:"event"`
+	URL            string         `db:"url"`
+	Secret         string         `db:"secret"`
+	Payload        []byte         `db:"payload"`
+	Status         string         `db:"status"`
+	Attempts       int            `db:"attempts"`
+	ResponseStatus sql.NullInt32  `db:"response_status"`
+	LastError      sql.NullString `db:"last_error"`
+	ReplayOf       uuid.NullUUID  `db:"replay_of"`
+	CreatedAt      time.Time      `db:"created_at"`
+	NextAttemptAt  time.Time      `db:"next_attempt_at"`
+	DeliveredAt    sql.NullTime   `db:"delivered_at"`
+}
+
+// DeliveryFilter - ReportID and Status are optional
+type DeliveryFilter struct {
+	ReportID *uuid.UUID
+	Status   string
+	Limit    int
+}
+
+// DeliveryResult - outcome of one attempt, ResponseStatus is 0 when no response was received
+type DeliveryResult struct {
+	ResponseStatus int
+	Err            error
+}
+
+// maxErrorMessageLength - size of webhook_deliveries.last_error column
+const maxErrorMessageLength = 300
+
+func (s *WebhookStore) Create(ctx context.Context, userID uuid.UUID, url string, secret string) (*Webhook, error) {
+	const prepareStmt = `INSERT INTO webhooks(user_id, url, secret) VALUES ($1, $2, $3) RETURNING *;`
+	var webhook Webhook
+	if err := s.db.GetContext(ctx, &webhook, prepareStmt, userID, url, secret); err != nil {
+		return nil, fmt.Errorf("failed to insert webhook for user %s: %w", userID, err)
+	}
+	return &webhook, nil
+}
+
+// List - endpoints of userID, oldest first
+func (s *WebhookStore) List(ctx context.Context, userID uuid.UUID) ([]Webhook, error) {
+	const prepareStmt = `SELECT * FROM webhooks WHERE user_id = $1 ORDER BY created_at, id;`
+	var webhooks []Webhook
+	if err := s.db.SelectContext(ctx, &webhooks, prepareStmt, userID); err != nil {
+		return nil, fmt.Errorf("failed to query webhooks for user %s: %w", userID, err)
+	}
+	return webhooks, nil
+}
+
+// Delete - remove the endpoint, its deliveries are kept, sql.ErrNoRows when it does not exist
+func (s *WebhookStore) Delete(ctx context.Context, userID uuid.UUID, id uuid.UUID) error {
+	const prepareStmt = `DELETE FROM webhooks WHERE user_id = $1 AND id = $2;`
+	result, err := s.db.ExecContext(ctx, prepareStmt, userID, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook %s for user %s: %w", id, userID, err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook %s for user %s: %w", id, userID, err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("failed to delete webhook %s for user %s: %w", id, userID, sql.ErrNoRows)
+	}
+	return nil
+}
+
+// Enqueue - queue event for every endpoint of the user and for endpoint of the report when it is set
+func (s *WebhookStore) Enqueue(ctx context.Context, event Event, endpoint *Endpoint) ([]Delivery, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal %s event: %w", event.Type, err)
+	}
+	const accountStmt = `
+INSERT INTO webhook_deliveries(user_id, webhook_id, report_id, event, url, secret, payload)
+SELECT user_id, id, $2, $3, url, secret, $4 FROM webhooks WHERE user_id = $1
+RETURNING *;
+	`
+	var deliveries []Delivery
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	if err := tx.SelectContext(ctx, &deliveries, accountStmt, event.UserID, event.ReportID, event.Type, payload); err != nil {
+		return nil, fmt.Errorf("failed to enqueue %s deliveries for report %s: %w", event.Type, event.ReportID, err)
+	}
+	if endpoint != nil {
+		const reportStmt = `
+INSERT INTO webhook_deliveries(user_id, report_id, event, url, secret, payload)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING *;
+	`
+		var delivery Delivery
+		if err := tx.GetContext(ctx, &delivery, reportStmt, event.UserID, event.ReportID, event.Type,
+			endpoint.URL, endpoint.Secret, payload); err != nil {
+			return nil, fmt.Errorf("failed to enqueue %s delivery for report %s: %w", event.Type, event.ReportID, err)
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return deliveries, nil
+}
+
+// Deliveries - delivery log of userID, newest first
+func (s *WebhookStore) Deliveries(ctx context.Context, userID uuid.UUID, filter DeliveryFilter) ([]Delivery, error) {
+	const prepareStmt = `
+SELECT * FROM webhook_deliveries
+WHERE user_id = $1
+  AND ($2::uuid IS NULL OR report_id = $2)
+  AND ($3 = '' OR status = $3)
+ORDER BY created_at DESC, id DESC
+LIMIT $4;
+	`
+	var reportID uuid.NullUUID
+	if filter.ReportID != nil {
+		reportID = uuid.NullUUID{UUID: *filter.ReportID, Valid: true}
+	}
+	var deliveries []Delivery
+	if err := s.db.SelectContext(ctx, &deliveries, prepareStmt, userID, reportID, filter.Status, filter.Limit); err != nil {
+		return nil, fmt.Errorf("failed to query webhook deliveries for user %s: %w", userID, err)
+	}
+	return deliveries, nil
+}
+
+func (s *WebhookStore) DeliveryByID(ctx context.Context, userID uuid.UUID, id uuid.UUID) (*Delivery, error) {
+	const prepareStmt = `SELECT * FROM webhook_deliveries WHERE user_id = $1 AND id = $2;`
+	var delivery Delivery
+	if err := s.db.GetContext(ctx, &delivery, prepareStmt, userID, id); err != nil {
+		return nil, fmt.Errorf("failed to get webhook delivery %s for user %s: %w", id, userID, err)
+	}
+	return &delivery, nil
+}
+
+// Replay - queue a new delivery with the payload and endpoint of delivery id, sql.ErrNoRows when it does not exist
+func (s *WebhookStore) Replay(ctx context.Context, userID uuid.UUID, id uuid.UUID) (*Delivery, error) {
+	const prepareStmt = `
+INSERT INTO webhook_deliveries(user_id, webhook_id, report_id, event, url, secret, payload, replay_of)
+SELECT user_id, webhook_id, report_id, event, url, secret, payload, id
+FROM webhook_deliveries WHERE user_id = $1 AND id = $2
+RETURNING *;
+	`
+	var delivery Delivery
+	if err := s.db.GetContext(ctx, &delivery, prepareStmt, userID, id); err != nil {
+		return nil, fmt.Errorf("failed to replay webhook delivery %s for user %s: %w", id, userID, err)
+	}
+	return &delivery, nil
+}
+
+// DeliverDue - attempt up to limit pending deliveries that are due, a failed attempt is retried after Backoff
+// until maxAttempts. Deliveries are claimed in a short transaction that hides them from other dispatchers for
+// claimLease, SKIP LOCKED lets several dispatchers run side by side. Endpoints are called outside any transaction
+// and each result is recorded on its own, returns the number of attempted deliveries
+func (s *WebhookStore) DeliverDue(ctx context.Context, limit int, maxAttempts int,
+	deliver func(ctx context.Context, delivery *Delivery) DeliveryResult) (int, error) {
+	const claimStmt = `
+UPDATE webhook_deliveries SET next_attempt_at = $3
+WHERE id IN (
+  SELECT id FROM webhook_deliveries
+  WHERE status = 'pending' AND next_attempt_at <= $1
+  ORDER BY next_attempt_at, id
+  LIMIT $2
+  FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+	`
+	now := time.Now().UTC()
+	var deliveries []Delivery
+	if err := s.db.SelectContext(ctx, &deliveries, claimStmt, now, limit, now.Add(claimLease)); err != nil {
+		return 0, fmt.Errorf("failed to claim pending webhook deliveries: %w", err)
+	}
+	for i := range deliveries {
+		delivery := &deliveries[i]
+		if err := s.recordAttempt(ctx, delivery, deliver(ctx, delivery), maxAttempts); err != nil {
+			return i, err
+		}
+	}
+	return len(deliveries), nil
+}
+
+// recordAttempt - store the outcome of one attempt of delivery
+func (s *WebhookStore) recordAttempt(ctx context.Context, delivery *Delivery, result DeliveryResult, maxAttempts int) error {
+	now := time.Now().UTC()
+	attempts := delivery.Attempts + 1
+	status := StatusSucceeded
+	var lastError sql.NullString
+	var deliveredAt sql.NullTime
+	if result.Err != nil {
+		status = StatusPending
+		if attempts >= maxAttempts {
+			status = StatusFailed
+		}
+		errMsg := result.Err.Error()
+		if len(errMsg) > maxErrorMessageLength {
+			errMsg = errMsg[:maxErrorMessageLength]
+		}
+		lastError = sql.NullString{String: errMsg, Valid: true}
+	} else {
+		deliveredAt = sql.NullTime{Time: now, Valid: true}
+	}
+	var responseStatus sql.NullInt32
+	if result.ResponseStatus != 0 {
+		responseStatus = sql.NullInt32{Int32: int32(result.ResponseStatus), Valid: true}
+	}
+	const prepareStmt = `
+UPDATE webhook_deliveries
+SET status = $2, attempts = $3, response_status = $4, last_error = $5, next_attempt_at = $6, delivered_at = $7
+WHERE id = $1;
+	`
+	if _, err := s.db.ExecContext(ctx, prepareStmt, delivery.ID, status, attempts, responseStatus, lastError,
+		now.Add(Backoff(attempts)), deliveredAt); err != nil {
+		return fmt.Errorf("failed to update webhook delivery %s: %w", delivery.ID, err)
+	}
+	return nil
+}
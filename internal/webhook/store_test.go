@@ -0,0 +1,138 @@
+package webhook_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/google/uuid"
+	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/config"
+	"github.com/leetcode-golang-classroom/golang-async-api/internal/pkg/db"
+	"github.com/leetcode-golang-classroom/golang-async-api/internal/user"
+	"github.com/leetcode-golang-classroom/golang-async-api/internal/webhook"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func SetupDB(t *testing.T) (*sql.DB, *migrate.Migrate) {
+	t.Helper()
+	appConfig := config.AppConfig
+	appConfig.SetupEnv(config.Env_Dev)
+	dbURL := appConfig.DBURLTEST
+	db, err := db.Connect(dbURL)
+	require.NoError(t, err)
+
+	result := strings.Replace(appConfig.PROJECT_ROOT, "/internal/webhook", "", 1)
+	m, err := migrate.New(
+		fmt.Sprintf("file://%s/migrations", result),
+		dbURL,
+	)
+	require.NoError(t, err)
+	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
+		require.NoError(t, err)
+	}
+	return db, m
+}
+
+func TestWebhookStore(t *testing.T) {
+	db, m := SetupDB(t)
+	defer db.Close()
+	ctx := context.Background()
+	webhookStore := webhook.NewWebhookStore(db)
+	user1, err := user.NewUserStore(db).CreateUser(ctx, "webhook@test.com", "secretpassword")
+	require.NoError(t, err)
+
+	endpoint, err := webhookStore.Create(ctx, user1.ID, "https://example.com/account", "account-secret-16")
+	require.NoError(t, err)
+	webhooks, err := webhookStore.List(ctx, user1.ID)
+	require.NoError(t, err)
+	require.Len(t, webhooks, 1)
+	assert.Equal(t, endpoint.ID, webhooks[0].ID)
+
+	reportID := uuid.New()
+	deliveries, err := webhookStore.Enqueue(ctx, webhook.Event{
+		Type:      webhook.EventReportCompleted,
+		UserID:    user1.ID,
+		ReportID:  reportID,
+		CreatedAt: time.Now().UTC(),
+		Data:      map[string]string{"status": "completed"},
+	}, &webhook.Endpoint{URL: "https://example.com/report", Secret: "report-secret-16"})
+	require.NoError(t, err)
+	require.Len(t, deliveries, 2)
+	for _, delivery := range deliveries {
+		assert.Equal(t, webhook.StatusPending, delivery.Status)
+		assert.Equal(t, reportID, delivery.ReportID.UUID)
+	}
+
+	// the account endpoint fails, the report endpoint succeeds
+	sent := map[string]int{}
+	deliver := func(ctx context.Context, delivery *webhook.Delivery) webhook.DeliveryResult {
+		sent[delivery.URL]++
+		// claimed deliveries are hidden from other dispatchers while they are posted
+		concurrent, err := webhookStore.DeliverDue(ctx, 10, 2, func(ctx context.Context, delivery *webhook.Delivery) webhook.DeliveryResult {
+			return webhook.DeliveryResult{ResponseStatus: 200}
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 0, concurrent)
+		if delivery.URL == endpoint.URL {
+			return webhook.DeliveryResult{ResponseStatus: 500, Err: errors.New("endpoint responded with status 500")}
+		}
+		return webhook.DeliveryResult{ResponseStatus: 200}
+	}
+	handled, err := webhookStore.DeliverDue(ctx, 10, 2, deliver)
+	require.NoError(t, err)
+	assert.Equal(t, 2, handled)
+	// the failed delivery is not due before its backoff
+	handled, err = webhookStore.DeliverDue(ctx, 10, 2, deliver)
+	require.NoError(t, err)
+	assert.Equal(t, 0, handled)
+
+	pending, err := webhookStore.Deliveries(ctx, user1.ID, webhook.DeliveryFilter{
+		ReportID: &reportID,
+		Status:   webhook.StatusPending,
+		Limit:    10,
+	})
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, endpoint.URL, pending[0].URL)
+	assert.Equal(t, 1, pending[0].Attempts)
+	assert.Equal(t, int32(500), pending[0].ResponseStatus.Int32)
+	assert.True(t, pending[0].NextAttemptAt.After(time.Now().UTC()))
+
+	// the last attempt fails the delivery
+	_, err = db.ExecContext(ctx, `UPDATE webhook_deliveries SET next_attempt_at = $2 WHERE id = $1;`,
+		pending[0].ID, time.Now().UTC().Add(-time.Second))
+	require.NoError(t, err)
+	handled, err = webhookStore.DeliverDue(ctx, 10, 2, deliver)
+	require.NoError(t, err)
+	assert.Equal(t, 1, handled)
+	failed, err := webhookStore.DeliveryByID(ctx, user1.ID, pending[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, webhook.StatusFailed, failed.Status)
+	assert.Equal(t, 2, failed.Attempts)
+
+	replay, err := webhookStore.Replay(ctx, user1.ID, failed.ID)
+	require.NoError(t, err)
+	assert.Equal(t, webhook.StatusPending, replay.Status)
+	assert.Equal(t, failed.ID, replay.ReplayOf.UUID)
+	assert.JSONEq(t, string(failed.Payload), string(replay.Payload))
+	_, err = webhookStore.Replay(ctx, uuid.New(), failed.ID)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	// deliveries are kept when the endpoint is removed
+	require.NoError(t, webhookStore.Delete(ctx, user1.ID, endpoint.ID))
+	assert.ErrorIs(t, webhookStore.Delete(ctx, user1.ID, endpoint.ID), sql.ErrNoRows)
+	all, err := webhookStore.Deliveries(ctx, user1.ID, webhook.DeliveryFilter{Limit: 10})
+	require.NoError(t, err)
+	assert.Len(t, all, 3)
+	assert.Equal(t, 3, sent[endpoint.URL]+sent["https://example.com/report"])
+
+	m.Down()
+}
@@ -0,0 +1,239 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+)
+
+// Events sent to the webhook endpoints
+const (
+	EventReportCompleted = "report.completed"
+	EventReportFailed    = "report.failed"
+)
+
+// Status of a delivery
+const (
+	StatusPending   = "pending"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+// Headers of a delivery request, the signature is "sha256=" followed by the hex HMAC-SHA256
+// of the timestamp header, a dot and the body, computed with the secret of the endpoint
+const (
+	HeaderID        = "X-Webhook-Id"
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+	signaturePrefix = "sha256="
+)
+
+const (
+	DefaultListLimit = 50
+	MaxListLimit     = 100
+	// DefaultMaxAttempts - attempts after which a delivery is failed
+	DefaultMaxAttempts = 8
+	// DefaultMaxBackoff - upper bound of the delay between two attempts
+	DefaultMaxBackoff = time.Hour
+	baseBackoff       = 30 * time.Second
+	// claimLease - how long claimed deliveries are hidden from other dispatchers, covers a batch of request timeouts
+	claimLease = 5 * time.Minute
+)
+
+// ErrInvalidSignature - delivery was not signed with the secret or was modified
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// Backoff - delay before the next attempt after attempts failed deliveries, doubled per attempt
+func Backoff(attempts int) time.Duration {
+	backoff := baseBackoff
+	for i := 1; i < attempts && backoff < DefaultMaxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, DefaultMaxBackoff)
+}
+
+// Sign - signature header value of body sent at timestamp
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify - check the timestamp and signature headers of a delivery, receivers should also
+// reject timestamps that are too old to prevent replays
+func Verify(secret string, timestamp string, signature string, body []byte) error {
+	parsed, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if !hmac.Equal([]byte(Sign(secret, parsed, body)), []byte(signature)) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// GenerateSecret - random secret for an endpoint registered without one
+func GenerateSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	return hex.EncodeToString(secret), nil
+}
+
+// ValidateURL - endpoints have to be absolute http or https urls, hosts resolving to private addresses
+// are rejected by NewClient when a delivery is sent
+func ValidateURL(rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid webhook url: %w", err)
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("webhook url must be an absolute http or https url")
+	}
+	return nil
+}
+
+// Event - payload posted to the endpoints, Data is the report body
+type Event struct {
+	Type      string    `json:"event"`
+	UserID    uuid.UUID `json:"-"`
+	ReportID  uuid.UUID `json:"report_id"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+}
+
+// Endpoint - where a delivery is posted and the secret it is signed with
+type Endpoint struct {
+	URL    string
+	Secret string
+}
+
+type CreateWebhookRequest struct {
+	URL    string `json:"url" validate:"required,http_url,max=2048"`
+	Secret string `json:"secret" validate:"omitempty,min=16,max=255"`
+}
+
+func (r CreateWebhookRequest) Validate(validator *validator.Validate) error {
+	if err := validator.Struct(r); err != nil {
+		return err
+	}
+	return ValidateURL(r.URL)
+}
+
+type ApiWebhook struct {
+	ID  uuid.UUID `json:"id"`
+	URL string    `json:"url"`
+	// Secret - only returned when the endpoint is registered
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func NewApiWebhook(webhook *Webhook) ApiWebhook {
+	return ApiWebhook{
+		ID:        webhook.ID,
+		URL:       webhook.URL,
+		CreatedAt: webhook.CreatedAt,
+	}
+}
+
+type ListWebhooksResponse struct {
+	Webhooks []ApiWebhook `json:"webhooks"`
+}
+
+type ApiDelivery struct {
+	ID             uuid.UUID       `json:"id"`
+	WebhookID      *uuid.UUID      `json:"webhook_id,omitempty"`
+	ReportID       *uuid.UUID      `json:"report_id,omitempty"`
+	Event          string          `json:"event"`
+	URL            string          `json:"url"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	ResponseStatus *int            `json:"response_status,omitempty"`
+	LastError      *string         `json:"last_error,omitempty"`
+	ReplayOf       *uuid.UUID      `json:"replay_of,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+}
+
+func NewApiDelivery(delivery *Delivery) ApiDelivery {
+	apiDelivery := ApiDelivery{
+		ID:        delivery.ID,
+		Event:     delivery.Event,
+		URL:       delivery.URL,
+		Payload:   json.RawMessage(delivery.Payload),
+		Status:    delivery.Status,
+		Attempts:  delivery.Attempts,
+		CreatedAt: delivery.CreatedAt,
+	}
+	if delivery.WebhookID.Valid {
+		apiDelivery.WebhookID = &delivery.WebhookID.UUID
+	}
+	if delivery.ReportID.Valid {
+		apiDelivery.ReportID = &delivery.ReportID.UUID
+	}
+	if delivery.ResponseStatus.Valid {
+		responseStatus := int(delivery.ResponseStatus.Int32)
+		apiDelivery.ResponseStatus = &responseStatus
+	}
+	if delivery.LastError.Valid {
+		apiDelivery.LastError = &delivery.LastError.String
+	}
+	if delivery.ReplayOf.Valid {
+		apiDelivery.ReplayOf = &delivery.ReplayOf.UUID
+	}
+	if delivery.Status == StatusPending {
+		apiDelivery.NextAttemptAt = &delivery.NextAttemptAt
+	}
+	if delivery.DeliveredAt.Valid {
+		apiDelivery.DeliveredAt = &delivery.DeliveredAt.Time
+	}
+	return apiDelivery
+}
+
+type ListDeliveriesResponse struct {
+	Deliveries []ApiDelivery `json:"deliveries"`
+}
+
+// ParseListDeliveriesQuery - parse report_id, status and limit
+func ParseListDeliveriesQuery(query url.Values) (DeliveryFilter, error) {
+	filter := DeliveryFilter{
+		Status: query.Get("status"),
+		Limit:  DefaultListLimit,
+	}
+	switch filter.Status {
+	case "", StatusPending, StatusSucceeded, StatusFailed:
+	default:
+		return filter, fmt.Errorf("status must be one of %s", strings.Join([]string{StatusPending, StatusSucceeded, StatusFailed}, ", "))
+	}
+	if reportID := query.Get("report_id"); reportID != "" {
+		parsed, err := uuid.Parse(reportID)
+		if err != nil {
+			return filter, fmt.Errorf("report_id must be an uuid: %w", err)
+		}
+		filter.ReportID = &parsed
+	}
+	if limit := query.Get("limit"); limit != "" {
+		parsed, err := strconv.Atoi(limit)
+		if err != nil || parsed < 1 || parsed > MaxListLimit {
+			return filter, fmt.Errorf("limit must be between 1 and %d", MaxListLimit)
+		}
+		filter.Limit = parsed
+	}
+	return filter, nil
+}
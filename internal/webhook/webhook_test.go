@@ -0,0 +1,143 @@
+package webhook_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/leetcode-golang-classroom/golang-async-api/internal/webhook"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSign(t *testing.T) {
+	body := []byte(`{"event":"report.completed"}`)
+	signature := webhook.Sign("secret-of-sixteen", 1700000000, body)
+	assert.Regexp(t, "^sha256=[0-9a-f]{64}$", signature)
+	require.NoError(t, webhook.Verify("secret-of-sixteen", "1700000000", signature, body))
+	assert.ErrorIs(t, webhook.Verify("another-secret-16", "1700000000", signature, body), webhook.ErrInvalidSignature)
+	assert.ErrorIs(t, webhook.Verify("secret-of-sixteen", "1700000001", signature, body), webhook.ErrInvalidSignature)
+	assert.ErrorIs(t, webhook.Verify("secret-of-sixteen", "1700000000", signature, []byte(`{}`)), webhook.ErrInvalidSignature)
+	assert.ErrorIs(t, webhook.Verify("secret-of-sixteen", "now", signature, body), webhook.ErrInvalidSignature)
+}
+
+func TestBackoff(t *testing.T) {
+	assert.Equal(t, 30*time.Second, webhook.Backoff(1))
+	assert.Equal(t, time.Minute, webhook.Backoff(2))
+	assert.Equal(t, 4*time.Minute, webhook.Backoff(4))
+	assert.Equal(t, webhook.DefaultMaxBackoff, webhook.Backoff(100))
+}
+
+func TestValidateURL(t *testing.T) {
+	require.NoError(t, webhook.ValidateURL("https://example.com/hooks"))
+	require.NoError(t, webhook.ValidateURL("http://localhost:8080/hooks"))
+	require.Error(t, webhook.ValidateURL("ftp://example.com/hooks"))
+	require.Error(t, webhook.ValidateURL("/hooks"))
+}
+
+func TestParseListDeliveriesQuery(t *testing.T) {
+	reportID := uuid.New()
+	filter, err := webhook.ParseListDeliveriesQuery(url.Values{
+		"report_id": {reportID.String()},
+		"status":    {webhook.StatusFailed},
+		"limit":     {"5"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, &reportID, filter.ReportID)
+	assert.Equal(t, webhook.StatusFailed, filter.Status)
+	assert.Equal(t, 5, filter.Limit)
+
+	filter, err = webhook.ParseListDeliveriesQuery(url.Values{})
+	require.NoError(t, err)
+	assert.Equal(t, webhook.DefaultListLimit, filter.Limit)
+
+	for _, query := range []url.Values{
+		{"status": {"lost"}},
+		{"report_id": {"1"}},
+		{"limit": {"1000"}},
+	} {
+		_, err := webhook.ParseListDeliveriesQuery(query)
+		require.Error(t, err, query)
+	}
+}
+
+func TestDispatcherSend(t *testing.T) {
+	delivery := &webhook.Delivery{
+		ID:      uuid.New(),
+		Event:   webhook.EventReportCompleted,
+		Secret:  "secret-of-sixteen",
+		Payload: []byte(`{"event":"report.completed"}`),
+	}
+	status := http.StatusNoContent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		assert.Equal(t, delivery.Payload, body)
+		assert.Equal(t, delivery.ID.String(), r.Header.Get(webhook.HeaderID))
+		assert.Equal(t, webhook.EventReportCompleted, r.Header.Get(webhook.HeaderEvent))
+		timestamp := r.Header.Get(webhook.HeaderTimestamp)
+		sentAt, err := strconv.ParseInt(timestamp, 10, 64)
+		require.NoError(t, err)
+		assert.WithinDuration(t, time.Now(), time.Unix(sentAt, 0), time.Minute)
+		assert.NoError(t, webhook.Verify(delivery.Secret, timestamp, r.Header.Get(webhook.HeaderSignature), body))
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+	delivery.URL = server.URL
+
+	// the test server listens on loopback which the default client rejects
+	dispatcher := webhook.NewDispatcher(nil, slog.Default()).WithClient(server.Client())
+	result := dispatcher.Send(context.Background(), delivery)
+	require.NoError(t, result.Err)
+	assert.Equal(t, http.StatusNoContent, result.ResponseStatus)
+
+	status = http.StatusFound
+	result = dispatcher.Send(context.Background(), delivery)
+	require.Error(t, result.Err)
+	assert.Equal(t, http.StatusFound, result.ResponseStatus)
+
+	server.Close()
+	result = dispatcher.Send(context.Background(), delivery)
+	require.Error(t, result.Err)
+	assert.Zero(t, result.ResponseStatus)
+}
+
+func TestDispatcherSendPrivateAddress(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	dispatcher := webhook.NewDispatcher(nil, slog.Default())
+	for _, endpoint := range []string{
+		server.URL,
+		"http://localhost:" + serverURL.Port(),
+		"http://[::1]:" + serverURL.Port(),
+		"http://0.0.0.0:" + serverURL.Port(),
+		"http://10.0.0.1",
+		"http://192.168.1.1",
+		"http://169.254.169.254/latest/meta-data",
+	} {
+		result := dispatcher.Send(context.Background(), &webhook.Delivery{
+			ID:      uuid.New(),
+			Event:   webhook.EventReportCompleted,
+			URL:     endpoint,
+			Secret:  "secret-of-sixteen",
+			Payload: []byte(`{}`),
+		})
+		require.ErrorIs(t, result.Err, webhook.ErrPrivateAddress, endpoint)
+		assert.Zero(t, result.ResponseStatus)
+	}
+	assert.Zero(t, requests)
+}
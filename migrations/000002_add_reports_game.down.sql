@@ -0,0 +1,2 @@
+ALTER TABLE reports
+  DROP COLUMN IF EXISTS game;
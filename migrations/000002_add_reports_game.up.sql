@@ -0,0 +1,2 @@
+ALTER TABLE reports
+  ADD COLUMN IF NOT EXISTS game VARCHAR(10) NOT NULL DEFAULT 'totk';
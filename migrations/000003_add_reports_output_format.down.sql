@@ -0,0 +1,3 @@
+ALTER TABLE reports
+  DROP COLUMN IF EXISTS output_format,
+  DROP COLUMN IF EXISTS compression;
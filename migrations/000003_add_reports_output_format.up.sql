@@ -0,0 +1,3 @@
+ALTER TABLE reports
+  ADD COLUMN IF NOT EXISTS output_format VARCHAR(20) NOT NULL DEFAULT 'csv',
+  ADD COLUMN IF NOT EXISTS compression VARCHAR(20) NOT NULL DEFAULT 'gzip';
@@ -0,0 +1,2 @@
+ALTER TABLE reports
+  ADD COLUMN IF NOT EXISTS parameters JSONB NOT NULL DEFAULT '{}'::jsonb;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS reports_user_id_report_type_created_at_idx;
+DROP INDEX IF EXISTS reports_user_id_created_at_idx;
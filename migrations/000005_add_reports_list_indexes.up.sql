@@ -0,0 +1,5 @@
+CREATE INDEX IF NOT EXISTS reports_user_id_created_at_idx
+  ON reports (user_id, created_at DESC, id DESC);
+
+CREATE INDEX IF NOT EXISTS reports_user_id_report_type_created_at_idx
+  ON reports (user_id, report_type, created_at DESC, id DESC);
@@ -0,0 +1,2 @@
+ALTER TABLE reports
+  ADD COLUMN IF NOT EXISTS cancelled_at TIMESTAMP WITHOUT TIME ZONE;
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS report_attempts (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id UUID NOT NULL,
+  report_id UUID NOT NULL,
+  worker_id VARCHAR(255) NOT NULL,
+  started_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  finished_at TIMESTAMP WITHOUT TIME ZONE,
+  error_message VARCHAR(300),
+  FOREIGN KEY (user_id, report_id) REFERENCES reports(user_id, id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS report_attempts_user_id_report_id_idx
+  ON report_attempts (user_id, report_id, started_at);
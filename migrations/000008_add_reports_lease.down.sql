@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS reports_lease_expires_at_idx;
+ALTER TABLE reports DROP COLUMN IF EXISTS lease_expires_at;
+ALTER TABLE reports DROP COLUMN IF EXISTS worker_id;
@@ -0,0 +1,6 @@
+ALTER TABLE reports ADD COLUMN IF NOT EXISTS worker_id VARCHAR(255);
+ALTER TABLE reports ADD COLUMN IF NOT EXISTS lease_expires_at TIMESTAMP WITHOUT TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS reports_lease_expires_at_idx
+  ON reports (lease_expires_at)
+  WHERE started_at IS NOT NULL AND cancelled_at IS NULL AND completed_at IS NULL AND failed_at IS NULL;
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS report_outbox (
+  id BIGSERIAL PRIMARY KEY,
+  user_id UUID NOT NULL,
+  report_id UUID NOT NULL,
+  payload JSONB NOT NULL,
+  attempts INTEGER NOT NULL DEFAULT 0,
+  last_error VARCHAR(300),
+  created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  next_attempt_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  sent_at TIMESTAMP WITHOUT TIME ZONE,
+  FOREIGN KEY (user_id, report_id) REFERENCES reports(user_id, id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS report_outbox_pending_idx
+  ON report_outbox (next_attempt_at, id)
+  WHERE sent_at IS NULL;
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS jobs (
+  id BIGSERIAL PRIMARY KEY,
+  queue VARCHAR(100) NOT NULL,
+  body BYTEA NOT NULL,
+  receipt_handle UUID,
+  receive_count INTEGER NOT NULL DEFAULT 0,
+  created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  visible_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS jobs_queue_visible_at_idx ON jobs (queue, visible_at, id);
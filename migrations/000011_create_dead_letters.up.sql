@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS dead_letters (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  queue VARCHAR(100) NOT NULL,
+  message_id VARCHAR(255) NOT NULL,
+  body BYTEA NOT NULL,
+  error_message TEXT NOT NULL,
+  receive_count INTEGER NOT NULL,
+  user_id UUID,
+  report_id UUID,
+  created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS dead_letters_user_id_created_at_idx ON dead_letters (user_id, created_at DESC);
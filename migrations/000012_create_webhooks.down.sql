@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS webhook_deliveries;
+
+ALTER TABLE reports DROP COLUMN IF EXISTS webhook_secret;
+ALTER TABLE reports DROP COLUMN IF EXISTS webhook_url;
+
+DROP TABLE IF EXISTS webhooks;
@@ -0,0 +1,37 @@
+CREATE TABLE IF NOT EXISTS webhooks (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  url VARCHAR(2048) NOT NULL,
+  secret VARCHAR(255) NOT NULL,
+  created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS webhooks_user_id_idx ON webhooks (user_id);
+
+ALTER TABLE reports ADD COLUMN IF NOT EXISTS webhook_url VARCHAR(2048);
+ALTER TABLE reports ADD COLUMN IF NOT EXISTS webhook_secret VARCHAR(255);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  webhook_id UUID REFERENCES webhooks(id) ON DELETE SET NULL,
+  report_id UUID,
+  event VARCHAR(50) NOT NULL,
+  url VARCHAR(2048) NOT NULL,
+  secret VARCHAR(255) NOT NULL,
+  payload JSONB NOT NULL,
+  status VARCHAR(20) NOT NULL DEFAULT 'pending',
+  attempts INTEGER NOT NULL DEFAULT 0,
+  response_status INTEGER,
+  last_error VARCHAR(300),
+  replay_of UUID REFERENCES webhook_deliveries(id) ON DELETE SET NULL,
+  created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  next_attempt_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  delivered_at TIMESTAMP WITHOUT TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_user_id_created_at_idx ON webhook_deliveries (user_id, created_at DESC);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_pending_idx
+  ON webhook_deliveries (next_attempt_at)
+  WHERE status = 'pending';
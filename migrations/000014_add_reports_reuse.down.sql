@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS reports_report_type_completed_at_idx;
+ALTER TABLE reports DROP COLUMN IF EXISTS reused_from;
+ALTER TABLE reports DROP COLUMN IF EXISTS reuse;
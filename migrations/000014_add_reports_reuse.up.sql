@@ -0,0 +1,6 @@
+ALTER TABLE reports ADD COLUMN IF NOT EXISTS reuse BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE reports ADD COLUMN IF NOT EXISTS reused_from UUID;
+
+CREATE INDEX IF NOT EXISTS reports_report_type_completed_at_idx
+  ON reports (report_type, completed_at DESC)
+  WHERE completed_at IS NOT NULL;
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS refresh_tokens_family_id_idx;
+
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS revoked_at;
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS rotated_at;
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS parent_hashed_token;
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS family_id;
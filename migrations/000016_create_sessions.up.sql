@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS sessions (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  label VARCHAR(100),
+  user_agent VARCHAR(500),
+  ip_address VARCHAR(45),
+  created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  last_used_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  revoked_at TIMESTAMP WITHOUT TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS sessions_user_id_last_used_at_idx ON sessions (user_id, last_used_at DESC);
+
+-- every existing token family becomes a session
+DELETE FROM refresh_tokens WHERE user_id IS NULL;
+INSERT INTO sessions(id, user_id, created_at, last_used_at, revoked_at)
+SELECT family_id, user_id, MIN(created_at), MAX(created_at), MAX(revoked_at)
+FROM refresh_tokens
+GROUP BY family_id, user_id;
+
+ALTER TABLE refresh_tokens ALTER COLUMN family_id DROP DEFAULT;
+ALTER TABLE refresh_tokens ADD CONSTRAINT refresh_tokens_family_id_fkey
+  FOREIGN KEY (family_id) REFERENCES sessions(id) ON DELETE CASCADE;
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS revoked_tokens;
+
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS access_expired_at;
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS access_jti;
+
+ALTER TABLE users DROP COLUMN IF EXISTS token_version;
@@ -0,0 +1 @@
+ALTER TABLE reports ADD COLUMN IF NOT EXISTS retried_at TIMESTAMP WITHOUT TIME ZONE;